@@ -4,27 +4,50 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 )
 
+const defaultAllowedFileTypes = "application/pdf,text/plain,text/markdown,text/csv,text/html,application/json," +
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document," +
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet," +
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation"
+
+const defaultVisionModels = "gpt-4o,gpt-4o-mini,gpt-4-turbo,gpt-4.1,gpt-4.1-mini,gpt-4.1-nano"
+
 type Config struct {
-	Port              string
-	DBUser            string
-	DBPassword        string
-	DBHost            string
-	DBPort            string
-	DBName            string
-	RedisAddr         string
-	RedisPassword     string
-	RedisDB           int
-	JWTSecretKey      string
-	OpenAIApiKey      string
-	OpenAIBaseURL     string
-	FRONTEND_BASE_URL string
-	MinioEndpoint     string
-	MinioAccessKey    string
-	MinioSecretKey    string
-	MinioBucket       string
-	MinioUseSSL       bool
+	Port                string
+	DBUser              string
+	DBPassword          string
+	DBHost              string
+	DBPort              string
+	DBName              string
+	RedisAddr           string
+	RedisPassword       string
+	RedisDB             int
+	JWTSecretKey        string
+	OpenAIApiKey        string
+	OpenAIBaseURL       string
+	FRONTEND_BASE_URL   string
+	MinioEndpoint       string
+	MinioAccessKey      string
+	MinioSecretKey      string
+	MinioBucket         string
+	MinioUseSSL         bool
+	StorageBackend      string
+	LocalStoragePath    string
+	StorageSigningKey   string
+	PublicBaseURL       string
+	UploadExpiryHours   int
+	MaxUploadSizeMB     int64
+	MaxUserStorageMB    int64
+	AllowedFileTypes    []string
+	MaxImportEntries    int
+	CrawlUserAgent      string
+	CrawlMaxPages       int
+	CrawlAllowPrivate   bool
+	TrashRetentionDays  int
+	MaxAttachmentSizeMB int64
+	VisionModels        []string
 }
 
 var App *Config
@@ -32,26 +55,49 @@ var App *Config
 func LoadConfig() {
 	redisDB, _ := strconv.Atoi(getEnv("REDIS_DB", "0"))
 	minioUseSSL, _ := strconv.ParseBool(getEnv("MINIO_USE_SSL", "false"))
+	uploadExpiryHours, _ := strconv.Atoi(getEnv("UPLOAD_EXPIRY_HOURS", "24"))
+	maxUploadSizeMB, _ := strconv.ParseInt(getEnv("MAX_UPLOAD_SIZE_MB", "500"), 10, 64)
+	maxUserStorageMB, _ := strconv.ParseInt(getEnv("MAX_USER_STORAGE_MB", "5120"), 10, 64)
+	maxImportEntries, _ := strconv.Atoi(getEnv("MAX_IMPORT_ENTRIES", "1000"))
+	crawlMaxPages, _ := strconv.Atoi(getEnv("CRAWL_MAX_PAGES", "200"))
+	crawlAllowPrivate, _ := strconv.ParseBool(getEnv("CRAWL_ALLOW_PRIVATE_NETWORKS", "false"))
+	trashRetentionDays, _ := strconv.Atoi(getEnv("TRASH_RETENTION_DAYS", "30"))
+	maxAttachmentSizeMB, _ := strconv.ParseInt(getEnv("MAX_ATTACHMENT_SIZE_MB", "10"), 10, 64)
 
 	App = &Config{
-		Port:              getEnv("PORT", "8080"),
-		DBUser:            getEnv("DB_USER", "rag_user"),
-		DBPassword:        getEnv("DB_PASSWORD", "rag_password"),
-		DBHost:            getEnv("DB_HOST", "127.0.0.1"),
-		DBPort:            getEnv("DB_PORT", "3306"),
-		DBName:            getEnv("DB_NAME", "rag_db"),
-		RedisAddr:         getEnv("REDIS_ADDR", "127.0.0.1:6379"),
-		RedisPassword:     getEnv("REDIS_PASSWORD", ""),
-		RedisDB:           redisDB,
-		JWTSecretKey:      getEnv("JWT_SECRET_KEY", "default_secret_key"),
-		OpenAIApiKey:      getEnv("OPENAI_API_KEY", ""),
-		OpenAIBaseURL:     getEnv("OPENAI_BASE_URL", ""),
-		FRONTEND_BASE_URL: getEnv("FRONTEND_BASE_URL", "http://localhost:3000"),
-		MinioEndpoint:     getEnv("MINIO_ENDPOINT", "localhost:9000"),
-		MinioAccessKey:    getEnv("MINIO_ACCESS_KEY", "minioadmin"),
-		MinioSecretKey:    getEnv("MINIO_SECRET_KEY", "minioadmin"),
-		MinioBucket:       getEnv("MINIO_BUCKET", "documents"),
-		MinioUseSSL:       minioUseSSL,
+		Port:                getEnv("PORT", "8080"),
+		DBUser:              getEnv("DB_USER", "rag_user"),
+		DBPassword:          getEnv("DB_PASSWORD", "rag_password"),
+		DBHost:              getEnv("DB_HOST", "127.0.0.1"),
+		DBPort:              getEnv("DB_PORT", "3306"),
+		DBName:              getEnv("DB_NAME", "rag_db"),
+		RedisAddr:           getEnv("REDIS_ADDR", "127.0.0.1:6379"),
+		RedisPassword:       getEnv("REDIS_PASSWORD", ""),
+		RedisDB:             redisDB,
+		JWTSecretKey:        getEnv("JWT_SECRET_KEY", "default_secret_key"),
+		OpenAIApiKey:        getEnv("OPENAI_API_KEY", ""),
+		OpenAIBaseURL:       getEnv("OPENAI_BASE_URL", ""),
+		FRONTEND_BASE_URL:   getEnv("FRONTEND_BASE_URL", "http://localhost:3000"),
+		MinioEndpoint:       getEnv("MINIO_ENDPOINT", "localhost:9000"),
+		MinioAccessKey:      getEnv("MINIO_ACCESS_KEY", "minioadmin"),
+		MinioSecretKey:      getEnv("MINIO_SECRET_KEY", "minioadmin"),
+		MinioBucket:         getEnv("MINIO_BUCKET", "documents"),
+		MinioUseSSL:         minioUseSSL,
+		StorageBackend:      getEnv("STORAGE_BACKEND", "minio"),
+		LocalStoragePath:    getEnv("LOCAL_STORAGE_PATH", "./data/storage"),
+		StorageSigningKey:   getEnv("STORAGE_SIGNING_KEY", getEnv("JWT_SECRET_KEY", "default_secret_key")),
+		PublicBaseURL:       getEnv("PUBLIC_BASE_URL", "http://localhost:8080"),
+		UploadExpiryHours:   uploadExpiryHours,
+		MaxUploadSizeMB:     maxUploadSizeMB,
+		MaxUserStorageMB:    maxUserStorageMB,
+		AllowedFileTypes:    strings.Split(getEnv("ALLOWED_FILE_TYPES", defaultAllowedFileTypes), ","),
+		MaxImportEntries:    maxImportEntries,
+		CrawlUserAgent:      getEnv("CRAWL_USER_AGENT", "RAGBot/1.0"),
+		CrawlMaxPages:       crawlMaxPages,
+		CrawlAllowPrivate:   crawlAllowPrivate,
+		TrashRetentionDays:  trashRetentionDays,
+		MaxAttachmentSizeMB: maxAttachmentSizeMB,
+		VisionModels:        strings.Split(getEnv("VISION_MODELS", defaultVisionModels), ","),
 	}
 
 	log.Println("Configuration loaded successfully")
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+)
+
+// @Summary      Export Account Data
+// @Description  Request a ZIP of the profile, conversations, messages, documents and original files of the current user. The archive is built in the background: poll until the status is "ready" to receive a download URL. A new export is started when none exists or the last one failed, expired or was interrupted.
+// @Tags         Auth
+// @Produce      json
+// @Success      200  {object}  map[string]interface{}
+// @Success      202  {object}  models.DataExport
+// @Security     BearerAuth
+// @Router       /api/v1/auth/me/export [get]
+func ExportAccount(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var export models.DataExport
+	err := database.DB.Where("user_id = ?", userID).Order("id DESC").First(&export).Error
+	usable := err == nil && !services.FailStalledDataExport(&export) &&
+		export.Status != "failed" && (export.ExpiresAt == nil || export.ExpiresAt.After(time.Now()))
+	if !usable {
+		started, err := services.StartDataExport(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start export"})
+			return
+		}
+		c.JSON(http.StatusAccepted, started)
+		return
+	}
+
+	if export.Status != "ready" {
+		c.JSON(http.StatusAccepted, export)
+		return
+	}
+
+	url, err := services.GetPresignedURL(c.Request.Context(), export.ObjectKey, 15*time.Minute)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate download URL"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"export": export, "url": url, "expires_in": "15m"})
+}
+
+// @Summary      Delete Account
+// @Description  Permanently delete the current user with all their conversations, documents, files, groups and shares, and log out every session. This cannot be undone.
+// @Tags         Auth
+// @Produce      json
+// @Success      200  {object}  map[string]interface{}
+// @Security     BearerAuth
+// @Router       /api/v1/auth/me [delete]
+func DeleteAccount(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	// Sessions go first so a failure cannot leave a deleted user logged in
+	if err := services.RevokeUserSessions(c.Request.Context(), userID); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	if err := services.DeleteAccount(c.Request.Context(), userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted successfully"})
+}
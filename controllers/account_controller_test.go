@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+)
+
+func TestAccountDataExport(t *testing.T) {
+	SetupTestDB()
+	SetupTestStorage(t)
+	ctx := context.Background()
+
+	user := models.User{Email: "export@example.com", PasswordHash: "x", Name: "Exporter"}
+	database.DB.Create(&user)
+	conv := models.Conversation{UserID: user.ID, Title: "Trip plans"}
+	database.DB.Create(&conv)
+	database.DB.Create(&models.Message{ConversationID: conv.ID, Role: "user", Content: "Where to go?"})
+	_, err := services.AddConversationFile(conv.ID, "itinerary.txt", "text/plain", []byte("Day 1: Lisbon."))
+	assert.NoError(t, err)
+	attachment := models.MessageAttachment{UserID: user.ID, FileName: "map.png", ObjectKey: services.BuildAttachmentObjectKey(user.ID, "map.png"), ContentType: "image/png", Size: 3}
+	database.DB.Create(&attachment)
+	assert.NoError(t, services.UploadFile(ctx, attachment.ObjectKey, "image/png", strings.NewReader("png"), 3))
+	doc := models.Document{Title: "Notes", UserID: user.ID}
+	database.DB.Create(&doc)
+	file := models.DocumentFile{DocumentID: doc.ID, FileName: "notes.txt", ObjectKey: services.BuildObjectKey(doc.ID, "notes.txt"), ContentType: "text/plain", Size: 5}
+	database.DB.Create(&file)
+	assert.NoError(t, services.UploadFile(ctx, file.ObjectKey, "text/plain", strings.NewReader("hello"), 5))
+
+	router := GetTestRouterAs(user.ID)
+	router.GET("/auth/me/export", ExportAccount)
+	get := func() *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/auth/me/export", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Export is built in the background", func(t *testing.T) {
+		w := get()
+		assert.Equal(t, http.StatusAccepted, w.Code)
+
+		deadline := time.Now().Add(5 * time.Second)
+		for w.Code == http.StatusAccepted && time.Now().Before(deadline) {
+			time.Sleep(20 * time.Millisecond)
+			w = get()
+		}
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"url"`)
+
+		var export models.DataExport
+		database.DB.Where("user_id = ?", user.ID).First(&export)
+		assert.Equal(t, "ready", export.Status)
+
+		reader, err := services.GetFile(ctx, export.ObjectKey)
+		if !assert.NoError(t, err) {
+			return
+		}
+		data, _ := io.ReadAll(reader)
+		reader.Close()
+		archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if !assert.NoError(t, err) {
+			return
+		}
+		contents := map[string]string{}
+		for _, f := range archive.File {
+			r, _ := f.Open()
+			b, _ := io.ReadAll(r)
+			r.Close()
+			contents[f.Name] = string(b)
+		}
+		assert.Contains(t, contents["profile.json"], "export@example.com")
+		assert.NotContains(t, contents["profile.json"], "password")
+		assert.Contains(t, contents["conversations/1-Trip plans.json"], "Where to go?")
+		assert.Contains(t, contents["documents.json"], "notes.txt")
+		assert.Equal(t, "hello", contents["files/1-Notes/1-notes.txt"])
+		assert.Contains(t, contents["conversation_files.json"], "itinerary.txt")
+		assert.Equal(t, "Day 1: Lisbon.", contents["conversation_files/1/1-itinerary.txt"])
+		assert.Contains(t, contents["message_attachments.json"], "map.png")
+		assert.Equal(t, "png", contents["attachments/1-map.png"])
+	})
+
+	t.Run("Interrupted export is replaced", func(t *testing.T) {
+		stalled := models.DataExport{UserID: user.ID, Status: "running"}
+		database.DB.Create(&stalled)
+		database.DB.Model(&stalled).UpdateColumn("updated_at", time.Now().Add(-2*services.DataExportBuildTimeout))
+
+		w := get()
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		var started models.DataExport
+		json.Unmarshal(w.Body.Bytes(), &started)
+		assert.Greater(t, started.ID, stalled.ID)
+		database.DB.First(&stalled, stalled.ID)
+		assert.Equal(t, "failed", stalled.Status)
+
+		// Let the new export finish before the test storage goes away
+		deadline := time.Now().Add(5 * time.Second)
+		for w.Code == http.StatusAccepted && time.Now().Before(deadline) {
+			time.Sleep(20 * time.Millisecond)
+			w = get()
+		}
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
+
+func TestDeleteAccount(t *testing.T) {
+	SetupTestDB()
+	SetupTestStorage(t)
+	ctx := context.Background()
+
+	user := models.User{Email: "leaving@example.com", PasswordHash: "x", Name: "Leaving"}
+	other := models.User{Email: "staying@example.com", PasswordHash: "x", Name: "Staying"}
+	database.DB.Create(&[]*models.User{&user, &other})
+
+	conv := models.Conversation{UserID: user.ID, Title: "Bye"}
+	database.DB.Create(&conv)
+	database.DB.Create(&models.Message{ConversationID: conv.ID, Role: "user", Content: "Hi"})
+	database.DB.Delete(&conv)
+	doc := models.Document{Title: "Mine", UserID: user.ID}
+	database.DB.Create(&doc)
+	file := models.DocumentFile{DocumentID: doc.ID, FileName: "a.txt", ObjectKey: services.BuildObjectKey(doc.ID, "a.txt"), ContentType: "text/plain", Size: 1}
+	database.DB.Create(&file)
+	assert.NoError(t, services.UploadFile(ctx, file.ObjectKey, "text/plain", strings.NewReader("a"), 1))
+	group := models.Group{OwnerID: user.ID, Name: "Team"}
+	database.DB.Create(&group)
+	database.DB.Create(&models.GroupMember{GroupID: group.ID, UserID: other.ID})
+
+	otherDoc := models.Document{Title: "Theirs", UserID: other.ID}
+	database.DB.Create(&otherDoc)
+	database.DB.Create(&models.DocumentShare{DocumentID: otherDoc.ID, UserID: &user.ID, Role: services.RoleViewer, CreatedBy: other.ID})
+	database.DB.Create(&models.DocumentShare{DocumentID: otherDoc.ID, GroupID: &group.ID, Role: services.RoleViewer, CreatedBy: other.ID})
+
+	assert.NoError(t, services.DeleteAccount(ctx, user.ID))
+
+	count := func(model interface{}) int64 {
+		var n int64
+		database.DB.Unscoped().Model(model).Count(&n)
+		return n
+	}
+	assert.Equal(t, int64(1), count(&models.User{}))
+	assert.Equal(t, int64(0), count(&models.Conversation{}), "soft-deleted rows are removed too")
+	assert.Equal(t, int64(0), count(&models.Message{}))
+	assert.Equal(t, int64(1), count(&models.Document{}))
+	assert.Equal(t, int64(0), count(&models.DocumentFile{}))
+	assert.Equal(t, int64(0), count(&models.Group{}))
+	assert.Equal(t, int64(0), count(&models.GroupMember{}))
+	assert.Equal(t, int64(0), count(&models.DocumentShare{}))
+
+	_, err := services.StatFile(ctx, file.ObjectKey)
+	assert.Error(t, err, "stored files are deleted")
+
+	var remaining models.User
+	database.DB.First(&remaining)
+	body, _ := json.Marshal(remaining)
+	assert.Contains(t, string(body), other.Email)
+}
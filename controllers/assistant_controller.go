@@ -0,0 +1,240 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/dtos"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+)
+
+// @Summary      Create Assistant
+// @Description  Create an assistant with instructions, model settings, knowledge documents and tools that conversations can be started with. The documents must be readable by the user; shared assistants search them on behalf of everyone chatting with them.
+// @Tags         Assistants
+// @Accept       json
+// @Produce      json
+// @Param        body body dtos.AssistantRequest true "Assistant Request"
+// @Success      201  {object}  models.Assistant
+// @Security     BearerAuth
+// @Router       /api/v1/assistants [post]
+func CreateAssistant(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var input dtos.AssistantRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	assistant := models.Assistant{UserID: userID}
+	if !applyAssistantRequest(c, &assistant, &input) {
+		return
+	}
+
+	if err := database.DB.Create(&assistant).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create assistant"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, assistant)
+}
+
+// @Summary      Get Assistants
+// @Description  List the user's own assistants and every shared one, one page at a time. The documents of other users' assistants are not shown.
+// @Tags         Assistants
+// @Produce      json
+// @Param        cursor         query  string  false  "next_cursor of the previous page"
+// @Param        limit          query  int     false  "Page size (default 50, max 100)"
+// @Param        sort           query  string  false  "name, created_at or updated_at, prefix with - for descending (default name)"
+// @Param        updated_since  query  string  false  "Only assistants updated at or after this RFC 3339 timestamp or YYYY-MM-DD"
+// @Success      200  {object}  map[string]interface{}  "items and next_cursor"
+// @Security     BearerAuth
+// @Router       /api/v1/assistants [get]
+func GetAssistants(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	params, ok := bindListParams(c, "name", "name", "created_at", "updated_at")
+	if !ok {
+		return
+	}
+
+	assistants := []models.Assistant{}
+	next, err := services.Paginate(services.VisibleAssistants(userID), "assistants", params, &assistants)
+	for i := range assistants {
+		hideAssistantDocuments(userID, &assistants[i])
+	}
+	respondPage(c, assistants, next, err, "Failed to fetch assistants")
+}
+
+// @Summary      Get Assistant
+// @Description  Get an assistant the user owns or that is shared. The documents are only shown to the owner.
+// @Tags         Assistants
+// @Produce      json
+// @Param        id   path      string  true  "Assistant ID"
+// @Success      200  {object}  models.Assistant
+// @Security     BearerAuth
+// @Router       /api/v1/assistants/{id} [get]
+func GetAssistant(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	assistant, ok := findAssistant(c, userID, false)
+	if !ok {
+		return
+	}
+	hideAssistantDocuments(userID, assistant)
+
+	c.JSON(http.StatusOK, assistant)
+}
+
+// @Summary      Update Assistant
+// @Description  Replace an assistant the user owns. Existing conversations with it use the new settings from their next message on.
+// @Tags         Assistants
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "Assistant ID"
+// @Param        body body dtos.AssistantRequest true "Assistant Request"
+// @Success      200  {object}  models.Assistant
+// @Security     BearerAuth
+// @Router       /api/v1/assistants/{id} [put]
+func UpdateAssistant(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	assistant, ok := findAssistant(c, userID, true)
+	if !ok {
+		return
+	}
+
+	var input dtos.AssistantRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !applyAssistantRequest(c, assistant, &input) {
+		return
+	}
+
+	if err := database.DB.Save(assistant).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update assistant"})
+		return
+	}
+
+	c.JSON(http.StatusOK, assistant)
+}
+
+// @Summary      Delete Assistant
+// @Description  Permanently delete an assistant the user owns. Conversations started with it are kept and continue with the default settings.
+// @Tags         Assistants
+// @Produce      json
+// @Param        id   path      string  true  "Assistant ID"
+// @Success      200  {object}  map[string]interface{}
+// @Security     BearerAuth
+// @Router       /api/v1/assistants/{id} [delete]
+func DeleteAssistant(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	assistant, ok := findAssistant(c, userID, true)
+	if !ok {
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&models.Conversation{}).Where("assistant_id = ?", assistant.ID).Update("assistant_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(assistant).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete assistant"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Assistant deleted"})
+}
+
+// findAssistant loads the assistant in the :id path parameter if userID can
+// see it, or, with owned, change it. It writes the error response itself when
+// it fails.
+func findAssistant(c *gin.Context, userID uint, owned bool) (*models.Assistant, bool) {
+	var assistant models.Assistant
+	if err := services.VisibleAssistants(userID).Where("id = ?", c.Param("id")).First(&assistant).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Assistant not found"})
+		return nil, false
+	}
+	if owned && assistant.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner can change an assistant"})
+		return nil, false
+	}
+	return &assistant, true
+}
+
+// applyAssistantRequest copies input onto assistant after checking its name
+// and documents. It writes the error response itself when it fails.
+func applyAssistantRequest(c *gin.Context, assistant *models.Assistant, input *dtos.AssistantRequest) bool {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Assistant name must not be empty"})
+		return false
+	}
+
+	visibility := input.Visibility
+	if visibility == "" {
+		visibility = models.AssistantPrivate
+	}
+
+	// Checked on every change, since a replace can share an assistant or swap
+	// its documents
+	documentIDs := slices.Compact(slices.Sorted(slices.Values(input.DocumentIDs)))
+	if err := services.ValidateAssistantDocuments(assistant.UserID, documentIDs, visibility); err != nil {
+		switch {
+		case errors.Is(err, services.ErrAssistantDocumentNotFound) && visibility == models.AssistantShared:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Shared assistants can only use documents you own"})
+		case errors.Is(err, services.ErrAssistantDocumentNotFound):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Every document must exist and be readable by you"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up documents"})
+		}
+		return false
+	}
+
+	tools := slices.Compact(slices.Sorted(slices.Values(input.Tools)))
+	if tools == nil {
+		tools = []string{}
+	}
+	if documentIDs == nil {
+		documentIDs = []uint{}
+	}
+
+	assistant.Name = name
+	assistant.Description = input.Description
+	assistant.Instructions = input.Instructions
+	assistant.Model = strings.TrimSpace(input.Model)
+	assistant.Temperature = input.Temperature
+	assistant.MaxTokens = input.MaxTokens
+	assistant.DocumentIDs = documentIDs
+	assistant.Tools = tools
+	assistant.Visibility = visibility
+	return true
+}
+
+// hideAssistantDocuments clears the documents of an assistant userID does not
+// own, so a shared assistant does not reveal which documents it searches.
+func hideAssistantDocuments(userID uint, assistant *models.Assistant) {
+	if assistant.UserID != userID {
+		assistant.DocumentIDs = nil
+	}
+}
+
+// conversationAssistant loads the assistant a conversation was started with,
+// or nil when there is none or userID can no longer see it.
+func conversationAssistant(userID uint, conversation *models.Conversation) *models.Assistant {
+	if conversation.AssistantID == nil {
+		return nil
+	}
+	var assistant models.Assistant
+	if err := services.VisibleAssistants(userID).Where("id = ?", *conversation.AssistantID).First(&assistant).Error; err != nil {
+		return nil
+	}
+	return &assistant
+}
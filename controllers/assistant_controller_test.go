@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"hsduc.com/rag/config"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+)
+
+func TestAssistants(t *testing.T) {
+	var completion struct {
+		Model       string  `json:"model"`
+		Temperature float32 `json:"temperature"`
+		Messages    []struct {
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	mockOpenAI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&completion)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`)
+	}))
+	defer mockOpenAI.Close()
+
+	config.App = &config.Config{OpenAIApiKey: "test-key", OpenAIBaseURL: mockOpenAI.URL}
+	SetupTestDB()
+	store := SetupTestStorage(t)
+
+	router := func(userID uint) *gin.Engine {
+		r := GetTestRouterAs(userID)
+		r.POST("/assistants", CreateAssistant)
+		r.GET("/assistants", GetAssistants)
+		r.GET("/assistants/:id", GetAssistant)
+		r.PUT("/assistants/:id", UpdateAssistant)
+		r.DELETE("/assistants/:id", DeleteAssistant)
+		r.POST("/conversations", CreateConversation)
+		r.POST("/messages", CreateMessage)
+		return r
+	}
+	hr, employee := router(1), router(2)
+	send := func(r *gin.Engine, method, path string, payload interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	documents := map[uint]string{1: "Employees get 25 vacation days per year.", 2: "My vacation plan: 10 days in August."}
+	docIDs := map[uint]uint{}
+	for owner, text := range documents {
+		key := fmt.Sprintf("documents/%d/1_notes.txt", owner)
+		store.Put(t.Context(), key, "text/plain", bytes.NewReader([]byte(text)), int64(len(text)))
+		doc := models.Document{Title: fmt.Sprintf("Doc of %d", owner), UserID: owner}
+		database.DB.Create(&doc)
+		database.DB.Create(&models.DocumentFile{DocumentID: doc.ID, FileName: fmt.Sprintf("user%d.txt", owner), ObjectKey: key, ContentType: "text/plain", Size: int64(len(text))})
+		docIDs[owner] = doc.ID
+	}
+
+	var bot models.Assistant
+	t.Run("Create", func(t *testing.T) {
+		w := send(hr, "POST", "/assistants", map[string]interface{}{"name": "HR policy bot", "document_ids": []uint{docIDs[2]}})
+		assert.Equal(t, http.StatusBadRequest, w.Code, "documents of others cannot be attached")
+		w = send(hr, "POST", "/assistants", map[string]interface{}{"name": "HR policy bot", "tools": []string{"shell"}})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		viewer := uint(1)
+		database.DB.Create(&models.DocumentShare{DocumentID: docIDs[2], UserID: &viewer, Role: services.RoleViewer, CreatedBy: 2})
+		w = send(hr, "POST", "/assistants", map[string]interface{}{"name": "Shared notes", "document_ids": []uint{docIDs[2]}, "visibility": "shared"})
+		assert.Equal(t, http.StatusBadRequest, w.Code, "shared documents cannot be published through a shared assistant")
+		w = send(hr, "POST", "/assistants", map[string]interface{}{"name": "Shared notes", "document_ids": []uint{docIDs[2]}})
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var notes models.Assistant
+		json.Unmarshal(w.Body.Bytes(), &notes)
+		w = send(hr, "PUT", fmt.Sprintf("/assistants/%d", notes.ID), map[string]interface{}{"name": "Shared notes", "document_ids": []uint{docIDs[2]}, "visibility": "shared"})
+		assert.Equal(t, http.StatusBadRequest, w.Code, "sharing later is checked too")
+		send(hr, "DELETE", fmt.Sprintf("/assistants/%d", notes.ID), nil)
+
+		w = send(hr, "POST", "/assistants", map[string]interface{}{
+			"name":         "HR policy bot",
+			"instructions": "You answer questions about HR policy.",
+			"model":        "gpt-4o",
+			"temperature":  0.2,
+			"document_ids": []uint{docIDs[1], docIDs[1]},
+			"visibility":   "shared",
+		})
+		assert.Equal(t, http.StatusCreated, w.Code)
+		json.Unmarshal(w.Body.Bytes(), &bot)
+		assert.Equal(t, []uint{docIDs[1]}, bot.DocumentIDs)
+		assert.Equal(t, []string{}, bot.Tools)
+
+		send(hr, "POST", "/assistants", map[string]interface{}{"name": "Drafts"})
+		var listed struct {
+			Items []models.Assistant `json:"items"`
+		}
+		json.Unmarshal(send(employee, "GET", "/assistants", nil).Body.Bytes(), &listed)
+		if assert.Len(t, listed.Items, 1) {
+			assert.Equal(t, "HR policy bot", listed.Items[0].Name)
+			assert.Nil(t, listed.Items[0].DocumentIDs, "documents are only shown to the owner")
+		}
+		assert.Equal(t, http.StatusForbidden, send(employee, "PUT", fmt.Sprintf("/assistants/%d", bot.ID), map[string]interface{}{"name": "Mine"}).Code)
+	})
+
+	var conversation models.Conversation
+	ask := func(t *testing.T) models.Message {
+		w := send(employee, "POST", "/messages", map[string]interface{}{"conversation_id": conversation.ID, "role": "user", "content": "How many vacation days?"})
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var resp struct {
+			AssistantMessage models.Message `json:"assistant_message"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp.AssistantMessage
+	}
+
+	t.Run("Chat with a shared assistant", func(t *testing.T) {
+		w := send(employee, "POST", "/conversations", map[string]interface{}{"assistant_id": bot.ID})
+		assert.Equal(t, http.StatusCreated, w.Code)
+		json.Unmarshal(w.Body.Bytes(), &conversation)
+		assert.Equal(t, "HR policy bot", conversation.Title)
+
+		reply := ask(t)
+		assert.Equal(t, "gpt-4o", completion.Model)
+		assert.InDelta(t, 0.2, completion.Temperature, 0.001)
+		system := completion.Messages[0].Content
+		assert.Contains(t, system, "You answer questions about HR policy.")
+		assert.Contains(t, system, "Employees get 25 vacation days", "the owner's documents are searched")
+		assert.NotContains(t, system, "August", "the user's library is not searched")
+		assert.Equal(t, "gpt-4o", reply.Model)
+		assert.Equal(t, services.AssistantChatSettings(&bot).PromptVersion(), reply.PromptVersion)
+		assert.NotEqual(t, services.ChatSettings{}.PromptVersion(), reply.PromptVersion)
+	})
+
+	t.Run("Library search", func(t *testing.T) {
+		w := send(hr, "PUT", fmt.Sprintf("/assistants/%d", bot.ID), map[string]interface{}{
+			"name":         "HR policy bot",
+			"instructions": "You answer questions about HR policy.",
+			"document_ids": []uint{docIDs[1]},
+			"tools":        []string{"library_search"},
+			"visibility":   "shared",
+		})
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		ask(t)
+		assert.Equal(t, services.ChatModel, completion.Model)
+		assert.Contains(t, completion.Messages[0].Content, "Employees get 25 vacation days")
+		assert.Contains(t, completion.Messages[0].Content, "August")
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, send(hr, "DELETE", fmt.Sprintf("/assistants/%d", bot.ID), nil).Code)
+		database.DB.First(&conversation, conversation.ID)
+		assert.Nil(t, conversation.AssistantID)
+
+		ask(t)
+		assert.NotContains(t, completion.Messages[0].Content, "HR policy")
+		assert.Equal(t, http.StatusNotFound, send(employee, "POST", "/conversations", map[string]interface{}{"assistant_id": bot.ID}).Code)
+	})
+}
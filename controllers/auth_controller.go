@@ -11,6 +11,7 @@ import (
 	"hsduc.com/rag/database"
 	"hsduc.com/rag/dtos"
 	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
 	"hsduc.com/rag/utils"
 )
 
@@ -90,6 +91,10 @@ func Login(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save session"})
 		return
 	}
+	if err := services.TrackSession(context.Background(), user.ID, sessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save session"})
+		return
+	}
 
 	c.JSON(http.StatusOK, dtos.AuthResponse{
 		AccessToken:  accessStr,
@@ -140,6 +145,7 @@ func RefreshToken(c *gin.Context) {
 
 	// Save new session
 	database.Redis.Set(context.Background(), "session:"+newSessionID, details.UserID, 7*24*time.Hour)
+	services.TrackSession(context.Background(), details.UserID, newSessionID)
 
 	c.JSON(http.StatusOK, dtos.AuthResponse{
 		AccessToken:  accessStr,
@@ -0,0 +1,292 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/dtos"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+)
+
+// @Summary      Create Collection
+// @Description  Create a collection at the root or inside another collection. Names must be unique among siblings.
+// @Tags         Collections
+// @Accept       json
+// @Produce      json
+// @Param        body body dtos.CreateCollectionRequest true "Create Collection Request"
+// @Success      201  {object}  models.Collection
+// @Security     BearerAuth
+// @Router       /api/v1/collections [post]
+func CreateCollection(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	var input dtos.CreateCollectionRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	col := models.Collection{UserID: userID, ParentID: input.ParentID, Name: strings.TrimSpace(input.Name)}
+	if !checkCollectionPlacement(c, &col) {
+		return
+	}
+
+	if err := database.DB.Create(&col).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create collection"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, col)
+}
+
+// @Summary      Get Collections
+// @Description  Get the authenticated user's collections as a tree, with the number of documents directly in each
+// @Tags         Collections
+// @Produce      json
+// @Success      200  {array}   services.CollectionNode
+// @Security     BearerAuth
+// @Router       /api/v1/collections [get]
+func GetCollections(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	tree, err := services.GetCollectionTree(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve collections"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tree)
+}
+
+// @Summary      Get Collection
+// @Description  Get a collection with its direct sub-collections and documents
+// @Tags         Collections
+// @Produce      json
+// @Param        id   path      int  true  "Collection ID"
+// @Success      200  {object}  map[string]interface{}
+// @Security     BearerAuth
+// @Router       /api/v1/collections/{id} [get]
+func GetCollection(c *gin.Context) {
+	userID := c.GetUint("userID")
+	col, ok := findCollection(c, userID)
+	if !ok {
+		return
+	}
+
+	children := []models.Collection{}
+	if err := database.DB.Where("user_id = ? AND parent_id = ?", userID, col.ID).Order("name").Find(&children).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve collection"})
+		return
+	}
+	documents := []models.Document{}
+	if err := database.DB.Where("user_id = ? AND collection_id = ?", userID, col.ID).Preload("Files").Order("title").Find(&documents).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve collection"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"collection":  col,
+		"collections": children,
+		"documents":   documents,
+	})
+}
+
+// @Summary      Rename Collection
+// @Description  Rename a collection
+// @Tags         Collections
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "Collection ID"
+// @Param        body body dtos.RenameCollectionRequest true "Rename Collection Request"
+// @Success      200  {object}  models.Collection
+// @Security     BearerAuth
+// @Router       /api/v1/collections/{id} [put]
+func RenameCollection(c *gin.Context) {
+	userID := c.GetUint("userID")
+	col, ok := findCollection(c, userID)
+	if !ok {
+		return
+	}
+
+	var input dtos.RenameCollectionRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	col.Name = strings.TrimSpace(input.Name)
+	if !checkCollectionPlacement(c, col) {
+		return
+	}
+
+	if err := database.DB.Save(col).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename collection"})
+		return
+	}
+
+	c.JSON(http.StatusOK, col)
+}
+
+// @Summary      Move Collection
+// @Description  Move a collection with everything in it under another collection, or to the root when parent_id is null. A collection cannot be moved into itself or its own sub-collections.
+// @Tags         Collections
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "Collection ID"
+// @Param        body body dtos.MoveCollectionRequest true "Move Collection Request"
+// @Success      200  {object}  models.Collection
+// @Security     BearerAuth
+// @Router       /api/v1/collections/{id}/move [post]
+func MoveCollection(c *gin.Context) {
+	userID := c.GetUint("userID")
+	col, ok := findCollection(c, userID)
+	if !ok {
+		return
+	}
+
+	var input dtos.MoveCollectionRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := services.ValidateCollectionMove(userID, col.ID, input.ParentID); err != nil {
+		if errors.Is(err, services.ErrCollectionCycle) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move collection"})
+		return
+	}
+
+	col.ParentID = input.ParentID
+	if !checkCollectionPlacement(c, col) {
+		return
+	}
+
+	if err := database.DB.Model(col).Update("parent_id", col.ParentID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move collection"})
+		return
+	}
+
+	c.JSON(http.StatusOK, col)
+}
+
+// @Summary      Delete Collection
+// @Description  Delete a collection together with all its sub-collections and every document in them
+// @Tags         Collections
+// @Produce      json
+// @Param        id   path      int  true  "Collection ID"
+// @Success      200  {object}  map[string]interface{}
+// @Security     BearerAuth
+// @Router       /api/v1/collections/{id} [delete]
+func DeleteCollection(c *gin.Context) {
+	userID := c.GetUint("userID")
+	col, ok := findCollection(c, userID)
+	if !ok {
+		return
+	}
+
+	ids, err := services.CollectionSubtreeIDs(userID, col.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete collection"})
+		return
+	}
+
+	var docs []models.Document
+	if err := database.DB.Where("user_id = ? AND collection_id IN ?", userID, ids).Find(&docs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete collection"})
+		return
+	}
+	for i := range docs {
+		if err := deleteDocument(&docs[i]); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete collection"})
+			return
+		}
+	}
+
+	if err := database.DB.Where("user_id = ? AND id IN ?", userID, ids).Delete(&models.Collection{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete collection"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":             "Collection deleted successfully",
+		"deleted_collections": len(ids),
+		"deleted_documents":   len(docs),
+	})
+}
+
+// findCollection loads the collection in the :id path parameter if it
+// belongs to userID. It writes the error response itself when it fails.
+func findCollection(c *gin.Context, userID uint) (*models.Collection, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection ID"})
+		return nil, false
+	}
+
+	var col models.Collection
+	if err := database.DB.Where("id = ? AND user_id = ?", id, userID).First(&col).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+		return nil, false
+	}
+
+	return &col, true
+}
+
+// checkCollectionOwner reports whether a collection referenced in a request
+// body belongs to userID; nil means the root and is always allowed. It writes
+// the error response itself when the check fails.
+func checkCollectionOwner(c *gin.Context, userID uint, id *uint) bool {
+	if id == nil {
+		return true
+	}
+
+	var count int64
+	if err := database.DB.Model(&models.Collection{}).Where("id = ? AND user_id = ?", *id, userID).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up collection"})
+		return false
+	}
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+		return false
+	}
+	return true
+}
+
+// checkCollectionPlacement verifies that col can live under its parent: the
+// parent must belong to the same user and no sibling may share its name. It
+// writes the error response itself when the check fails.
+func checkCollectionPlacement(c *gin.Context, col *models.Collection) bool {
+	if col.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Collection name must not be empty"})
+		return false
+	}
+	if !checkCollectionOwner(c, col.UserID, col.ParentID) {
+		return false
+	}
+
+	siblings := database.DB.Model(&models.Collection{}).Where("user_id = ? AND name = ? AND id <> ?", col.UserID, col.Name, col.ID)
+	if col.ParentID == nil {
+		siblings = siblings.Where("parent_id IS NULL")
+	} else {
+		siblings = siblings.Where("parent_id = ?", *col.ParentID)
+	}
+
+	var count int64
+	if err := siblings.Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up collection"})
+		return false
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A collection with this name already exists here"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+)
+
+func TestCollections(t *testing.T) {
+	SetupTestDB()
+	SetupTestStorage(t)
+	r := GetTestRouter()
+	r.POST("/collections", CreateCollection)
+	r.GET("/collections", GetCollections)
+	r.GET("/collections/:id", GetCollection)
+	r.PUT("/collections/:id", RenameCollection)
+	r.POST("/collections/:id/move", MoveCollection)
+	r.DELETE("/collections/:id", DeleteCollection)
+	r.POST("/documents", CreateDocument)
+	r.GET("/documents", GetDocuments)
+	r.POST("/documents/:id/move", MoveDocument)
+
+	send := func(method, path string, payload interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	create := func(name string, parentID *uint) models.Collection {
+		w := send("POST", "/collections", map[string]interface{}{"name": name, "parent_id": parentID})
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var col models.Collection
+		json.Unmarshal(w.Body.Bytes(), &col)
+		return col
+	}
+
+	eng := create("Engineering", nil)
+	runbooks := create("Runbooks", &eng.ID)
+	legal := create("Legal", nil)
+
+	t.Run("Sibling names must be unique", func(t *testing.T) {
+		w := send("POST", "/collections", map[string]interface{}{"name": "Runbooks", "parent_id": eng.ID})
+		assert.Equal(t, http.StatusConflict, w.Code)
+		w = send("PUT", fmt.Sprintf("/collections/%d", legal.ID), map[string]interface{}{"name": "Engineering"})
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Parent must belong to the user", func(t *testing.T) {
+		foreign := models.Collection{UserID: 2, Name: "Not mine"}
+		database.DB.Create(&foreign)
+		w := send("POST", "/collections", map[string]interface{}{"name": "Sneaky", "parent_id": foreign.ID})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = send("POST", "/documents", map[string]interface{}{"title": "Sneaky", "collection_id": foreign.ID})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	w := send("POST", "/documents", map[string]interface{}{"title": "Deploy runbook", "collection_id": runbooks.ID})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var deploy models.Document
+	json.Unmarshal(w.Body.Bytes(), &deploy)
+	database.DB.Create(&models.DocumentFile{DocumentID: deploy.ID, FileName: "deploy.txt", ObjectKey: "documents/1/deploy.txt", ContentType: "text/plain", Size: 10})
+	w = send("POST", "/documents", map[string]interface{}{"title": "Contract"})
+	var contract models.Document
+	json.Unmarshal(w.Body.Bytes(), &contract)
+
+	t.Run("Move document and filter by collection subtree", func(t *testing.T) {
+		w := send("POST", fmt.Sprintf("/documents/%d/move", contract.ID), map[string]interface{}{"collection_id": legal.ID})
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var page struct {
+			Items []models.Document `json:"items"`
+		}
+		w = send("GET", fmt.Sprintf("/documents?collection_id=%d", eng.ID), nil)
+		json.Unmarshal(w.Body.Bytes(), &page)
+		if assert.Len(t, page.Items, 1) {
+			assert.Equal(t, "Deploy runbook", page.Items[0].Title)
+		}
+
+		w = send("GET", "/documents?collection_id=9999", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Tree lists children and document counts", func(t *testing.T) {
+		w := send("GET", "/collections", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var tree []services.CollectionNode
+		json.Unmarshal(w.Body.Bytes(), &tree)
+		if assert.Len(t, tree, 2) {
+			assert.Equal(t, "Engineering", tree[0].Name)
+			if assert.Len(t, tree[0].Children, 1) {
+				assert.Equal(t, "Runbooks", tree[0].Children[0].Name)
+				assert.Equal(t, int64(1), tree[0].Children[0].DocumentCount)
+			}
+			assert.Equal(t, "Legal", tree[1].Name)
+		}
+	})
+
+	t.Run("Cannot move a collection into its own subtree", func(t *testing.T) {
+		w := send("POST", fmt.Sprintf("/collections/%d/move", eng.ID), map[string]interface{}{"parent_id": runbooks.ID})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = send("POST", fmt.Sprintf("/collections/%d/move", eng.ID), map[string]interface{}{"parent_id": eng.ID})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Move and rename", func(t *testing.T) {
+		w := send("POST", fmt.Sprintf("/collections/%d/move", runbooks.ID), map[string]interface{}{"parent_id": nil})
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = send("PUT", fmt.Sprintf("/collections/%d", runbooks.ID), map[string]interface{}{"name": "Operations"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = send("POST", fmt.Sprintf("/collections/%d/move", runbooks.ID), map[string]interface{}{"parent_id": eng.ID})
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = send("GET", fmt.Sprintf("/collections/%d", eng.ID), nil)
+		var body struct {
+			Collections []models.Collection `json:"collections"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		if assert.Len(t, body.Collections, 1) {
+			assert.Equal(t, "Operations", body.Collections[0].Name)
+		}
+	})
+
+	t.Run("Delete removes the subtree and its documents", func(t *testing.T) {
+		w := send("DELETE", fmt.Sprintf("/collections/%d", eng.ID), nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var count int64
+		database.DB.Model(&models.Collection{}).Where("id IN ?", []uint{eng.ID, runbooks.ID}).Count(&count)
+		assert.Zero(t, count)
+		database.DB.Model(&models.Document{}).Where("id = ?", deploy.ID).Count(&count)
+		assert.Zero(t, count)
+		database.DB.Model(&models.DocumentFile{}).Where("document_id = ?", deploy.ID).Count(&count)
+		assert.Zero(t, count)
+		database.DB.Model(&models.Document{}).Where("id = ?", contract.ID).Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+}
@@ -2,15 +2,18 @@ package controllers
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 	"hsduc.com/rag/database"
 	"hsduc.com/rag/dtos"
 	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
 )
 
 // @Summary      Create Conversation
-// @Description  Create a new conversation
+// @Description  Create a new conversation, optionally with an assistant whose instructions, settings and knowledge are used for its replies
 // @Tags         Conversations
 // @Accept       json
 // @Produce      json
@@ -27,7 +30,17 @@ func CreateConversation(c *gin.Context) {
 	}
 
 	userID := c.MustGet("userID").(uint)
-	conversation := models.Conversation{Title: input.Title, UserID: userID}
+	conversation := models.Conversation{Title: input.Title, UserID: userID, AssistantID: input.AssistantID}
+	if input.AssistantID != nil {
+		var assistant models.Assistant
+		if err := services.VisibleAssistants(userID).Where("id = ?", *input.AssistantID).First(&assistant).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Assistant not found"})
+			return
+		}
+		if conversation.Title == "" {
+			conversation.Title = assistant.Name
+		}
+	}
 	if err := database.DB.Create(&conversation).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create conversation"})
 		return
@@ -37,21 +50,35 @@ func CreateConversation(c *gin.Context) {
 }
 
 // @Summary      Get Conversations
-// @Description  Get all conversations
+// @Description  List the user's conversations one page at a time. Archived conversations are left out unless archived is given.
 // @Tags         Conversations
 // @Produce      json
-// @Success      200  {array}   models.Conversation
+// @Param        pinned         query  bool    false  "Only pinned (true) or unpinned (false) conversations"
+// @Param        archived       query  string  false  "true for archived conversations only, all to include them (default false)"
+// @Param        folder_id      query  string  false  "Folder ID, or none for conversations outside any folder"
+// @Param        tag            query  []string  false  "Required tag (repeatable)"  collectionFormat(multi)
+// @Param        cursor         query  string  false  "next_cursor of the previous page"
+// @Param        limit          query  int     false  "Page size (default 50, max 100)"
+// @Param        sort           query  string  false  "created_at, updated_at or title, prefix with - for descending (default created_at)"
+// @Param        updated_since  query  string  false  "Only conversations updated at or after this RFC 3339 timestamp or YYYY-MM-DD"
+// @Success      200  {object}  map[string]interface{}  "items and next_cursor"
 // @Security     BearerAuth
 // @Router       /api/v1/conversations [get]
 func GetConversations(c *gin.Context) {
-	userID := c.MustGet("userID").(uint)
-	var conversations []models.Conversation
-	if err := database.DB.Where("user_id = ?", userID).Find(&conversations).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch conversations"})
+	filter, ok := bindConversationFilter(c)
+	if !ok {
+		return
+	}
+	params, ok := bindListParams(c, "created_at", "created_at", "updated_at", "title")
+	if !ok {
 		return
 	}
 
-	c.JSON(http.StatusOK, conversations)
+	userID := c.MustGet("userID").(uint)
+	conversations := []models.Conversation{}
+	query := filter.Apply(database.DB.Where("user_id = ?", userID))
+	next, err := services.Paginate(query, "conversations", params, &conversations)
+	respondPage(c, conversations, next, err, "Failed to fetch conversations")
 }
 
 // @Summary      Get Conversation
@@ -111,7 +138,7 @@ func UpdateConversation(c *gin.Context) {
 }
 
 // @Summary      Delete Conversation
-// @Description  Delete a conversation by id
+// @Description  Move a conversation to the trash and revoke its public links
 // @Tags         Conversations
 // @Produce      json
 // @Param        id   path      string  true  "Conversation ID"
@@ -129,6 +156,224 @@ func DeleteConversation(c *gin.Context) {
 	}
 
 	database.DB.Delete(&conversation)
+	// Public links must not outlive the conversation
+	database.DB.Where("conversation_id = ?", conversation.ID).Delete(&models.ConversationShare{})
 
 	c.JSON(http.StatusOK, gin.H{"message": "Conversation deleted"})
 }
+
+// @Summary      Get Conversation Tags
+// @Description  List the tags used on the user's conversations with how many conversations carry each
+// @Tags         Conversations
+// @Produce      json
+// @Success      200  {array}   services.FacetCount
+// @Security     BearerAuth
+// @Router       /api/v1/conversations/tags [get]
+func GetConversationTags(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	tags, err := services.GetConversationTags(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tags"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+// @Summary      Pin Conversation
+// @Description  Pin a conversation
+// @Tags         Conversations
+// @Produce      json
+// @Param        id   path      string  true  "Conversation ID"
+// @Success      200  {object}  models.Conversation
+// @Security     BearerAuth
+// @Router       /api/v1/conversations/{id}/pin [put]
+func PinConversation(c *gin.Context) {
+	setConversationFlag(c, "pinned", true)
+}
+
+// @Summary      Unpin Conversation
+// @Description  Unpin a conversation
+// @Tags         Conversations
+// @Produce      json
+// @Param        id   path      string  true  "Conversation ID"
+// @Success      200  {object}  models.Conversation
+// @Security     BearerAuth
+// @Router       /api/v1/conversations/{id}/pin [delete]
+func UnpinConversation(c *gin.Context) {
+	setConversationFlag(c, "pinned", false)
+}
+
+// @Summary      Archive Conversation
+// @Description  Archive a conversation, hiding it from the conversation list by default
+// @Tags         Conversations
+// @Produce      json
+// @Param        id   path      string  true  "Conversation ID"
+// @Success      200  {object}  models.Conversation
+// @Security     BearerAuth
+// @Router       /api/v1/conversations/{id}/archive [put]
+func ArchiveConversation(c *gin.Context) {
+	setConversationFlag(c, "archived", true)
+}
+
+// @Summary      Unarchive Conversation
+// @Description  Move a conversation out of the archive
+// @Tags         Conversations
+// @Produce      json
+// @Param        id   path      string  true  "Conversation ID"
+// @Success      200  {object}  models.Conversation
+// @Security     BearerAuth
+// @Router       /api/v1/conversations/{id}/archive [delete]
+func UnarchiveConversation(c *gin.Context) {
+	setConversationFlag(c, "archived", false)
+}
+
+// @Summary      Move Conversation
+// @Description  Put a conversation into a folder, or take it out of its folder when folder_id is null
+// @Tags         Conversations
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "Conversation ID"
+// @Param        body body dtos.MoveConversationRequest true "Move Conversation Request"
+// @Success      200  {object}  models.Conversation
+// @Security     BearerAuth
+// @Router       /api/v1/conversations/{id}/move [post]
+func MoveConversation(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	conversation, ok := findConversation(c, userID)
+	if !ok {
+		return
+	}
+
+	var input dtos.MoveConversationRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !checkConversationFolderOwner(c, userID, input.FolderID) {
+		return
+	}
+
+	conversation.FolderID = input.FolderID
+	if err := database.DB.Model(conversation).Update("folder_id", conversation.FolderID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move conversation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, conversation)
+}
+
+// @Summary      Update Conversation Tags
+// @Description  Replace the tags of a conversation
+// @Tags         Conversations
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "Conversation ID"
+// @Param        body body dtos.UpdateConversationTagsRequest true "Update Conversation Tags Request"
+// @Success      200  {object}  models.Conversation
+// @Security     BearerAuth
+// @Router       /api/v1/conversations/{id}/tags [put]
+func UpdateConversationTags(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	conversation, ok := findConversation(c, userID)
+	if !ok {
+		return
+	}
+
+	var input dtos.UpdateConversationTagsRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tags, _, err := services.NormalizeLabels(input.Tags, nil)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	conversation.Tags = tags
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(conversation).Error; err != nil {
+			return err
+		}
+		return services.SyncConversationTags(tx, conversation.ID, tags)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tags"})
+		return
+	}
+
+	c.JSON(http.StatusOK, conversation)
+}
+
+// setConversationFlag sets the pinned or archived flag of the conversation in
+// the :id path parameter and responds with the conversation.
+func setConversationFlag(c *gin.Context, column string, value bool) {
+	userID := c.MustGet("userID").(uint)
+	conversation, ok := findConversation(c, userID)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Model(conversation).Update(column, value).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update conversation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, conversation)
+}
+
+// findConversation loads the conversation in the :id path parameter if it
+// belongs to userID. It writes the error response itself when it fails.
+func findConversation(c *gin.Context, userID uint) (*models.Conversation, bool) {
+	var conversation models.Conversation
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&conversation).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return nil, false
+	}
+	return &conversation, true
+}
+
+// bindConversationFilter reads conversation filters from the query string.
+// Archived conversations are excluded unless archived is given. It writes the
+// error response itself when it fails.
+func bindConversationFilter(c *gin.Context) (services.ConversationFilter, bool) {
+	filter := services.ConversationFilter{Tags: c.QueryArray("tag")}
+
+	if raw := c.Query("pinned"); raw != "" {
+		pinned, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pinned"})
+			return filter, false
+		}
+		filter.Pinned = &pinned
+	}
+
+	switch raw := c.DefaultQuery("archived", "false"); raw {
+	case "all":
+	default:
+		archived, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid archived, expected true, false or all"})
+			return filter, false
+		}
+		filter.Archived = &archived
+	}
+
+	switch raw := c.Query("folder_id"); raw {
+	case "":
+	case "none":
+		filter.Unfiled = true
+	default:
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid folder_id"})
+			return filter, false
+		}
+		folderID := uint(id)
+		filter.FolderID = &folderID
+	}
+
+	return filter, true
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"hsduc.com/rag/database"
@@ -88,9 +89,14 @@ func TestGetConversations(t *testing.T) {
 			},
 			expectedStatus: http.StatusOK,
 			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
-				var conversations []models.Conversation
-				err := json.Unmarshal(w.Body.Bytes(), &conversations)
+				var page struct {
+					Items      []models.Conversation `json:"items"`
+					NextCursor *string               `json:"next_cursor"`
+				}
+				err := json.Unmarshal(w.Body.Bytes(), &page)
 				assert.NoError(t, err)
+				assert.Nil(t, page.NextCursor)
+				conversations := page.Items
 				assert.Len(t, conversations, 2)
 				assert.Equal(t, "Chat 1", conversations[0].Title)
 				assert.Equal(t, "Chat 2", conversations[1].Title)
@@ -117,6 +123,79 @@ func TestGetConversations(t *testing.T) {
 	}
 }
 
+func TestGetConversationsPagination(t *testing.T) {
+	SetupTestDB()
+	r := GetTestRouter()
+	r.GET("/conversations", GetConversations)
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, title := range []string{"Echo", "Alpha", "Delta", "Bravo", "Charlie"} {
+		// Two rows share each creation time to exercise the id tie-breaker
+		at := base.Add(time.Duration(i/2) * time.Hour)
+		database.DB.Create(&models.Conversation{Title: title, UserID: 1, CreatedAt: at, UpdatedAt: at})
+	}
+
+	type page struct {
+		Items      []models.Conversation `json:"items"`
+		NextCursor *string               `json:"next_cursor"`
+	}
+	get := func(query string) (int, page) {
+		req, _ := http.NewRequest("GET", "/conversations?"+query, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var p page
+		json.Unmarshal(w.Body.Bytes(), &p)
+		return w.Code, p
+	}
+	walk := func(query string) []string {
+		var titles []string
+		cursor := ""
+		for i := 0; i < 10; i++ {
+			code, p := get(query + "&cursor=" + cursor)
+			assert.Equal(t, http.StatusOK, code)
+			for _, conv := range p.Items {
+				titles = append(titles, conv.Title)
+			}
+			if p.NextCursor == nil {
+				return titles
+			}
+			cursor = *p.NextCursor
+		}
+		t.Fatal("pagination did not end")
+		return nil
+	}
+
+	t.Run("Pages through every row once in creation order", func(t *testing.T) {
+		assert.Equal(t, []string{"Echo", "Alpha", "Delta", "Bravo", "Charlie"}, walk("limit=2"))
+	})
+
+	t.Run("Descending sort", func(t *testing.T) {
+		assert.Equal(t, []string{"Echo", "Delta", "Charlie", "Bravo", "Alpha"}, walk("limit=2&sort=-title"))
+		assert.Equal(t, []string{"Charlie", "Bravo", "Delta", "Alpha", "Echo"}, walk("limit=3&sort=-created_at"))
+	})
+
+	t.Run("Updated since", func(t *testing.T) {
+		assert.Equal(t, []string{"Delta", "Bravo", "Charlie"}, walk("limit=10&updated_since="+base.Add(time.Hour).Format(time.RFC3339)))
+	})
+
+	t.Run("Rejects bad parameters", func(t *testing.T) {
+		_, first := get("limit=2")
+		code, _ := get("limit=2&sort=title&cursor=" + *first.NextCursor)
+		assert.Equal(t, http.StatusBadRequest, code, "cursor from another sort")
+
+		for _, query := range []string{"cursor=garbage", "limit=0", "sort=user_id", "updated_since=soon"} {
+			code, _ := get(query)
+			assert.Equal(t, http.StatusBadRequest, code, query)
+		}
+	})
+
+	t.Run("Limit is capped", func(t *testing.T) {
+		code, p := get("limit=100000")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Len(t, p.Items, 5)
+	})
+}
+
 func TestGetConversation(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+)
+
+// maxConversationImportBytes caps the request body of a conversation import.
+const maxConversationImportBytes = 10 << 20
+
+// @Summary      Export Conversation
+// @Description  Download a conversation with roles, timestamps and citations as Markdown, JSON (importable with Import Conversation) or print-ready HTML
+// @Tags         Conversations
+// @Produce      json
+// @Produce      html
+// @Produce      text/markdown
+// @Param        id      path   string  true   "Conversation ID"
+// @Param        format  query  string  false  "md, json (default) or html"
+// @Success      200
+// @Security     BearerAuth
+// @Router       /api/v1/conversations/{id}/export [get]
+func ExportConversation(c *gin.Context) {
+	id := c.Param("id")
+	userID := c.MustGet("userID").(uint)
+	var conversation models.Conversation
+
+	if err := database.DB.Where("id = ? AND user_id = ?", id, userID).First(&conversation).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "md" && format != "html" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported format, expected md, json or html"})
+		return
+	}
+
+	export, err := services.ExportConversation(&conversation)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export conversation"})
+		return
+	}
+
+	var body []byte
+	var contentType string
+	switch format {
+	case "md":
+		body, contentType = services.RenderConversationMarkdown(export), "text/markdown; charset=utf-8"
+	case "html":
+		body, err = services.RenderConversationHTML(export)
+		contentType = "text/html; charset=utf-8"
+	default:
+		body, err = json.MarshalIndent(export, "", "  ")
+		contentType = "application/json; charset=utf-8"
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export conversation"})
+		return
+	}
+
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": exportFileName(conversation.Title) + "." + format}))
+	c.Data(http.StatusOK, contentType, body)
+}
+
+// @Summary      Import Conversation
+// @Description  Recreate a conversation and its messages from a JSON export. Citations are dropped because they refer to documents of the exporting environment.
+// @Tags         Conversations
+// @Accept       json
+// @Produce      json
+// @Param        body body services.ConversationExport true "Conversation export"
+// @Success      201  {object}  models.Conversation
+// @Security     BearerAuth
+// @Router       /api/v1/conversations/import [post]
+func ImportConversation(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxConversationImportBytes)
+	var input services.ConversationExport
+	if err := json.NewDecoder(c.Request.Body).Decode(&input); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Export is too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export: " + err.Error()})
+		return
+	}
+
+	conversation, err := services.ImportConversation(userID, &input)
+	if errors.Is(err, services.ErrInvalidConversationImport) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import conversation"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, conversation)
+}
+
+// exportFileName turns a conversation title into a safe download name.
+func exportFileName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' {
+			return r
+		}
+		return '-'
+	}, strings.TrimSpace(title))
+	name = strings.Trim(name, "-")
+	for strings.Contains(name, "--") {
+		name = strings.ReplaceAll(name, "--", "-")
+	}
+	if name == "" {
+		return "conversation"
+	}
+	return name
+}
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+)
+
+func TestConversationExportImport(t *testing.T) {
+	SetupTestDB()
+
+	asked := time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)
+	conversation := models.Conversation{Title: "Refunds / Q1", UserID: 1}
+	database.DB.Create(&conversation)
+	database.DB.Create(&models.Message{ConversationID: conversation.ID, Role: "user", Content: "How long is the refund window?", CreatedAt: asked})
+	database.DB.Create(&models.Message{
+		ConversationID: conversation.ID,
+		Role:           "assistant",
+		Content:        "30 days.",
+		CreatedAt:      asked.Add(time.Minute),
+		Citations:      []models.Citation{{DocumentID: 4, FileID: 7, FileName: "policy.pdf"}},
+	})
+
+	r := GetTestRouter()
+	r.GET("/conversations/:id/export", ExportConversation)
+	r.POST("/conversations/import", ImportConversation)
+
+	export := func(format string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/conversations/%d/export?format=%s", conversation.ID, format), nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Markdown", func(t *testing.T) {
+		w := export("md")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `attachment; filename=Refunds-Q1.md`, w.Header().Get("Content-Disposition"))
+		assert.Contains(t, w.Body.String(), "# Refunds / Q1")
+		assert.Contains(t, w.Body.String(), "## User · 2026-03-01T09:30:00Z\n\nHow long is the refund window?")
+		assert.Contains(t, w.Body.String(), "- policy.pdf (document 4, file 7)")
+	})
+
+	t.Run("HTML", func(t *testing.T) {
+		w := export("html")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "@page")
+		assert.Contains(t, w.Body.String(), "<li>policy.pdf</li>")
+	})
+
+	t.Run("Unknown format", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, export("docx").Code)
+	})
+
+	t.Run("JSON round-trips through import", func(t *testing.T) {
+		w := export("json")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		req, _ := http.NewRequest("POST", "/conversations/import", bytes.NewReader(w.Body.Bytes()))
+		req.Header.Set("Content-Type", "application/json")
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		var imported models.Conversation
+		json.Unmarshal(w.Body.Bytes(), &imported)
+		assert.NotEqual(t, conversation.ID, imported.ID)
+		assert.Equal(t, "Refunds / Q1", imported.Title)
+
+		var messages []models.Message
+		database.DB.Where("conversation_id = ?", imported.ID).Order("created_at").Find(&messages)
+		if assert.Len(t, messages, 2) {
+			assert.Equal(t, "user", messages[0].Role)
+			assert.True(t, asked.Equal(messages[0].CreatedAt))
+			assert.Equal(t, "30 days.", messages[1].Content)
+			assert.Empty(t, messages[1].Citations)
+		}
+	})
+
+	t.Run("Rejects invalid exports", func(t *testing.T) {
+		for _, body := range []string{
+			`{"version": 2, "title": "x", "messages": []}`,
+			`{"version": 1, "title": "", "messages": []}`,
+			`{"version": 1, "title": "x", "messages": [{"role": "hacker", "content": "hi"}]}`,
+			`{"version": 1, "title": `,
+		} {
+			req, _ := http.NewRequest("POST", "/conversations/import", bytes.NewBufferString(body))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		}
+	})
+
+	t.Run("Other users cannot export", func(t *testing.T) {
+		other := GetTestRouterAs(2)
+		other.GET("/conversations/:id/export", ExportConversation)
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/conversations/%d/export", conversation.ID), nil)
+		w := httptest.NewRecorder()
+		other.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+}
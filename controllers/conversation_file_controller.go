@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+	"hsduc.com/rag/utils"
+)
+
+// @Summary      Upload Conversation File
+// @Description  Drop a file into a conversation to ask about it without creating a document. Its text is extracted and searched only when answering in this conversation; the file itself is not kept, and the text is deleted when the conversation is purged. Its size counts against the storage quota.
+// @Tags         Conversations
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        id    path      string  true  "Conversation ID"
+// @Param        file  formData  file    true  "File"
+// @Success      201   {object}  models.ConversationFile
+// @Security     BearerAuth
+// @Router       /api/v1/conversations/{id}/files [post]
+func UploadConversationFile(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	conversation, ok := findConversation(c, userID)
+	if !ok {
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is required"})
+		return
+	}
+	if err := services.ValidateAttachmentSize(fileHeader.Size); err != nil {
+		respondUploadError(c, err, "Failed to read file")
+		return
+	}
+	if err := services.ValidateStorageQuota(userID, fileHeader.Size); err != nil {
+		respondUploadError(c, err, "Failed to check storage quota")
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	// Sniff the real type from the content instead of trusting the client's header
+	fileName := path.Base(fileHeader.Filename)
+	contentType, err := services.ValidateContentType(data[:min(len(data), utils.SniffLength)], fileName)
+	if err != nil {
+		respondUploadError(c, err, "Failed to read file")
+		return
+	}
+
+	conversationFile, err := services.AddConversationFile(conversation.ID, fileName, contentType, data)
+	switch {
+	case errors.Is(err, services.ErrTooManyConversationFiles):
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("A conversation can hold at most %d files", services.MaxConversationFiles)})
+		return
+	case errors.Is(err, services.ErrNoExtractableText):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "No text could be extracted from the file"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, conversationFile)
+}
+
+// @Summary      Get Conversation Files
+// @Description  List the files dropped into a conversation
+// @Tags         Conversations
+// @Produce      json
+// @Param        id   path      string  true  "Conversation ID"
+// @Success      200  {array}   models.ConversationFile
+// @Security     BearerAuth
+// @Router       /api/v1/conversations/{id}/files [get]
+func GetConversationFiles(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	conversation, ok := findConversation(c, userID)
+	if !ok {
+		return
+	}
+
+	files := []models.ConversationFile{}
+	if err := database.DB.Where("conversation_id = ?", conversation.ID).Order("id").Find(&files).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch files"})
+		return
+	}
+
+	c.JSON(http.StatusOK, files)
+}
+
+// @Summary      Delete Conversation File
+// @Description  Remove a file from a conversation so it is no longer searched
+// @Tags         Conversations
+// @Produce      json
+// @Param        id      path      string  true  "Conversation ID"
+// @Param        fileId  path      string  true  "Conversation File ID"
+// @Success      200  {object}  map[string]interface{}
+// @Security     BearerAuth
+// @Router       /api/v1/conversations/{id}/files/{fileId} [delete]
+func DeleteConversationFile(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	conversation, ok := findConversation(c, userID)
+	if !ok {
+		return
+	}
+
+	var file models.ConversationFile
+	if err := database.DB.Where("id = ? AND conversation_id = ?", c.Param("fileId"), conversation.ID).First(&file).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("conversation_file_id = ?", file.ID).Delete(&models.ConversationFileChunk{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&file).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete file"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "File deleted"})
+}
@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"hsduc.com/rag/config"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+)
+
+func TestConversationFiles(t *testing.T) {
+	var completion struct {
+		Messages []struct {
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	mockOpenAI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&completion)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`)
+	}))
+	defer mockOpenAI.Close()
+
+	config.App = &config.Config{
+		OpenAIApiKey:        "test-key",
+		OpenAIBaseURL:       mockOpenAI.URL,
+		MaxAttachmentSizeMB: 1,
+		AllowedFileTypes:    []string{"text/plain"},
+	}
+	SetupTestDB()
+	SetupTestStorage(t)
+
+	r := GetTestRouter()
+	r.DELETE("/conversations/:id", DeleteConversation)
+	r.POST("/conversations/:id/files", UploadConversationFile)
+	r.GET("/conversations/:id/files", GetConversationFiles)
+	r.DELETE("/conversations/:id/files/:fileId", DeleteConversationFile)
+	r.POST("/messages", CreateMessage)
+
+	upload := func(conversationID uint, name string, content []byte) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, _ := writer.CreateFormFile("file", name)
+		part.Write(content)
+		writer.Close()
+		req, _ := http.NewRequest("POST", fmt.Sprintf("/conversations/%d/files", conversationID), body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	send := func(method, path string, payload interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	ask := func(conversationID uint) models.Message {
+		w := send("POST", "/messages", map[string]interface{}{"conversation_id": conversationID, "role": "user", "content": "What is the refund window?"})
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var resp struct {
+			AssistantMessage models.Message `json:"assistant_message"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp.AssistantMessage
+	}
+
+	contract := models.Conversation{UserID: 1, Title: "Contract"}
+	other := models.Conversation{UserID: 1, Title: "Other"}
+	foreign := models.Conversation{UserID: 2, Title: "Foreign"}
+	database.DB.Create(&contract)
+	database.DB.Create(&other)
+	database.DB.Create(&foreign)
+
+	var file models.ConversationFile
+	t.Run("Upload", func(t *testing.T) {
+		w := upload(contract.ID, "contract.txt", []byte("The refund window is 30 days after delivery."))
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		json.Unmarshal(w.Body.Bytes(), &file)
+		assert.Equal(t, "contract.txt", file.FileName)
+		assert.GreaterOrEqual(t, file.Chunks, 1)
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, upload(contract.ID, "tool.exe", []byte("MZ\x90\x00\x03\x00\x00\x00")).Code)
+		assert.Equal(t, http.StatusNotFound, upload(foreign.ID, "contract.txt", []byte("text")).Code)
+
+		var documents int64
+		database.DB.Model(&models.Document{}).Count(&documents)
+		assert.Zero(t, documents, "no document is created")
+
+		w = send("GET", fmt.Sprintf("/conversations/%d/files", contract.ID), nil)
+		var files []models.ConversationFile
+		json.Unmarshal(w.Body.Bytes(), &files)
+		assert.Len(t, files, 1)
+	})
+
+	t.Run("Only its conversation searches the file", func(t *testing.T) {
+		reply := ask(contract.ID)
+		assert.Contains(t, completion.Messages[0].Content, "The refund window is 30 days")
+		if assert.Len(t, reply.Citations, 1) {
+			assert.Equal(t, file.ID, reply.Citations[0].ConversationFileID)
+			assert.Equal(t, "contract.txt", reply.Citations[0].FileName)
+		}
+
+		reply = ask(other.ID)
+		assert.NotContains(t, completion.Messages[0].Content, "The refund window is 30 days")
+		assert.Empty(t, reply.Citations)
+	})
+
+	t.Run("File limit", func(t *testing.T) {
+		for i := 1; i < 10; i++ {
+			assert.Equal(t, http.StatusCreated, upload(other.ID, fmt.Sprintf("notes-%d.txt", i), []byte("Some notes.")).Code)
+		}
+		assert.Equal(t, http.StatusCreated, upload(other.ID, "notes-10.txt", []byte("Some notes.")).Code)
+		assert.Equal(t, http.StatusConflict, upload(other.ID, "notes-11.txt", []byte("Some notes.")).Code)
+
+		racing := models.Conversation{UserID: 1, Title: "Racing"}
+		database.DB.Create(&racing)
+		var wg sync.WaitGroup
+		for i := range services.MaxConversationFiles + 5 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				upload(racing.ID, fmt.Sprintf("race-%d.txt", i), []byte("Some notes."))
+			}()
+		}
+		wg.Wait()
+		var files int64
+		database.DB.Model(&models.ConversationFile{}).Where("conversation_id = ?", racing.ID).Count(&files)
+		assert.LessOrEqual(t, files, int64(services.MaxConversationFiles), "concurrent uploads cannot pass the limit")
+		database.DB.Where("conversation_id = ?", racing.ID).Delete(&models.ConversationFileChunk{})
+		database.DB.Where("conversation_id = ?", racing.ID).Delete(&models.ConversationFile{})
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, send("DELETE", fmt.Sprintf("/conversations/%d/files/%d", other.ID, file.ID), nil).Code)
+		assert.Equal(t, http.StatusOK, send("DELETE", fmt.Sprintf("/conversations/%d/files/%d", contract.ID, file.ID), nil).Code)
+		ask(contract.ID)
+		assert.NotContains(t, completion.Messages[0].Content, "The refund window is 30 days")
+
+		count := func() (files, chunks int64) {
+			database.DB.Model(&models.ConversationFile{}).Count(&files)
+			database.DB.Model(&models.ConversationFileChunk{}).Count(&chunks)
+			return files, chunks
+		}
+		assert.Equal(t, http.StatusOK, send("DELETE", fmt.Sprintf("/conversations/%d", other.ID), nil).Code)
+		files, _ := count()
+		assert.EqualValues(t, 10, files, "files are kept while the conversation is in the trash")
+		_, err := services.RestoreConversation(1, other.ID)
+		assert.NoError(t, err)
+		w := send("GET", fmt.Sprintf("/conversations/%d/files", other.ID), nil)
+		var restored []models.ConversationFile
+		json.Unmarshal(w.Body.Bytes(), &restored)
+		assert.Len(t, restored, 10)
+
+		send("DELETE", fmt.Sprintf("/conversations/%d", other.ID), nil)
+		_, err = services.EmptyTrash(t.Context(), 1)
+		assert.NoError(t, err)
+		files, chunks := count()
+		assert.Zero(t, files)
+		assert.Zero(t, chunks)
+	})
+
+	t.Run("Storage quota", func(t *testing.T) {
+		config.App.MaxUserStorageMB = 1
+		defer func() { config.App.MaxUserStorageMB = 0 }()
+
+		notes := bytes.Repeat([]byte("Meeting notes. "), 50000)
+		assert.Equal(t, http.StatusCreated, upload(contract.ID, "notes.txt", notes[:600*1024]).Code)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, upload(contract.ID, "more-notes.txt", notes[:600*1024]).Code)
+	})
+}
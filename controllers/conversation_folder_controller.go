@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/dtos"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+)
+
+// @Summary      Create Conversation Folder
+// @Description  Create a folder for conversations. Folder names are unique per user.
+// @Tags         Conversations
+// @Accept       json
+// @Produce      json
+// @Param        body body dtos.ConversationFolderRequest true "Conversation Folder Request"
+// @Success      201  {object}  models.ConversationFolder
+// @Security     BearerAuth
+// @Router       /api/v1/conversation-folders [post]
+func CreateConversationFolder(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var input dtos.ConversationFolderRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	folder := models.ConversationFolder{UserID: userID, Name: strings.TrimSpace(input.Name)}
+	if !checkConversationFolderName(c, &folder) {
+		return
+	}
+
+	if err := database.DB.Create(&folder).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create folder"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, folder)
+}
+
+// @Summary      Get Conversation Folders
+// @Description  List the user's conversation folders by name with the number of conversations in each
+// @Tags         Conversations
+// @Produce      json
+// @Success      200  {array}   services.ConversationFolderSummary
+// @Security     BearerAuth
+// @Router       /api/v1/conversation-folders [get]
+func GetConversationFolders(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	folders, err := services.GetConversationFolders(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch folders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, folders)
+}
+
+// @Summary      Rename Conversation Folder
+// @Description  Rename a conversation folder
+// @Tags         Conversations
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "Folder ID"
+// @Param        body body dtos.ConversationFolderRequest true "Conversation Folder Request"
+// @Success      200  {object}  models.ConversationFolder
+// @Security     BearerAuth
+// @Router       /api/v1/conversation-folders/{id} [put]
+func RenameConversationFolder(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	folder, ok := findConversationFolder(c, userID)
+	if !ok {
+		return
+	}
+
+	var input dtos.ConversationFolderRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	folder.Name = strings.TrimSpace(input.Name)
+	if !checkConversationFolderName(c, folder) {
+		return
+	}
+
+	if err := database.DB.Save(folder).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename folder"})
+		return
+	}
+
+	c.JSON(http.StatusOK, folder)
+}
+
+// @Summary      Delete Conversation Folder
+// @Description  Delete a conversation folder. The conversations in it are kept and moved out of the folder.
+// @Tags         Conversations
+// @Produce      json
+// @Param        id   path      string  true  "Folder ID"
+// @Success      200  {object}  map[string]interface{}
+// @Security     BearerAuth
+// @Router       /api/v1/conversation-folders/{id} [delete]
+func DeleteConversationFolder(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	folder, ok := findConversationFolder(c, userID)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Model(&models.Conversation{}).Where("user_id = ? AND folder_id = ?", userID, folder.ID).Update("folder_id", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete folder"})
+		return
+	}
+	if err := database.DB.Delete(folder).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete folder"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Folder deleted"})
+}
+
+// findConversationFolder loads the folder in the :id path parameter if it
+// belongs to userID. It writes the error response itself when it fails.
+func findConversationFolder(c *gin.Context, userID uint) (*models.ConversationFolder, bool) {
+	var folder models.ConversationFolder
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&folder).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+		return nil, false
+	}
+	return &folder, true
+}
+
+// checkConversationFolderOwner reports whether a folder referenced in a
+// request body belongs to userID; nil means no folder and is always allowed.
+// It writes the error response itself when the check fails.
+func checkConversationFolderOwner(c *gin.Context, userID uint, id *uint) bool {
+	if id == nil {
+		return true
+	}
+
+	var count int64
+	if err := database.DB.Model(&models.ConversationFolder{}).Where("id = ? AND user_id = ?", *id, userID).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up folder"})
+		return false
+	}
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+		return false
+	}
+	return true
+}
+
+// checkConversationFolderName verifies that folder has a name no other folder
+// of the same user uses. It writes the error response itself when the check
+// fails.
+func checkConversationFolderName(c *gin.Context, folder *models.ConversationFolder) bool {
+	if folder.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Folder name must not be empty"})
+		return false
+	}
+
+	var count int64
+	err := database.DB.Model(&models.ConversationFolder{}).
+		Where("user_id = ? AND name = ? AND id <> ?", folder.UserID, folder.Name, folder.ID).
+		Count(&count).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up folder"})
+		return false
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A folder with this name already exists"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+)
+
+func TestConversationOrganization(t *testing.T) {
+	SetupTestDB()
+	r := GetTestRouter()
+	r.GET("/conversations", GetConversations)
+	r.GET("/conversations/tags", GetConversationTags)
+	r.PUT("/conversations/:id/pin", PinConversation)
+	r.DELETE("/conversations/:id/pin", UnpinConversation)
+	r.PUT("/conversations/:id/archive", ArchiveConversation)
+	r.POST("/conversations/:id/move", MoveConversation)
+	r.PUT("/conversations/:id/tags", UpdateConversationTags)
+	r.POST("/conversation-folders", CreateConversationFolder)
+	r.GET("/conversation-folders", GetConversationFolders)
+	r.PUT("/conversation-folders/:id", RenameConversationFolder)
+	r.DELETE("/conversation-folders/:id", DeleteConversationFolder)
+
+	send := func(method, path string, payload interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	titles := func(query string) []string {
+		w := send("GET", "/conversations"+query, nil)
+		assert.Equal(t, http.StatusOK, w.Code, query)
+		var page struct {
+			Items []models.Conversation `json:"items"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &page)
+		names := []string{}
+		for _, conv := range page.Items {
+			names = append(names, conv.Title)
+		}
+		return names
+	}
+
+	work := models.Conversation{UserID: 1, Title: "Work"}
+	recipes := models.Conversation{UserID: 1, Title: "Recipes"}
+	old := models.Conversation{UserID: 1, Title: "Old"}
+	foreign := models.Conversation{UserID: 2, Title: "Foreign"}
+	database.DB.Create(&[]*models.Conversation{&work, &recipes, &old, &foreign})
+	foreignFolder := models.ConversationFolder{UserID: 2, Name: "Theirs"}
+	database.DB.Create(&foreignFolder)
+
+	var folder models.ConversationFolder
+	t.Run("Folders", func(t *testing.T) {
+		w := send("POST", "/conversation-folders", map[string]string{"name": " Projects "})
+		assert.Equal(t, http.StatusCreated, w.Code)
+		json.Unmarshal(w.Body.Bytes(), &folder)
+		assert.Equal(t, "Projects", folder.Name)
+
+		assert.Equal(t, http.StatusConflict, send("POST", "/conversation-folders", map[string]string{"name": "Projects"}).Code)
+		assert.Equal(t, http.StatusBadRequest, send("POST", "/conversation-folders", map[string]string{"name": "  "}).Code)
+		assert.Equal(t, http.StatusNotFound, send("PUT", fmt.Sprintf("/conversation-folders/%d", foreignFolder.ID), map[string]string{"name": "Mine"}).Code)
+
+		w = send("PUT", fmt.Sprintf("/conversation-folders/%d", folder.ID), map[string]string{"name": "Active projects"})
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Move into a folder", func(t *testing.T) {
+		w := send("POST", fmt.Sprintf("/conversations/%d/move", work.ID), map[string]interface{}{"folder_id": folder.ID})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, http.StatusNotFound, send("POST", fmt.Sprintf("/conversations/%d/move", recipes.ID), map[string]interface{}{"folder_id": foreignFolder.ID}).Code)
+		assert.Equal(t, http.StatusNotFound, send("POST", fmt.Sprintf("/conversations/%d/move", foreign.ID), map[string]interface{}{"folder_id": nil}).Code)
+
+		assert.Equal(t, []string{"Work"}, titles(fmt.Sprintf("?folder_id=%d", folder.ID)))
+		assert.Equal(t, []string{"Recipes", "Old"}, titles("?folder_id=none"))
+
+		var folders []services.ConversationFolderSummary
+		json.Unmarshal(send("GET", "/conversation-folders", nil).Body.Bytes(), &folders)
+		if assert.Len(t, folders, 1) {
+			assert.Equal(t, "Active projects", folders[0].Name)
+			assert.Equal(t, int64(1), folders[0].ConversationCount)
+		}
+	})
+
+	t.Run("Pin and archive", func(t *testing.T) {
+		w := send("PUT", fmt.Sprintf("/conversations/%d/pin", recipes.ID), nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var pinned models.Conversation
+		json.Unmarshal(w.Body.Bytes(), &pinned)
+		assert.True(t, pinned.Pinned)
+		assert.Equal(t, []string{"Recipes"}, titles("?pinned=true"))
+
+		assert.Equal(t, http.StatusOK, send("PUT", fmt.Sprintf("/conversations/%d/archive", old.ID), nil).Code)
+		assert.Equal(t, []string{"Work", "Recipes"}, titles(""), "archived conversations are hidden by default")
+		assert.Equal(t, []string{"Old"}, titles("?archived=true"))
+		assert.Equal(t, []string{"Work", "Recipes", "Old"}, titles("?archived=all"))
+
+		assert.Equal(t, http.StatusOK, send("DELETE", fmt.Sprintf("/conversations/%d/pin", recipes.ID), nil).Code)
+		assert.Empty(t, titles("?pinned=true"))
+		assert.Equal(t, http.StatusBadRequest, send("GET", "/conversations?archived=maybe", nil).Code)
+	})
+
+	t.Run("Tags", func(t *testing.T) {
+		w := send("PUT", fmt.Sprintf("/conversations/%d/tags", work.ID), map[string][]string{"tags": {"q3", " planning ", "q3"}})
+		assert.Equal(t, http.StatusOK, w.Code)
+		var tagged models.Conversation
+		json.Unmarshal(w.Body.Bytes(), &tagged)
+		assert.Equal(t, []string{"planning", "q3"}, tagged.Tags)
+		send("PUT", fmt.Sprintf("/conversations/%d/tags", recipes.ID), map[string][]string{"tags": {"q3"}})
+
+		assert.Equal(t, []string{"Work", "Recipes"}, titles("?tag=q3"))
+		assert.Equal(t, []string{"Work"}, titles("?tag=q3&tag=planning"))
+
+		var tags []services.FacetCount
+		json.Unmarshal(send("GET", "/conversations/tags", nil).Body.Bytes(), &tags)
+		assert.Equal(t, []services.FacetCount{{Value: "q3", Count: 2}, {Value: "planning", Count: 1}}, tags)
+
+		send("PUT", fmt.Sprintf("/conversations/%d/tags", work.ID), map[string][]string{"tags": {}})
+		assert.Equal(t, []string{"Recipes"}, titles("?tag=q3"))
+	})
+
+	t.Run("Deleting a folder keeps its conversations", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, send("DELETE", fmt.Sprintf("/conversation-folders/%d", folder.ID), nil).Code)
+		assert.Equal(t, []string{"Work", "Recipes"}, titles("?folder_id=none"))
+	})
+}
@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"errors"
+	"html/template"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"hsduc.com/rag/config"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/dtos"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+)
+
+// @Summary      Share Conversation
+// @Description  Create a public read-only link to a snapshot of the conversation. Messages added later are not included. The body is optional.
+// @Tags         Conversations
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true   "Conversation ID"
+// @Param        body body      dtos.ShareConversationRequest  false  "Share Conversation Request"
+// @Success      201  {object}  map[string]interface{}
+// @Security     BearerAuth
+// @Router       /api/v1/conversations/{id}/share [post]
+func ShareConversation(c *gin.Context) {
+	id := c.Param("id")
+	userID := c.MustGet("userID").(uint)
+	var conversation models.Conversation
+
+	if err := database.DB.Where("id = ? AND user_id = ?", id, userID).First(&conversation).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	}
+
+	var input dtos.ShareConversationRequest
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var expiresAt *time.Time
+	if input.ExpiresInHours > 0 {
+		t := time.Now().Add(time.Duration(input.ExpiresInHours) * time.Hour)
+		expiresAt = &t
+	}
+
+	share, err := services.ShareConversation(&conversation, expiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to share conversation"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"share": share, "url": shareURL(share.Token)})
+}
+
+// @Summary      Get Conversation Share Links
+// @Description  List the public links of a conversation that have not been revoked, including expired ones, one page at a time
+// @Tags         Conversations
+// @Produce      json
+// @Param        id             path   string  true   "Conversation ID"
+// @Param        cursor         query  string  false  "next_cursor of the previous page"
+// @Param        limit          query  int     false  "Page size (default 50, max 100)"
+// @Param        sort           query  string  false  "created_at, prefix with - for descending (default -created_at)"
+// @Param        updated_since  query  string  false  "Only links created at or after this RFC 3339 timestamp or YYYY-MM-DD"
+// @Success      200  {object}  map[string]interface{}  "items and next_cursor"
+// @Security     BearerAuth
+// @Router       /api/v1/conversations/{id}/share [get]
+func GetConversationShares(c *gin.Context) {
+	id := c.Param("id")
+	userID := c.MustGet("userID").(uint)
+
+	params, ok := bindListParams(c, "-created_at", "created_at")
+	if !ok {
+		return
+	}
+
+	shares := []models.ConversationShare{}
+	query := database.DB.Omit("Messages").Where("conversation_id = ? AND user_id = ?", id, userID)
+	next, err := services.Paginate(query, "conversation_shares", params, &shares)
+	respondPage(c, shares, next, err, "Failed to fetch share links")
+}
+
+// @Summary      Revoke Conversation Share Link
+// @Description  Revoke a public link so it no longer resolves
+// @Tags         Conversations
+// @Produce      json
+// @Param        id       path      string  true  "Conversation ID"
+// @Param        shareId  path      string  true  "Share ID"
+// @Success      200      {object}  map[string]interface{}
+// @Security     BearerAuth
+// @Router       /api/v1/conversations/{id}/share/{shareId} [delete]
+func RevokeConversationShare(c *gin.Context) {
+	id := c.Param("id")
+	userID := c.MustGet("userID").(uint)
+
+	result := database.DB.Where("id = ? AND conversation_id = ? AND user_id = ?", c.Param("shareId"), id, userID).Delete(&models.ConversationShare{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke share link"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Share link revoked"})
+}
+
+// @Summary      Get Shared Conversation
+// @Description  Read a shared conversation snapshot without authentication
+// @Tags         Conversations
+// @Produce      json
+// @Param        token  path      string  true  "Share token"
+// @Success      200    {object}  models.ConversationShare
+// @Router       /api/v1/shares/{token} [get]
+func GetSharedConversation(c *gin.Context) {
+	share, ok := findConversationShare(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"title":      share.Title,
+		"messages":   share.Messages,
+		"shared_at":  share.CreatedAt,
+		"expires_at": share.ExpiresAt,
+	})
+}
+
+// @Summary      View Shared Conversation
+// @Description  Render a shared conversation snapshot as a standalone HTML page, without authentication
+// @Tags         Conversations
+// @Produce      html
+// @Param        token  path  string  true  "Share token"
+// @Success      200
+// @Router       /share/{token} [get]
+func RenderSharedConversation(c *gin.Context) {
+	share, ok := findConversationShare(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := sharedConversationPage.Execute(c.Writer, share); err != nil {
+		c.Status(http.StatusInternalServerError)
+	}
+}
+
+// findConversationShare resolves the :token path parameter for the public
+// endpoints. It writes the error response itself when it fails.
+func findConversationShare(c *gin.Context) (*models.ConversationShare, bool) {
+	// Shared transcripts are meant for tickets, not search engines or caches
+	c.Header("X-Robots-Tag", "noindex, nofollow")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Header("Cache-Control", "private, no-store")
+
+	share, err := services.FindConversationShare(c.Param("token"))
+	if errors.Is(err, services.ErrShareExpired) {
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shared conversation not found"})
+		return nil, false
+	}
+	return share, true
+}
+
+func shareURL(token string) string {
+	return strings.TrimSuffix(config.App.PublicBaseURL, "/") + "/share/" + token
+}
+
+var sharedConversationPage = template.Must(template.New("share").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex, nofollow">
+<title>{{.Title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 48rem; margin: 2rem auto; padding: 0 1rem; color: #1f2328; }
+.message { border-radius: 8px; padding: 0.75rem 1rem; margin: 0.75rem 0; white-space: pre-wrap; overflow-wrap: anywhere; }
+.user { background: #eef4ff; }
+.assistant { background: #f6f8fa; }
+.meta { font-size: 0.8rem; color: #656d76; margin-bottom: 0.25rem; white-space: normal; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="meta">Shared on {{.CreatedAt.Format "2006-01-02 15:04 MST"}}</p>
+{{range .Messages}}<div class="message {{.Role}}"><div class="meta">{{.Role}} &middot; {{.CreatedAt.Format "2006-01-02 15:04"}}</div>{{.Content}}</div>
+{{else}}<p>This conversation has no messages.</p>
+{{end}}</body>
+</html>
+`))
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"hsduc.com/rag/config"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+)
+
+func TestConversationShareLinks(t *testing.T) {
+	config.App = &config.Config{PublicBaseURL: "https://rag.example.com/"}
+	SetupTestDB()
+
+	conversation := models.Conversation{Title: "Refund question", UserID: 1}
+	database.DB.Create(&conversation)
+	database.DB.Create(&models.Message{ConversationID: conversation.ID, Role: "user", Content: "Can I get a refund? <script>alert(1)</script>"})
+	database.DB.Create(&models.Message{ConversationID: conversation.ID, Role: "assistant", Content: "Yes, within 30 days."})
+
+	r := GetTestRouter()
+	r.POST("/conversations/:id/share", ShareConversation)
+	r.GET("/conversations/:id/share", GetConversationShares)
+	r.DELETE("/conversations/:id/share/:shareId", RevokeConversationShare)
+	r.GET("/shares/:token", GetSharedConversation)
+	r.GET("/share/:token", RenderSharedConversation)
+
+	send := func(r *gin.Engine, method, path string, body []byte) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	type shareResponse struct {
+		Share models.ConversationShare `json:"share"`
+		URL   string                   `json:"url"`
+	}
+
+	w := send(r, "POST", fmt.Sprintf("/conversations/%d/share", conversation.ID), nil)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created shareResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	assert.GreaterOrEqual(t, len(created.Share.Token), 43)
+	assert.Equal(t, "https://rag.example.com/share/"+created.Share.Token, created.URL)
+	assert.Nil(t, created.Share.ExpiresAt)
+
+	t.Run("Snapshot ignores later messages", func(t *testing.T) {
+		database.DB.Create(&models.Message{ConversationID: conversation.ID, Role: "user", Content: "Secret follow-up"})
+
+		w := send(r, "GET", "/shares/"+created.Share.Token, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "noindex, nofollow", w.Header().Get("X-Robots-Tag"))
+		var body struct {
+			Title    string                 `json:"title"`
+			Messages []models.SharedMessage `json:"messages"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		assert.Equal(t, "Refund question", body.Title)
+		if assert.Len(t, body.Messages, 2) {
+			assert.Equal(t, "assistant", body.Messages[1].Role)
+		}
+	})
+
+	t.Run("HTML page escapes message content", func(t *testing.T) {
+		w := send(r, "GET", "/share/"+created.Share.Token, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.True(t, strings.HasPrefix(w.Header().Get("Content-Type"), "text/html"))
+		assert.Contains(t, w.Body.String(), "Yes, within 30 days.")
+		assert.Contains(t, w.Body.String(), "&lt;script&gt;")
+		assert.NotContains(t, w.Body.String(), "Secret follow-up")
+	})
+
+	t.Run("Other users cannot share the conversation", func(t *testing.T) {
+		other := GetTestRouterAs(2)
+		other.POST("/conversations/:id/share", ShareConversation)
+		w := send(other, "POST", fmt.Sprintf("/conversations/%d/share", conversation.ID), nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Expired links are gone", func(t *testing.T) {
+		w := send(r, "POST", fmt.Sprintf("/conversations/%d/share", conversation.ID), []byte(`{"expires_in_hours": 1}`))
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var expiring shareResponse
+		json.Unmarshal(w.Body.Bytes(), &expiring)
+		assert.NotNil(t, expiring.Share.ExpiresAt)
+
+		database.DB.Model(&models.ConversationShare{}).Where("id = ?", expiring.Share.ID).Update("expires_at", time.Now().Add(-time.Minute))
+		assert.Equal(t, http.StatusGone, send(r, "GET", "/shares/"+expiring.Share.Token, nil).Code)
+	})
+
+	t.Run("Revoked links no longer resolve", func(t *testing.T) {
+		var shares struct {
+			Items []models.ConversationShare `json:"items"`
+		}
+		json.Unmarshal(send(r, "GET", fmt.Sprintf("/conversations/%d/share", conversation.ID), nil).Body.Bytes(), &shares)
+		assert.Len(t, shares.Items, 2)
+
+		w := send(r, "DELETE", fmt.Sprintf("/conversations/%d/share/%d", conversation.ID, created.Share.ID), nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, http.StatusNotFound, send(r, "GET", "/shares/"+created.Share.Token, nil).Code)
+		assert.Equal(t, http.StatusNotFound, send(r, "GET", "/share/"+created.Share.Token, nil).Code)
+	})
+
+	assert.Equal(t, http.StatusNotFound, send(r, "GET", "/shares/not-a-real-token", nil).Code)
+}
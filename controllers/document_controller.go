@@ -3,11 +3,14 @@ package controllers
 import (
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 	"hsduc.com/rag/database"
 	"hsduc.com/rag/dtos"
 	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
 )
 
 // @Summary      Create Document
@@ -28,12 +31,30 @@ func CreateDocument(c *gin.Context) {
 		return
 	}
 
+	tags, metadata, err := services.NormalizeLabels(input.Tags, input.Metadata)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !checkCollectionOwner(c, userID, input.CollectionID) {
+		return
+	}
+
 	doc := models.Document{
-		UserID:      userID,
-		Title:       input.Title,
-		Description: input.Description,
+		UserID:       userID,
+		Title:        input.Title,
+		Description:  input.Description,
+		CollectionID: input.CollectionID,
+		Tags:         tags,
+		Metadata:     metadata,
 	}
-	if err := database.DB.Create(&doc).Error; err != nil {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&doc).Error; err != nil {
+			return err
+		}
+		return services.SyncLabels(tx, doc.ID, 0, doc.Tags, doc.Metadata)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create document"})
 		return
 	}
@@ -42,22 +63,39 @@ func CreateDocument(c *gin.Context) {
 }
 
 // @Summary      Get Documents
-// @Description  Get all documents for the authenticated user
+// @Description  List the documents the authenticated user can read, one page at a time, optionally filtered. Tag and metadata filters also match labels on a document's files; content type and size filters match documents with at least one such file.
 // @Tags         Documents
 // @Produce      json
-// @Success      200  {array}   models.Document
+// @Param        collection_id   query  int       false  "Collection ID, including its sub-collections"
+// @Param        tag             query  []string  false  "Required tag (repeatable)"  collectionFormat(multi)
+// @Param        meta[key]       query  string    false  "Required metadata value, e.g. meta[team]=payments"
+// @Param        content_type    query  []string  false  "File content type (repeatable, any of)"  collectionFormat(multi)
+// @Param        created_after   query  string    false  "RFC 3339 timestamp or YYYY-MM-DD"
+// @Param        created_before  query  string    false  "RFC 3339 timestamp or YYYY-MM-DD"
+// @Param        min_size        query  int       false  "Minimum file size in bytes"
+// @Param        max_size        query  int       false  "Maximum file size in bytes"
+// @Param        cursor          query  string    false  "next_cursor of the previous page"
+// @Param        limit           query  int       false  "Page size (default 50, max 100)"
+// @Param        sort            query  string    false  "created_at, updated_at or title, prefix with - for descending (default created_at)"
+// @Param        updated_since   query  string    false  "Only documents updated at or after this RFC 3339 timestamp or YYYY-MM-DD"
+// @Success      200  {object}  map[string]interface{}  "items and next_cursor"
 // @Security     BearerAuth
 // @Router       /api/v1/documents [get]
 func GetDocuments(c *gin.Context) {
 	userID := c.GetUint("userID")
-
-	var docs []models.Document
-	if err := database.DB.Where("user_id = ?", userID).Preload("Files").Find(&docs).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve documents"})
+	filter, ok := bindDocumentFilter(c)
+	if !ok {
+		return
+	}
+	params, ok := bindListParams(c, "created_at", "created_at", "updated_at", "title")
+	if !ok {
 		return
 	}
 
-	c.JSON(http.StatusOK, docs)
+	docs := []models.Document{}
+	query := filter.ApplyToDocuments(services.AccessibleDocuments(database.DB, userID, services.RoleViewer)).Preload("Files")
+	next, err := services.Paginate(query, "documents", params, &docs)
+	respondPage(c, docs, next, err, "Failed to retrieve documents")
 }
 
 // @Summary      Get Document
@@ -70,15 +108,12 @@ func GetDocuments(c *gin.Context) {
 // @Router       /api/v1/documents/{id} [get]
 func GetDocument(c *gin.Context) {
 	userID := c.GetUint("userID")
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+	doc, ok := findDocument(c, userID, services.RoleViewer)
+	if !ok {
 		return
 	}
-
-	var doc models.Document
-	if err := database.DB.Where("id = ? AND user_id = ?", id, userID).Preload("Files").First(&doc).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+	if err := database.DB.Where("document_id = ?", doc.ID).Find(&doc.Files).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve document files"})
 		return
 	}
 
@@ -97,15 +132,8 @@ func GetDocument(c *gin.Context) {
 // @Router       /api/v1/documents/{id} [put]
 func UpdateDocument(c *gin.Context) {
 	userID := c.GetUint("userID")
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
-		return
-	}
-
-	var doc models.Document
-	if err := database.DB.Where("id = ? AND user_id = ?", id, userID).First(&doc).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+	doc, ok := findDocument(c, userID, services.RoleEditor)
+	if !ok {
 		return
 	}
 
@@ -121,8 +149,28 @@ func UpdateDocument(c *gin.Context) {
 	if input.Description != "" {
 		doc.Description = input.Description
 	}
+	if input.Tags != nil || input.Metadata != nil {
+		tags, metadata := input.Tags, input.Metadata
+		if tags == nil {
+			tags = doc.Tags
+		}
+		if metadata == nil {
+			metadata = doc.Metadata
+		}
+		var err error
+		if doc.Tags, doc.Metadata, err = services.NormalizeLabels(tags, metadata); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
-	if err := database.DB.Save(&doc).Error; err != nil {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(doc).Error; err != nil {
+			return err
+		}
+		return services.SyncLabels(tx, doc.ID, 0, doc.Tags, doc.Metadata)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update document"})
 		return
 	}
@@ -131,7 +179,7 @@ func UpdateDocument(c *gin.Context) {
 }
 
 // @Summary      Delete Document
-// @Description  Delete a document and all its files
+// @Description  Move a document with all its files to the trash
 // @Tags         Documents
 // @Produce      json
 // @Param        id   path      int  true  "Document ID"
@@ -140,27 +188,187 @@ func UpdateDocument(c *gin.Context) {
 // @Router       /api/v1/documents/{id} [delete]
 func DeleteDocument(c *gin.Context) {
 	userID := c.GetUint("userID")
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+	doc, ok := findDocument(c, userID, services.RoleOwner)
+	if !ok {
+		return
+	}
+	if err := deleteDocument(doc); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete document"})
 		return
 	}
 
-	var doc models.Document
-	if err := database.DB.Where("id = ? AND user_id = ?", id, userID).Preload("Files").First(&doc).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+	c.JSON(http.StatusOK, gin.H{"message": "Document deleted successfully"})
+}
+
+// @Summary      Move Document
+// @Description  Move a document into a collection, or to the root when collection_id is null
+// @Tags         Documents
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "Document ID"
+// @Param        body body dtos.MoveDocumentRequest true "Move Document Request"
+// @Success      200  {object}  models.Document
+// @Security     BearerAuth
+// @Router       /api/v1/documents/{id}/move [post]
+func MoveDocument(c *gin.Context) {
+	userID := c.GetUint("userID")
+	doc, ok := findDocument(c, userID, services.RoleOwner)
+	if !ok {
+		return
+	}
+
+	var input dtos.MoveDocumentRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !checkCollectionOwner(c, userID, input.CollectionID) {
 		return
 	}
 
-	// Delete all associated files from MinIO
-	for _, f := range doc.Files {
-		_ = deleteDocumentFileFromStorage(c.Request.Context(), f.ObjectKey)
+	doc.CollectionID = input.CollectionID
+	if err := database.DB.Model(doc).Update("collection_id", doc.CollectionID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move document"})
+		return
 	}
 
-	if err := database.DB.Delete(&doc).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete document"})
+	c.JSON(http.StatusOK, doc)
+}
+
+// @Summary      Get Document Facets
+// @Description  Count the tags, metadata values and file content types across the user's documents. Accepts the same filters as Get Documents, so counts reflect the current selection.
+// @Tags         Documents
+// @Produce      json
+// @Success      200  {object}  services.DocumentFacets
+// @Security     BearerAuth
+// @Router       /api/v1/documents/facets [get]
+func GetDocumentFacets(c *gin.Context) {
+	userID := c.GetUint("userID")
+	filter, ok := bindDocumentFilter(c)
+	if !ok {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Document deleted successfully"})
+	facets, err := services.GetDocumentFacets(userID, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve facets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, facets)
+}
+
+// bindDocumentFilter reads document filters from the query string. It writes
+// the error response itself when it fails.
+func bindDocumentFilter(c *gin.Context) (services.DocumentFilter, bool) {
+	filter := services.DocumentFilter{
+		Tags:         c.QueryArray("tag"),
+		Metadata:     c.QueryMap("meta"),
+		ContentTypes: c.QueryArray("content_type"),
+	}
+
+	if raw := c.Query("collection_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection_id"})
+			return filter, false
+		}
+		collectionID := uint(id)
+		userID := c.GetUint("userID")
+		if !checkCollectionOwner(c, userID, &collectionID) {
+			return filter, false
+		}
+		if filter.CollectionIDs, err = services.CollectionSubtreeIDs(userID, collectionID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up collection"})
+			return filter, false
+		}
+	}
+
+	for name, target := range map[string]**time.Time{"created_after": &filter.CreatedAfter, "created_before": &filter.CreatedBefore} {
+		raw := c.Query(name)
+		if raw == "" {
+			continue
+		}
+		t, err := parseQueryTime(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name + ", expected RFC 3339 or YYYY-MM-DD"})
+			return filter, false
+		}
+		*target = &t
+	}
+
+	for name, target := range map[string]*int64{"min_size": &filter.MinSize, "max_size": &filter.MaxSize} {
+		raw := c.Query(name)
+		if raw == "" {
+			continue
+		}
+		size, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || size < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name})
+			return filter, false
+		}
+		*target = size
+	}
+
+	return filter, true
+}
+
+// findDocument loads the document in the :id path parameter and checks that
+// userID holds at least role on it. It writes the error response itself when
+// it fails.
+func findDocument(c *gin.Context, userID uint, role string) (*models.Document, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+		return nil, false
+	}
+	return authorizeDocument(c, userID, id, role, "Document not found")
+}
+
+// authorizeDocument loads a document userID can read and checks that they
+// hold at least role on it. Users without any access get a 404 with
+// notFound, so the document's existence is not revealed. It writes the error
+// response itself when it fails.
+func authorizeDocument(c *gin.Context, userID uint, id int, role, notFound string) (*models.Document, bool) {
+	var doc models.Document
+	if err := services.AccessibleDocuments(database.DB, userID, services.RoleViewer).Where("documents.id = ?", id).First(&doc).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+		return nil, false
+	}
+
+	if role != services.RoleViewer {
+		granted, err := services.DocumentRole(userID, &doc)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check document access"})
+			return nil, false
+		}
+		if !services.RoleAtLeast(granted, role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You need " + role + " access to this document"})
+			return nil, false
+		}
+	}
+
+	return &doc, true
+}
+
+// deleteDocument moves a document with its files and sources to the trash
+// and drops its shares. Storage objects and file versions are kept until the
+// trash is purged. The document is deleted first so that restoring it can tell
+// its files from those trashed on their own earlier.
+func deleteDocument(doc *models.Document) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(doc).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("document_id = ?", doc.ID).Delete(&models.DocumentFile{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("document_id = ?", doc.ID).Delete(&models.DocumentSource{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("document_id = ?", doc.ID).Delete(&models.DocumentLabel{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("document_id = ?", doc.ID).Delete(&models.DocumentShare{}).Error
+	})
 }
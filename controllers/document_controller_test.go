@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+)
+
+func TestDocumentLabelsAndFilters(t *testing.T) {
+	SetupTestDB()
+	r := GetTestRouter()
+	r.POST("/documents", CreateDocument)
+	r.GET("/documents", GetDocuments)
+	r.GET("/documents/facets", GetDocumentFacets)
+	r.PUT("/documents/:id", UpdateDocument)
+	r.PUT("/documents/:id/files/:fileId/labels", UpdateDocumentFileLabels)
+
+	send := func(method, path string, payload interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	titles := func(w *httptest.ResponseRecorder) []string {
+		var page struct {
+			Items []models.Document `json:"items"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &page)
+		names := []string{}
+		for _, d := range page.Items {
+			names = append(names, d.Title)
+		}
+		return names
+	}
+
+	w := send("POST", "/documents", map[string]interface{}{
+		"title":    "Payments runbook",
+		"tags":     []string{" oncall ", "oncall", "ops"},
+		"metadata": map[string]string{"team": "payments"},
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var payments models.Document
+	json.Unmarshal(w.Body.Bytes(), &payments)
+	assert.Equal(t, []string{"oncall", "ops"}, payments.Tags)
+
+	w = send("POST", "/documents", map[string]interface{}{"title": "Search design", "metadata": map[string]string{"team": "search"}})
+	var search models.Document
+	json.Unmarshal(w.Body.Bytes(), &search)
+	pdf := models.DocumentFile{DocumentID: search.ID, FileName: "design.pdf", ObjectKey: "documents/2/1_design.pdf", ContentType: "application/pdf", Size: 4096}
+	database.DB.Create(&pdf)
+
+	w = send("PUT", fmt.Sprintf("/documents/%d/files/%d/labels", search.ID, pdf.ID), map[string]interface{}{"tags": []string{"rfc"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Updating without labels keeps them
+	w = send("PUT", fmt.Sprintf("/documents/%d", payments.ID), map[string]interface{}{"description": "How to handle incidents"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"", []string{"Payments runbook", "Search design"}},
+		{"?meta[team]=payments", []string{"Payments runbook"}},
+		{"?tag=oncall&tag=ops", []string{"Payments runbook"}},
+		{"?tag=oncall&tag=rfc", []string{}},
+		{"?tag=rfc", []string{"Search design"}},
+		{"?content_type=application/pdf", []string{"Search design"}},
+		{"?min_size=5000", []string{}},
+		{"?created_after=2000-01-01&max_size=4096", []string{"Search design"}},
+	}
+	for _, tt := range tests {
+		t.Run("Filter "+tt.query, func(t *testing.T) {
+			w := send("GET", "/documents"+tt.query, nil)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.ElementsMatch(t, tt.expected, titles(w))
+		})
+	}
+
+	w = send("GET", "/documents?created_before=yesterday", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = send("POST", "/documents", map[string]interface{}{"title": "Bad", "metadata": map[string]string{" ": "x"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = send("GET", "/documents/facets", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var facets services.DocumentFacets
+	json.Unmarshal(w.Body.Bytes(), &facets)
+	assert.ElementsMatch(t, []services.FacetCount{{Value: "payments", Count: 1}, {Value: "search", Count: 1}}, facets.Metadata["team"])
+	assert.ElementsMatch(t, []services.FacetCount{{Value: "oncall", Count: 1}, {Value: "ops", Count: 1}, {Value: "rfc", Count: 1}}, facets.Tags)
+	assert.Equal(t, []services.FacetCount{{Value: "application/pdf", Count: 1}}, facets.ContentTypes)
+
+	w = send("GET", "/documents/facets?meta[team]=payments", nil)
+	json.Unmarshal(w.Body.Bytes(), &facets)
+	assert.Empty(t, facets.ContentTypes)
+	assert.Len(t, facets.Tags, 2)
+}
@@ -2,14 +2,21 @@ package controllers
 
 import (
 	"context"
+	"errors"
+	"io"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 	"hsduc.com/rag/database"
+	"hsduc.com/rag/dtos"
 	"hsduc.com/rag/models"
 	"hsduc.com/rag/services"
+	"hsduc.com/rag/utils"
 )
 
 // @Summary      Upload File to Document
@@ -24,53 +31,138 @@ import (
 // @Router       /api/v1/documents/{id}/files [post]
 func UploadDocumentFile(c *gin.Context) {
 	userID := c.GetUint("userID")
-	docID, err := strconv.Atoi(c.Param("id"))
+	doc, ok := findDocument(c, userID, services.RoleEditor)
+	if !ok {
+		return
+	}
+
+	docFile, release, ok := storeUploadedFile(c, doc)
+	if !ok {
+		return
+	}
+
+	err := database.DB.Create(docFile).Error
+	release()
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+		// Clean up the uploaded object if DB insert fails and nothing else shares it
+		_ = deleteDocumentFileFromStorage(c.Request.Context(), docFile.ObjectKey)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file record"})
 		return
 	}
 
-	// Verify the document belongs to the user
-	var doc models.Document
-	if err := database.DB.Where("id = ? AND user_id = ?", docID, userID).First(&doc).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+	c.JSON(http.StatusCreated, docFile)
+}
+
+// @Summary      Initiate Direct Upload
+// @Description  Get a presigned URL to PUT a file directly to object storage (valid 15 minutes)
+// @Tags         Documents
+// @Accept       json
+// @Produce      json
+// @Param        id    path  int  true  "Document ID"
+// @Param        body  body  dtos.InitiateUploadRequest  true  "Initiate Upload Request"
+// @Success      200   {object}  dtos.InitiateUploadResponse
+// @Security     BearerAuth
+// @Router       /api/v1/documents/{id}/files/presign [post]
+func InitiateDocumentFileUpload(c *gin.Context) {
+	userID := c.GetUint("userID")
+	doc, ok := findDocument(c, userID, services.RoleEditor)
+	if !ok {
 		return
 	}
 
-	fileHeader, err := c.FormFile("file")
+	var input dtos.InitiateUploadRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Uploads count against the owner's quota, whoever makes them
+	if err := services.ValidateUploadSize(doc.UserID, input.Size); err != nil {
+		respondUploadError(c, err, "Failed to check storage quota")
+		return
+	}
+
+	objectKey := services.BuildObjectKey(doc.ID, input.FileName)
+	url, err := services.GetPresignedUploadURL(c.Request.Context(), objectKey, 15*time.Minute)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "File is required"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate upload URL"})
 		return
 	}
 
-	file, err := fileHeader.Open()
+	c.JSON(http.StatusOK, dtos.InitiateUploadResponse{
+		UploadURL: url,
+		ObjectKey: objectKey,
+		ExpiresIn: "15m",
+	})
+}
+
+// @Summary      Complete Direct Upload
+// @Description  Verify a directly uploaded object and attach it to a document
+// @Tags         Documents
+// @Accept       json
+// @Produce      json
+// @Param        id    path  int  true  "Document ID"
+// @Param        body  body  dtos.CompleteUploadRequest  true  "Complete Upload Request"
+// @Success      201   {object}  models.DocumentFile
+// @Security     BearerAuth
+// @Router       /api/v1/documents/{id}/files/complete [post]
+func CompleteDocumentFileUpload(c *gin.Context) {
+	userID := c.GetUint("userID")
+	doc, ok := findDocument(c, userID, services.RoleEditor)
+	if !ok {
+		return
+	}
+
+	var input dtos.CompleteUploadRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Only accept keys issued for this document, and only once
+	if !strings.HasPrefix(input.ObjectKey, services.DocumentObjectPrefix(doc.ID)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Object key does not belong to this document"})
+		return
+	}
+	var count int64
+	database.DB.Model(&models.DocumentFile{}).Where("object_key = ?", input.ObjectKey).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload already completed"})
+		return
+	}
+
+	info, err := services.StatFile(c.Request.Context(), input.ObjectKey)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Uploaded object not found"})
 		return
 	}
-	defer file.Close()
 
-	contentType := fileHeader.Header.Get("Content-Type")
-	if contentType == "" {
-		contentType = "application/octet-stream"
+	// The client uploaded without passing through us, so validate the stored object now
+	contentType, err := validateStoredFile(c, doc.UserID, input.ObjectKey, input.FileName, info.Size)
+	if err != nil {
+		_ = services.DeleteFile(c.Request.Context(), input.ObjectKey)
+		respondUploadError(c, err, "Failed to validate uploaded file")
+		return
 	}
 
-	objectKey := services.BuildObjectKey(uint(docID), fileHeader.Filename)
-	if err := services.UploadFile(c.Request.Context(), objectKey, contentType, file, fileHeader.Size); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload file"})
+	objectKey, contentHash, release, err := services.DedupeStoredObject(c.Request.Context(), input.ObjectKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read uploaded file"})
 		return
 	}
 
 	docFile := models.DocumentFile{
-		DocumentID:  uint(docID),
-		FileName:    fileHeader.Filename,
+		DocumentID:  doc.ID,
+		FileName:    input.FileName,
 		ObjectKey:   objectKey,
 		ContentType: contentType,
-		Size:        fileHeader.Size,
+		Size:        info.Size,
+		Checksum:    info.ETag,
+		ContentHash: contentHash,
 	}
-	if err := database.DB.Create(&docFile).Error; err != nil {
-		// Clean up the uploaded object if DB insert fails
-		_ = services.DeleteFile(c.Request.Context(), objectKey)
+	err = database.DB.Create(&docFile).Error
+	release()
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file record"})
 		return
 	}
@@ -89,37 +181,141 @@ func UploadDocumentFile(c *gin.Context) {
 // @Router       /api/v1/documents/{id}/files/{fileId}/download [get]
 func GetDocumentFileDownloadURL(c *gin.Context) {
 	userID := c.GetUint("userID")
-	docID, err := strconv.Atoi(c.Param("id"))
+	docFile, ok := findDocumentFile(c, userID, services.RoleViewer)
+	if !ok {
+		return
+	}
+
+	url, err := services.GetPresignedURL(c.Request.Context(), docFile.ObjectKey, 15*time.Minute)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate download URL"})
 		return
 	}
-	fileID, err := strconv.Atoi(c.Param("fileId"))
+
+	c.JSON(http.StatusOK, gin.H{"url": url, "expires_in": "15m"})
+}
+
+// @Summary      Download File Content
+// @Description  Stream a document file through the API. Supports Range requests and If-None-Match.
+// @Tags         Documents
+// @Produce      octet-stream
+// @Param        id           path    int     true   "Document ID"
+// @Param        fileId       path    int     true   "File ID"
+// @Param        disposition  query   string  false  "attachment (default) or inline; HTML, SVG and XML are always attachments"
+// @Param        Range        header  string  false  "Byte range, e.g. bytes=0-1023"
+// @Success      200
+// @Success      206
+// @Success      304
+// @Security     BearerAuth
+// @Router       /api/v1/documents/{id}/files/{fileId}/content [get]
+func StreamDocumentFile(c *gin.Context) {
+	userID := c.GetUint("userID")
+	docFile, ok := findDocumentFile(c, userID, services.RoleViewer)
+	if !ok {
+		return
+	}
+
+	etag := docFile.ContentHash
+	if etag == "" {
+		etag = docFile.Checksum
+	}
+	serveObject(c, docFile.ObjectKey, docFile.FileName, docFile.ContentType, etag, docFile.UpdatedAt)
+}
+
+// @Summary      Update File Labels
+// @Description  Replace the tags and metadata of a document file
+// @Tags         Documents
+// @Accept       json
+// @Produce      json
+// @Param        id      path      int                       true  "Document ID"
+// @Param        fileId  path      int                       true  "File ID"
+// @Param        input   body      dtos.UpdateLabelsRequest  true  "Tags and metadata"
+// @Success      200     {object}  models.DocumentFile
+// @Security     BearerAuth
+// @Router       /api/v1/documents/{id}/files/{fileId}/labels [put]
+func UpdateDocumentFileLabels(c *gin.Context) {
+	userID := c.GetUint("userID")
+	docFile, ok := findDocumentFile(c, userID, services.RoleEditor)
+	if !ok {
+		return
+	}
+
+	var input dtos.UpdateLabelsRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tags, metadata, err := services.NormalizeLabels(input.Tags, input.Metadata)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file ID"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	var docFile models.DocumentFile
-	if err := database.DB.
-		Joins("JOIN documents ON documents.id = document_files.document_id").
-		Where("document_files.id = ? AND document_files.document_id = ? AND documents.user_id = ?", fileID, docID, userID).
-		First(&docFile).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+	docFile.Tags = tags
+	docFile.Metadata = metadata
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(docFile).Error; err != nil {
+			return err
+		}
+		return services.SyncLabels(tx, docFile.DocumentID, docFile.ID, tags, metadata)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update file labels"})
 		return
 	}
 
-	url, err := services.GetPresignedURL(c.Request.Context(), docFile.ObjectKey, 15*time.Minute)
+	c.JSON(http.StatusOK, docFile)
+}
+
+// @Summary      Preview File
+// @Description  Render a document file for display: plain text for text formats, sanitized HTML for Markdown, HTML and DOCX, and positioned text lines per page for PDFs
+// @Tags         Documents
+// @Produce      json
+// @Param        id      path  int  true  "Document ID"
+// @Param        fileId  path  int  true  "File ID"
+// @Success      200     {object}  services.Preview
+// @Security     BearerAuth
+// @Router       /api/v1/documents/{id}/files/{fileId}/preview [get]
+func GetDocumentFilePreview(c *gin.Context) {
+	userID := c.GetUint("userID")
+	docFile, ok := findDocumentFile(c, userID, services.RoleViewer)
+	if !ok {
+		return
+	}
+
+	if docFile.Size > services.MaxPreviewBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large to preview"})
+		return
+	}
+
+	reader, err := services.GetFile(c.Request.Context(), docFile.ObjectKey)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate download URL"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
 		return
 	}
+	defer reader.Close()
 
-	c.JSON(http.StatusOK, gin.H{"url": url, "expires_in": "15m"})
+	data, err := io.ReadAll(io.LimitReader(reader, services.MaxPreviewBytes))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	preview, err := services.BuildPreview(data, docFile.ContentType)
+	if errors.Is(err, services.ErrPreviewUnsupported) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Failed to render preview"})
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
 }
 
 // @Summary      Delete Document File
-// @Description  Delete a file from a document
+// @Description  Move a file of a document to the trash. Its content and versions are kept until the trash is purged.
 // @Tags         Documents
 // @Produce      json
 // @Param        id      path  int  true  "Document ID"
@@ -129,37 +325,238 @@ func GetDocumentFileDownloadURL(c *gin.Context) {
 // @Router       /api/v1/documents/{id}/files/{fileId} [delete]
 func DeleteDocumentFile(c *gin.Context) {
 	userID := c.GetUint("userID")
-	docID, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+	docFile, ok := findDocumentFile(c, userID, services.RoleOwner)
+	if !ok {
 		return
 	}
-	fileID, err := strconv.Atoi(c.Param("fileId"))
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(docFile).Error; err != nil {
+			return err
+		}
+		return tx.Where("document_file_id = ?", docFile.ID).Delete(&models.DocumentLabel{}).Error
+	})
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file ID"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete file record"})
 		return
 	}
 
-	var docFile models.DocumentFile
-	if err := database.DB.
-		Joins("JOIN documents ON documents.id = document_files.document_id").
-		Where("document_files.id = ? AND document_files.document_id = ? AND documents.user_id = ?", fileID, docID, userID).
-		First(&docFile).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+	c.JSON(http.StatusOK, gin.H{"message": "File deleted successfully"})
+}
+
+// storeUploadedFile validates the multipart "file" field, stores its content
+// (reusing an existing object when the content is already stored) and returns
+// an unsaved DocumentFile describing it, with the function to call once it is
+// saved, as for services.FindObjectByHash. It writes the error response itself
+// when it fails.
+func storeUploadedFile(c *gin.Context, doc *models.Document) (*models.DocumentFile, func(), bool) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is required"})
+		return nil, nil, false
+	}
+
+	if err := services.ValidateUploadSize(doc.UserID, fileHeader.Size); err != nil {
+		respondUploadError(c, err, "Failed to check storage quota")
+		return nil, nil, false
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return nil, nil, false
+	}
+	defer file.Close()
+
+	// Sniff the real type from the content instead of trusting the client's header
+	head := make([]byte, utils.SniffLength)
+	n, _ := io.ReadFull(file, head)
+	contentType, err := services.ValidateContentType(head[:n], fileHeader.Filename)
+	if err != nil {
+		respondUploadError(c, err, "Failed to read file")
+		return nil, nil, false
+	}
+
+	// Hash the local copy of the upload first so duplicate content never reaches storage
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return nil, nil, false
+	}
+	contentHash, err := services.HashContent(file)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return nil, nil, false
+	}
+
+	objectKey, release, exists := services.FindObjectByHash(c.Request.Context(), contentHash)
+	if !exists {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+			return nil, nil, false
+		}
+		objectKey = services.BuildObjectKey(doc.ID, fileHeader.Filename)
+		if err := services.UploadFile(c.Request.Context(), objectKey, contentType, file, fileHeader.Size); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload file"})
+			return nil, nil, false
+		}
+	}
+
+	return &models.DocumentFile{
+		DocumentID:  doc.ID,
+		FileName:    fileHeader.Filename,
+		ObjectKey:   objectKey,
+		ContentType: contentType,
+		Size:        fileHeader.Size,
+		ContentHash: contentHash,
+	}, release, true
+}
+
+// inlineSafe reports whether a browser can display contentType inline without
+// running scripts from it. HTML, SVG and other XML documents can embed them.
+func inlineSafe(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "text/html", "text/xml", "application/xml", "text/javascript", "application/javascript":
+		return false
+	}
+	return !strings.HasSuffix(mediaType, "+xml")
+}
+
+// serveObject streams a stored object with the given download name, falling
+// back to the stored metadata for empty arguments. When the
+// backend's reader can seek, Range, If-None-Match and If-Modified-Since are
+// handled by http.ServeContent.
+func serveObject(c *gin.Context, objectKey, fileName, contentType, etag string, modTime time.Time) {
+	info, err := services.StatFile(c.Request.Context(), objectKey)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File content not found"})
+		return
+	}
+	reader, err := services.GetFile(c.Request.Context(), objectKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
 		return
 	}
+	defer reader.Close()
 
-	_ = deleteDocumentFileFromStorage(c.Request.Context(), docFile.ObjectKey)
+	if contentType == "" {
+		contentType = info.ContentType
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	if etag == "" {
+		etag = info.ETag
+	}
+	if modTime.IsZero() {
+		modTime = info.LastModified
+	}
+	disposition := "attachment"
+	if c.Query("disposition") == "inline" && inlineSafe(contentType) {
+		disposition = "inline"
+	}
 
-	if err := database.DB.Delete(&docFile).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete file record"})
+	// Stored files come from users and are served from the API origin, so
+	// browsers must neither sniff them into something executable nor run
+	// scripts in them
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": fileName}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "sandbox")
+	c.Header("Cache-Control", "private, no-cache")
+	if etag != "" {
+		c.Header("ETag", `"`+strings.Trim(etag, `"`)+`"`)
+	}
+
+	if rs, ok := reader.(io.ReadSeeker); ok {
+		http.ServeContent(c.Writer, c.Request, fileName, modTime, rs)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "File deleted successfully"})
+	// Without seeking we can still honour conditional requests, just not ranges
+	if match := c.GetHeader("If-None-Match"); match != "" && match == c.Writer.Header().Get("ETag") {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.DataFromReader(http.StatusOK, info.Size, contentType, reader, nil)
+}
+
+// validateStoredFile applies the upload size and type rules to an object that
+// is already in storage and returns its sniffed content type.
+func validateStoredFile(c *gin.Context, ownerID uint, objectKey, fileName string, size int64) (string, error) {
+	if err := services.ValidateUploadSize(ownerID, size); err != nil {
+		return "", err
+	}
+
+	obj, err := services.GetFile(c.Request.Context(), objectKey)
+	if err != nil {
+		return "", err
+	}
+	defer obj.Close()
+
+	head := make([]byte, utils.SniffLength)
+	n, err := io.ReadFull(obj, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return services.ValidateContentType(head[:n], fileName)
+}
+
+// respondUploadError writes a 4xx response for upload validation failures and
+// a 500 with the fallback message for anything else.
+func respondUploadError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrFileTooLarge), errors.Is(err, services.ErrStorageQuotaReached):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUnsupportedFileType):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// findDocumentFile loads the file named in the path and checks that userID
+// holds at least role on its document. It writes the error response itself
+// when it fails.
+func findDocumentFile(c *gin.Context, userID uint, role string) (*models.DocumentFile, bool) {
+	_, docFile, ok := authorizeDocumentFile(c, userID, role)
+	return docFile, ok
+}
+
+// authorizeDocumentFile is findDocumentFile for handlers that also need the
+// document.
+func authorizeDocumentFile(c *gin.Context, userID uint, role string) (*models.Document, *models.DocumentFile, bool) {
+	docID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+		return nil, nil, false
+	}
+	fileID, err := strconv.Atoi(c.Param("fileId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file ID"})
+		return nil, nil, false
+	}
+
+	doc, ok := authorizeDocument(c, userID, docID, role, "File not found")
+	if !ok {
+		return nil, nil, false
+	}
+
+	var docFile models.DocumentFile
+	if err := database.DB.Where("id = ? AND document_id = ?", fileID, doc.ID).First(&docFile).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return nil, nil, false
+	}
+
+	return doc, &docFile, true
 }
 
 // deleteDocumentFileFromStorage is a shared helper used by document and file controllers.
+// Objects are shared between files with identical content, so it only removes
+// the object once the last referencing row is gone.
 func deleteDocumentFileFromStorage(ctx context.Context, objectKey string) error {
-	return services.DeleteFile(ctx, objectKey)
+	return services.ReleaseObject(ctx, objectKey)
 }
@@ -0,0 +1,527 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"hsduc.com/rag/config"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/dtos"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+)
+
+func TestCompleteDocumentFileUpload(t *testing.T) {
+	tests := []struct {
+		name           string
+		setup          func() (string, []byte)
+		expectedStatus int
+		checkResponse  func(t *testing.T, w *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Error - Object key of another document",
+			setup: func() (string, []byte) {
+				doc := models.Document{Title: "Manual", UserID: 1}
+				database.DB.Create(&doc)
+				payload := dtos.CompleteUploadRequest{ObjectKey: "documents/999/1_manual.pdf", FileName: "manual.pdf"}
+				body, _ := json.Marshal(payload)
+				return fmt.Sprintf("/documents/%d/files/complete", doc.ID), body
+			},
+			expectedStatus: http.StatusBadRequest,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var response map[string]string
+				json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Equal(t, "Object key does not belong to this document", response["error"])
+			},
+		},
+		{
+			name: "Error - Upload already completed",
+			setup: func() (string, []byte) {
+				doc := models.Document{Title: "Manual", UserID: 1}
+				database.DB.Create(&doc)
+				key := fmt.Sprintf("documents/%d/1_manual.pdf", doc.ID)
+				database.DB.Create(&models.DocumentFile{DocumentID: doc.ID, FileName: "manual.pdf", ObjectKey: key})
+				payload := dtos.CompleteUploadRequest{ObjectKey: key, FileName: "manual.pdf"}
+				body, _ := json.Marshal(payload)
+				return fmt.Sprintf("/documents/%d/files/complete", doc.ID), body
+			},
+			expectedStatus: http.StatusConflict,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var response map[string]string
+				json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Equal(t, "Upload already completed", response["error"])
+			},
+		},
+		{
+			name: "Error - Document belongs to another user",
+			setup: func() (string, []byte) {
+				doc := models.Document{Title: "Manual", UserID: 99}
+				database.DB.Create(&doc)
+				payload := dtos.CompleteUploadRequest{ObjectKey: fmt.Sprintf("documents/%d/1_manual.pdf", doc.ID), FileName: "manual.pdf"}
+				body, _ := json.Marshal(payload)
+				return fmt.Sprintf("/documents/%d/files/complete", doc.ID), body
+			},
+			expectedStatus: http.StatusNotFound,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var response map[string]string
+				json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Equal(t, "Document not found", response["error"])
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetupTestDB()
+			r := GetTestRouter()
+			r.POST("/documents/:id/files/complete", CompleteDocumentFileUpload)
+
+			path, payload := tt.setup()
+			req, _ := http.NewRequest("POST", path, bytes.NewBuffer(payload))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			tt.checkResponse(t, w)
+		})
+	}
+}
+
+func TestUploadDocumentFileValidation(t *testing.T) {
+	config.App = &config.Config{
+		MaxUploadSizeMB:  1,
+		MaxUserStorageMB: 2,
+		AllowedFileTypes: []string{"application/pdf", "text/plain"},
+	}
+
+	tests := []struct {
+		name           string
+		setup          func(docID uint)
+		fileName       string
+		content        []byte
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "Error - File exceeds per-file limit",
+			setup:          func(docID uint) {},
+			fileName:       "big.txt",
+			content:        bytes.Repeat([]byte("a"), 1024*1024+1),
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedError:  "File exceeds the maximum size of 1 MB",
+		},
+		{
+			name: "Error - User storage quota exceeded",
+			setup: func(docID uint) {
+				database.DB.Create(&models.DocumentFile{DocumentID: docID, FileName: "old.pdf", ObjectKey: "documents/old.pdf", Size: 2 * 1024 * 1024})
+			},
+			fileName:       "notes.txt",
+			content:        []byte("hello"),
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedError:  "Storage quota of 2 MB exceeded",
+		},
+		{
+			name:           "Error - Executable disguised as PDF",
+			setup:          func(docID uint) {},
+			fileName:       "manual.pdf",
+			content:        []byte("\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00"),
+			expectedStatus: http.StatusUnsupportedMediaType,
+			expectedError:  "File type application/octet-stream is not allowed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetupTestDB()
+			doc := models.Document{Title: "Manual", UserID: 1}
+			database.DB.Create(&doc)
+			tt.setup(doc.ID)
+
+			r := GetTestRouter()
+			r.POST("/documents/:id/files", UploadDocumentFile)
+
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			part, _ := writer.CreateFormFile("file", tt.fileName)
+			part.Write(tt.content)
+			writer.Close()
+
+			req, _ := http.NewRequest("POST", fmt.Sprintf("/documents/%d/files", doc.ID), body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			var response map[string]string
+			json.Unmarshal(w.Body.Bytes(), &response)
+			assert.Equal(t, tt.expectedError, response["error"])
+		})
+	}
+}
+
+func TestUploadDocumentFileDeduplicates(t *testing.T) {
+	config.App = &config.Config{
+		MaxUploadSizeMB:  10,
+		MaxUserStorageMB: 100,
+		AllowedFileTypes: []string{"text/plain"},
+	}
+	SetupTestDB()
+
+	content := []byte("the same policy text")
+	hash, _ := services.HashContent(bytes.NewReader(content))
+	other := models.Document{Title: "Other", UserID: 1}
+	database.DB.Create(&other)
+	database.DB.Create(&models.DocumentFile{DocumentID: other.ID, FileName: "policy.txt", ObjectKey: "documents/1/1_policy.txt", ContentHash: hash, Size: int64(len(content))})
+
+	doc := models.Document{Title: "Manual", UserID: 1}
+	database.DB.Create(&doc)
+
+	r := GetTestRouter()
+	r.POST("/documents/:id/files", UploadDocumentFile)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", "copy.txt")
+	part.Write(content)
+	writer.Close()
+
+	// No storage client is configured, so this only succeeds if the upload is skipped
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/documents/%d/files", doc.ID), body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var docFile models.DocumentFile
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &docFile))
+	assert.Equal(t, "documents/1/1_policy.txt", docFile.ObjectKey)
+	assert.Equal(t, hash, docFile.ContentHash)
+	assert.Equal(t, "copy.txt", docFile.FileName)
+}
+
+func TestDeleteDocumentFileKeepsSharedObject(t *testing.T) {
+	SetupTestDB()
+
+	doc := models.Document{Title: "Manual", UserID: 1}
+	database.DB.Create(&doc)
+	first := models.DocumentFile{DocumentID: doc.ID, FileName: "a.txt", ObjectKey: "documents/1/1_a.txt", ContentHash: "abc"}
+	second := models.DocumentFile{DocumentID: doc.ID, FileName: "b.txt", ObjectKey: "documents/1/1_a.txt", ContentHash: "abc"}
+	database.DB.Create(&first)
+	database.DB.Create(&second)
+
+	r := GetTestRouter()
+	r.DELETE("/documents/:id/files/:fileId", DeleteDocumentFile)
+
+	// No storage client is configured, so this only succeeds if the shared object is kept
+	req, _ := http.NewRequest("DELETE", fmt.Sprintf("/documents/%d/files/%d", doc.ID, first.ID), nil)
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var remaining int64
+	database.DB.Model(&models.DocumentFile{}).Where("object_key = ?", "documents/1/1_a.txt").Count(&remaining)
+	assert.Equal(t, int64(1), remaining)
+}
+
+func TestCompleteDocumentFileUploadDeduplicates(t *testing.T) {
+	config.App = &config.Config{
+		MaxUploadSizeMB:  10,
+		MaxUserStorageMB: 100,
+		AllowedFileTypes: []string{"text/plain"},
+	}
+	SetupTestDB()
+	store := SetupTestStorage(t)
+
+	doc := models.Document{Title: "Manual", UserID: 1}
+	database.DB.Create(&doc)
+	put := func(key string, content []byte) {
+		store.Put(t.Context(), key, "text/plain", bytes.NewReader(content), int64(len(content)))
+	}
+	content := []byte("the same policy text")
+	hash, _ := services.HashContent(bytes.NewReader(content))
+	existing := fmt.Sprintf("documents/%d/1_policy.txt", doc.ID)
+	put(existing, content)
+	database.DB.Create(&models.DocumentFile{DocumentID: doc.ID, FileName: "policy.txt", ObjectKey: existing, ContentHash: hash})
+
+	r := GetTestRouter()
+	r.POST("/documents/:id/files/complete", CompleteDocumentFileUpload)
+	complete := func(key string) models.DocumentFile {
+		body, _ := json.Marshal(dtos.CompleteUploadRequest{ObjectKey: key, FileName: "copy.txt"})
+		req, _ := http.NewRequest("POST", fmt.Sprintf("/documents/%d/files/complete", doc.ID), bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var docFile models.DocumentFile
+		json.Unmarshal(w.Body.Bytes(), &docFile)
+		return docFile
+	}
+
+	duplicate := fmt.Sprintf("documents/%d/2_copy.txt", doc.ID)
+	put(duplicate, content)
+	docFile := complete(duplicate)
+	assert.Equal(t, existing, docFile.ObjectKey)
+	assert.Equal(t, hash, docFile.ContentHash)
+	_, err := services.StatFile(t.Context(), duplicate)
+	assert.Error(t, err, "the duplicate object is deleted")
+
+	unique := fmt.Sprintf("documents/%d/3_copy.txt", doc.ID)
+	put(unique, []byte("different text"))
+	docFile = complete(unique)
+	assert.Equal(t, unique, docFile.ObjectKey)
+	assert.NotEmpty(t, docFile.ContentHash)
+}
+
+func TestReleaseObjectWaitsForDeduplicatedUpload(t *testing.T) {
+	SetupTestDB()
+	store := SetupTestStorage(t)
+
+	content := []byte("shared")
+	hash, _ := services.HashContent(bytes.NewReader(content))
+	key := "documents/1/1_shared.txt"
+	store.Put(t.Context(), key, "text/plain", bytes.NewReader(content), int64(len(content)))
+	purged := models.DocumentFile{DocumentID: 1, FileName: "shared.txt", ObjectKey: key, ContentHash: hash}
+	database.DB.Create(&purged)
+
+	found, release, ok := services.FindObjectByHash(t.Context(), hash)
+	assert.True(t, ok)
+	assert.Equal(t, key, found)
+
+	// The purge removes the only row while the upload is between finding the object and saving its own row
+	database.DB.Unscoped().Delete(&purged)
+	released := make(chan error)
+	go func() { released <- services.ReleaseObject(context.Background(), key) }()
+	select {
+	case <-released:
+		t.Fatal("the object was released while an upload was sharing it")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	database.DB.Create(&models.DocumentFile{DocumentID: 1, FileName: "copy.txt", ObjectKey: key, ContentHash: hash})
+	release()
+	assert.NoError(t, <-released)
+	_, err := services.StatFile(t.Context(), key)
+	assert.NoError(t, err, "the object is kept for the new row")
+}
+
+func TestUploadDocumentFile(t *testing.T) {
+	config.App = &config.Config{
+		MaxUploadSizeMB:  10,
+		MaxUserStorageMB: 100,
+		AllowedFileTypes: []string{"text/markdown"},
+	}
+	SetupTestDB()
+	store := SetupTestStorage(t)
+
+	doc := models.Document{Title: "Handbook", UserID: 1}
+	database.DB.Create(&doc)
+
+	r := GetTestRouter()
+	r.POST("/documents/:id/files", UploadDocumentFile)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", "handbook.md")
+	part.Write([]byte("# Handbook\n\nWelcome aboard."))
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/documents/%d/files", doc.ID), body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var docFile models.DocumentFile
+	json.Unmarshal(w.Body.Bytes(), &docFile)
+	assert.Equal(t, "handbook.md", docFile.FileName)
+	assert.Equal(t, "text/markdown", docFile.ContentType)
+	assert.NotEmpty(t, docFile.ContentHash)
+
+	info, err := store.Stat(context.Background(), docFile.ObjectKey)
+	assert.NoError(t, err)
+	assert.Equal(t, docFile.Size, info.Size)
+}
+
+func TestStreamDocumentFile(t *testing.T) {
+	SetupTestDB()
+	store := SetupTestStorage(t)
+
+	content := []byte("0123456789abcdefghij")
+	store.Put(context.Background(), "documents/1/1_report.txt", "text/plain", bytes.NewReader(content), int64(len(content)))
+	doc := models.Document{Title: "Reports", UserID: 1}
+	database.DB.Create(&doc)
+	docFile := models.DocumentFile{DocumentID: doc.ID, FileName: "Báo cáo.txt", ObjectKey: "documents/1/1_report.txt", ContentType: "text/plain", Size: int64(len(content)), ContentHash: "abc123"}
+	database.DB.Create(&docFile)
+	foreign := models.Document{Title: "Secret", UserID: 99}
+	database.DB.Create(&foreign)
+	foreignFile := models.DocumentFile{DocumentID: foreign.ID, FileName: "secret.txt", ObjectKey: "documents/1/1_report.txt"}
+	database.DB.Create(&foreignFile)
+	page := []byte("<script>alert(document.cookie)</script>")
+	store.Put(context.Background(), "documents/1/2_page.html", "text/html", bytes.NewReader(page), int64(len(page)))
+	pageFile := models.DocumentFile{DocumentID: doc.ID, FileName: "page.html", ObjectKey: "documents/1/2_page.html", ContentType: "text/html; charset=utf-8", Size: int64(len(page))}
+	database.DB.Create(&pageFile)
+
+	tests := []struct {
+		name           string
+		path           string
+		headers        map[string]string
+		expectedStatus int
+		checkResponse  func(t *testing.T, w *httptest.ResponseRecorder)
+	}{
+		{
+			name:           "Success - Full content",
+			path:           fmt.Sprintf("/documents/%d/files/%d/content", doc.ID, docFile.ID),
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, content, w.Body.Bytes())
+				assert.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+				assert.Equal(t, `"abc123"`, w.Header().Get("ETag"))
+				assert.Equal(t, "attachment; filename*=utf-8''B%C3%A1o%20c%C3%A1o.txt", w.Header().Get("Content-Disposition"))
+				assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+				assert.Equal(t, "sandbox", w.Header().Get("Content-Security-Policy"))
+			},
+		},
+		{
+			name:           "Success - Inline",
+			path:           fmt.Sprintf("/documents/%d/files/%d/content?disposition=inline", doc.ID, docFile.ID),
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.True(t, strings.HasPrefix(w.Header().Get("Content-Disposition"), "inline;"))
+			},
+		},
+		{
+			name:           "Success - HTML is never inline",
+			path:           fmt.Sprintf("/documents/%d/files/%d/content?disposition=inline", doc.ID, pageFile.ID),
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, "attachment; filename=page.html", w.Header().Get("Content-Disposition"))
+				assert.Equal(t, "sandbox", w.Header().Get("Content-Security-Policy"))
+			},
+		},
+		{
+			name:           "Success - Byte range",
+			path:           fmt.Sprintf("/documents/%d/files/%d/content", doc.ID, docFile.ID),
+			headers:        map[string]string{"Range": "bytes=10-14"},
+			expectedStatus: http.StatusPartialContent,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Equal(t, "abcde", w.Body.String())
+				assert.Equal(t, "bytes 10-14/20", w.Header().Get("Content-Range"))
+			},
+		},
+		{
+			name:           "Success - Not modified",
+			path:           fmt.Sprintf("/documents/%d/files/%d/content", doc.ID, docFile.ID),
+			headers:        map[string]string{"If-None-Match": `"abc123"`},
+			expectedStatus: http.StatusNotModified,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				assert.Empty(t, w.Body.Bytes())
+			},
+		},
+		{
+			name:           "Error - File of another user",
+			path:           fmt.Sprintf("/documents/%d/files/%d/content", foreign.ID, foreignFile.ID),
+			expectedStatus: http.StatusNotFound,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var response map[string]string
+				json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Equal(t, "File not found", response["error"])
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := GetTestRouter()
+			r.GET("/documents/:id/files/:fileId/content", StreamDocumentFile)
+
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			tt.checkResponse(t, w)
+		})
+	}
+}
+
+func TestGetDocumentFilePreview(t *testing.T) {
+	SetupTestDB()
+	store := SetupTestStorage(t)
+
+	markdown := []byte("# Onboarding\n\n<script>alert(1)</script>")
+	store.Put(context.Background(), "documents/1/1_guide.md", "text/markdown", bytes.NewReader(markdown), int64(len(markdown)))
+	doc := models.Document{Title: "Guides", UserID: 1}
+	database.DB.Create(&doc)
+	guide := models.DocumentFile{DocumentID: doc.ID, FileName: "guide.md", ObjectKey: "documents/1/1_guide.md", ContentType: "text/markdown", Size: int64(len(markdown))}
+	database.DB.Create(&guide)
+	image := models.DocumentFile{DocumentID: doc.ID, FileName: "logo.png", ObjectKey: "documents/1/1_guide.md", ContentType: "image/png", Size: int64(len(markdown))}
+	database.DB.Create(&image)
+	huge := models.DocumentFile{DocumentID: doc.ID, FileName: "scan.pdf", ObjectKey: "documents/1/2_scan.pdf", ContentType: "application/pdf", Size: services.MaxPreviewBytes + 1}
+	database.DB.Create(&huge)
+
+	tests := []struct {
+		name           string
+		fileID         uint
+		expectedStatus int
+		checkResponse  func(t *testing.T, w *httptest.ResponseRecorder)
+	}{
+		{
+			name:           "Success - Markdown rendered as sanitized HTML",
+			fileID:         guide.ID,
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
+				var preview services.Preview
+				json.Unmarshal(w.Body.Bytes(), &preview)
+				assert.Equal(t, "html", preview.Kind)
+				assert.Contains(t, preview.HTML, "<h1>Onboarding</h1>")
+				assert.NotContains(t, preview.HTML, "script")
+			},
+		},
+		{
+			name:           "Error - Unsupported type",
+			fileID:         image.ID,
+			expectedStatus: http.StatusUnsupportedMediaType,
+			checkResponse:  func(t *testing.T, w *httptest.ResponseRecorder) {},
+		},
+		{
+			name:           "Error - Too large",
+			fileID:         huge.ID,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			checkResponse:  func(t *testing.T, w *httptest.ResponseRecorder) {},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := GetTestRouter()
+			r.GET("/documents/:id/files/:fileId/preview", GetDocumentFilePreview)
+
+			req, _ := http.NewRequest("GET", fmt.Sprintf("/documents/%d/files/%d/preview", doc.ID, tt.fileID), nil)
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			tt.checkResponse(t, w)
+		})
+	}
+}
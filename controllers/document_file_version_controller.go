@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+)
+
+// @Summary      Upload New File Version
+// @Description  Replace a document file with new content, keeping the previous content as an older version
+// @Tags         Documents
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        id      path      int   true  "Document ID"
+// @Param        fileId  path      int   true  "File ID"
+// @Param        file    formData  file  true  "New version of the file"
+// @Success      200     {object}  models.DocumentFile
+// @Security     BearerAuth
+// @Router       /api/v1/documents/{id}/files/{fileId} [put]
+func ReplaceDocumentFile(c *gin.Context) {
+	userID := c.GetUint("userID")
+	doc, docFile, ok := authorizeDocumentFile(c, userID, services.RoleEditor)
+	if !ok {
+		return
+	}
+
+	upload, release, ok := storeUploadedFile(c, doc)
+	if !ok {
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return services.AdvanceFileVersion(tx, docFile, upload)
+	})
+	release()
+	if err != nil {
+		_ = deleteDocumentFileFromStorage(c.Request.Context(), upload.ObjectKey)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file version"})
+		return
+	}
+
+	c.JSON(http.StatusOK, docFile)
+}
+
+// @Summary      Get File Versions
+// @Description  List the version history of a document file, newest first
+// @Tags         Documents
+// @Produce      json
+// @Param        id      path  int  true  "Document ID"
+// @Param        fileId  path  int  true  "File ID"
+// @Success      200     {array}  models.DocumentFileVersion
+// @Security     BearerAuth
+// @Router       /api/v1/documents/{id}/files/{fileId}/versions [get]
+func GetDocumentFileVersions(c *gin.Context) {
+	userID := c.GetUint("userID")
+	docFile, ok := findDocumentFile(c, userID, services.RoleViewer)
+	if !ok {
+		return
+	}
+
+	var versions []models.DocumentFileVersion
+	if err := database.DB.Where("document_file_id = ?", docFile.ID).Order("version desc").Find(&versions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve file versions"})
+		return
+	}
+
+	// The current version lives on the file itself
+	c.JSON(http.StatusOK, append([]models.DocumentFileVersion{services.CurrentFileVersion(docFile)}, versions...))
+}
+
+// @Summary      Get File Version Download URL
+// @Description  Get a presigned download URL for a specific version of a document file (valid 15 minutes)
+// @Tags         Documents
+// @Produce      json
+// @Param        id       path  int  true  "Document ID"
+// @Param        fileId   path  int  true  "File ID"
+// @Param        version  path  int  true  "Version number"
+// @Success      200      {object}  map[string]string
+// @Security     BearerAuth
+// @Router       /api/v1/documents/{id}/files/{fileId}/versions/{version}/download [get]
+func GetDocumentFileVersionDownloadURL(c *gin.Context) {
+	userID := c.GetUint("userID")
+	docFile, ok := findDocumentFile(c, userID, services.RoleViewer)
+	if !ok {
+		return
+	}
+
+	version, ok := findDocumentFileVersion(c, docFile)
+	if !ok {
+		return
+	}
+
+	url, err := services.GetPresignedURL(c.Request.Context(), version.ObjectKey, 15*time.Minute)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate download URL"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"url": url, "expires_in": "15m", "version": version.Version})
+}
+
+// @Summary      Restore File Version
+// @Description  Make an older version the current content of a document file. The restore is recorded as a new version.
+// @Tags         Documents
+// @Produce      json
+// @Param        id       path  int  true  "Document ID"
+// @Param        fileId   path  int  true  "File ID"
+// @Param        version  path  int  true  "Version number"
+// @Success      200      {object}  models.DocumentFile
+// @Security     BearerAuth
+// @Router       /api/v1/documents/{id}/files/{fileId}/versions/{version}/restore [post]
+func RestoreDocumentFileVersion(c *gin.Context) {
+	userID := c.GetUint("userID")
+	docFile, ok := findDocumentFile(c, userID, services.RoleEditor)
+	if !ok {
+		return
+	}
+
+	version, ok := findDocumentFileVersion(c, docFile)
+	if !ok {
+		return
+	}
+	if version.Version == docFile.Version {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Version is already current"})
+		return
+	}
+
+	restored := &models.DocumentFile{
+		FileName:    version.FileName,
+		ObjectKey:   version.ObjectKey,
+		ContentType: version.ContentType,
+		Size:        version.Size,
+		ContentHash: version.ContentHash,
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return services.AdvanceFileVersion(tx, docFile, restored)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore file version"})
+		return
+	}
+
+	c.JSON(http.StatusOK, docFile)
+}
+
+// findDocumentFileVersion loads the version named in the path, which may be
+// the current one. It writes the error response itself when it fails.
+func findDocumentFileVersion(c *gin.Context, docFile *models.DocumentFile) (*models.DocumentFileVersion, bool) {
+	number, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return nil, false
+	}
+
+	if number == docFile.Version {
+		current := services.CurrentFileVersion(docFile)
+		return &current, true
+	}
+
+	var version models.DocumentFileVersion
+	if err := database.DB.Where("document_file_id = ? AND version = ?", docFile.ID, number).First(&version).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+		return nil, false
+	}
+
+	return &version, true
+}
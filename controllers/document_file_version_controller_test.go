@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"hsduc.com/rag/config"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+)
+
+func TestDocumentFileVersioning(t *testing.T) {
+	config.App = &config.Config{
+		MaxUploadSizeMB:  10,
+		MaxUserStorageMB: 100,
+		AllowedFileTypes: []string{"text/plain"},
+	}
+	SetupTestDB()
+
+	r := GetTestRouter()
+	r.PUT("/documents/:id/files/:fileId", ReplaceDocumentFile)
+	r.GET("/documents/:id/files/:fileId/versions", GetDocumentFileVersions)
+	r.POST("/documents/:id/files/:fileId/versions/:version/restore", RestoreDocumentFileVersion)
+
+	doc := models.Document{Title: "Policies", UserID: 1}
+	database.DB.Create(&doc)
+	docFile := models.DocumentFile{DocumentID: doc.ID, FileName: "policy.txt", ObjectKey: "documents/1/1_policy.txt", ContentHash: "v1hash", Version: 1}
+	database.DB.Create(&docFile)
+
+	// The new content already exists in storage, so the upload is deduplicated and needs no storage client
+	newContent := []byte("policy as of next month")
+	newHash, _ := services.HashContent(bytes.NewReader(newContent))
+	database.DB.Create(&models.DocumentFile{DocumentID: doc.ID, FileName: "draft.txt", ObjectKey: "documents/1/2_draft.txt", ContentHash: newHash, Version: 1})
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", "policy-v2.txt")
+	part.Write(newContent)
+	writer.Close()
+
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/documents/%d/files/%d", doc.ID, docFile.ID), body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var replaced models.DocumentFile
+	json.Unmarshal(w.Body.Bytes(), &replaced)
+	assert.Equal(t, 2, replaced.Version)
+	assert.Equal(t, "policy-v2.txt", replaced.FileName)
+	assert.Equal(t, "documents/1/2_draft.txt", replaced.ObjectKey)
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/documents/%d/files/%d/versions", doc.ID, docFile.ID), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var versions []models.DocumentFileVersion
+	json.Unmarshal(w.Body.Bytes(), &versions)
+	assert.Len(t, versions, 2)
+	assert.Equal(t, 2, versions[0].Version)
+	assert.Equal(t, 1, versions[1].Version)
+	assert.Equal(t, "documents/1/1_policy.txt", versions[1].ObjectKey)
+
+	req, _ = http.NewRequest("POST", fmt.Sprintf("/documents/%d/files/%d/versions/1/restore", doc.ID, docFile.ID), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var restored models.DocumentFile
+	json.Unmarshal(w.Body.Bytes(), &restored)
+	assert.Equal(t, 3, restored.Version)
+	assert.Equal(t, "policy.txt", restored.FileName)
+	assert.Equal(t, "documents/1/1_policy.txt", restored.ObjectKey)
+
+	req, _ = http.NewRequest("POST", fmt.Sprintf("/documents/%d/files/%d/versions/3/restore", doc.ID, docFile.ID), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"hsduc.com/rag/config"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/dtos"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+	"hsduc.com/rag/utils"
+)
+
+// @Summary      Import Archive into Document
+// @Description  Unpack a ZIP or tar.gz archive and attach every supported file to the document, keeping its folder path. Unsupported or oversized entries are skipped and listed in the response.
+// @Tags         Documents
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        id    path      int   true  "Document ID"
+// @Param        file  formData  file  true  "ZIP or tar.gz archive"
+// @Success      201   {object}  map[string]interface{}
+// @Security     BearerAuth
+// @Router       /api/v1/documents/{id}/import [post]
+func ImportDocumentFiles(c *gin.Context) {
+	userID := c.GetUint("userID")
+	doc, ok := findDocument(c, userID, services.RoleEditor)
+	if !ok {
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is required"})
+		return
+	}
+	if err := services.ValidateFileSize(fileHeader.Size); err != nil {
+		respondUploadError(c, err, "Failed to read archive")
+		return
+	}
+
+	archive, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read archive"})
+		return
+	}
+	defer archive.Close()
+
+	imp := &archiveImport{
+		ctx:     c.Request.Context(),
+		ownerID: doc.UserID,
+		docID:   doc.ID,
+		files:   []models.DocumentFile{},
+		skipped: []dtos.SkippedImportEntry{},
+		stored:  map[string]string{},
+	}
+	limits := services.ArchiveLimits{
+		MaxEntries:   config.App.MaxImportEntries,
+		MaxTotalSize: config.App.MaxUserStorageMB * 1024 * 1024,
+	}
+	// Rollback only deletes objects this import uploaded, never the shared ones
+	defer imp.release()
+	if err := services.WalkArchive(archive, fileHeader.Size, limits, imp.add); err != nil {
+		imp.rollback()
+		switch {
+		case errors.Is(err, services.ErrUnsupportedArchive), errors.Is(err, services.ErrUnsafeArchivePath):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrArchiveTooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		default:
+			respondUploadError(c, err, "Failed to import archive")
+		}
+		return
+	}
+
+	if len(imp.files) > 0 {
+		if err := database.DB.Create(&imp.files).Error; err != nil {
+			imp.rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file records"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"files": imp.files, "skipped": imp.skipped})
+}
+
+// archiveImport collects the files of one archive import. Rows are only
+// created once the whole archive has been read, so a rejected archive leaves
+// nothing behind.
+type archiveImport struct {
+	ctx      context.Context
+	ownerID  uint
+	docID    uint
+	files    []models.DocumentFile
+	skipped  []dtos.SkippedImportEntry
+	pending  int64             // bytes of files not yet saved, for the quota check
+	stored   map[string]string // content hash to object key, for duplicates within the archive
+	created  []string          // objects uploaded by this import
+	releases []func()          // locks on the existing objects the files share
+}
+
+// add stores one archive entry. Entries that fail validation are recorded as
+// skipped; only errors that should abort the whole import are returned.
+func (imp *archiveImport) add(entry services.ArchiveEntry, content io.Reader) error {
+	dir, name := path.Split(entry.Path)
+	dir = strings.TrimSuffix(dir, "/")
+
+	if err := services.ValidateFileSize(entry.Size); err != nil {
+		imp.skip(entry.Path, err)
+		return nil
+	}
+
+	// Spool the entry to disk to hash it, since the declared size can't be trusted
+	tmp, err := os.CreateTemp("", "import-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	// Read one byte past the limit so an oversized entry is detected without reading all of it
+	if maxFile := config.App.MaxUploadSizeMB * 1024 * 1024; maxFile > 0 {
+		content = io.LimitReader(content, maxFile+1)
+	}
+	size, err := io.Copy(tmp, content)
+	if err != nil {
+		return err
+	}
+	if err := services.ValidateFileSize(size); err != nil {
+		imp.skip(entry.Path, err)
+		return nil
+	}
+	if err := services.ValidateStorageQuota(imp.ownerID, imp.pending+size); err != nil {
+		return err
+	}
+
+	head := make([]byte, utils.SniffLength)
+	n, _ := tmp.ReadAt(head, 0)
+	contentType, err := services.ValidateContentType(head[:n], name)
+	if err != nil {
+		imp.skip(entry.Path, err)
+		return nil
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	contentHash, err := services.HashContent(tmp)
+	if err != nil {
+		return err
+	}
+
+	objectKey, exists := imp.stored[contentHash]
+	if !exists {
+		var release func()
+		objectKey, release, exists = services.FindObjectByHash(imp.ctx, contentHash)
+		imp.releases = append(imp.releases, release)
+	}
+	if !exists {
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		objectKey = services.BuildObjectKey(imp.docID, name)
+		if err := services.UploadFile(imp.ctx, objectKey, contentType, tmp, size); err != nil {
+			return err
+		}
+		imp.created = append(imp.created, objectKey)
+	}
+	imp.stored[contentHash] = objectKey
+
+	imp.files = append(imp.files, models.DocumentFile{
+		DocumentID:  imp.docID,
+		FileName:    name,
+		Path:        dir,
+		ObjectKey:   objectKey,
+		ContentType: contentType,
+		Size:        size,
+		ContentHash: contentHash,
+	})
+	imp.pending += size
+	return nil
+}
+
+func (imp *archiveImport) skip(entryPath string, err error) {
+	imp.skipped = append(imp.skipped, dtos.SkippedImportEntry{Path: entryPath, Reason: err.Error()})
+}
+
+// release unlocks the existing objects the files share, once their rows are
+// saved or the import failed.
+func (imp *archiveImport) release() {
+	for _, release := range imp.releases {
+		release()
+	}
+}
+
+// rollback removes the objects uploaded by an import that did not complete.
+func (imp *archiveImport) rollback() {
+	for _, key := range imp.created {
+		_ = deleteDocumentFileFromStorage(imp.ctx, key)
+	}
+}
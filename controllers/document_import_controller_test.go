@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"hsduc.com/rag/config"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/dtos"
+	"hsduc.com/rag/models"
+)
+
+func buildImportRequest(t *testing.T, docID uint, entries map[string][]byte) *http.Request {
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	for name, content := range entries {
+		w, err := zw.Create(name)
+		assert.NoError(t, err)
+		w.Write(content)
+	}
+	assert.NoError(t, zw.Close())
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", "wiki-export.zip")
+	part.Write(archive.Bytes())
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/documents/%d/import", docID), body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+// incompressibleText returns printable text that deflate can't shrink much,
+// so it doesn't trip the compression ratio check.
+func incompressibleText(n int) []byte {
+	rng := rand.New(rand.NewSource(1))
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte('a' + rng.Intn(26))
+	}
+	return b
+}
+
+func TestImportDocumentFiles(t *testing.T) {
+	config.App = &config.Config{
+		MaxUploadSizeMB:  1,
+		MaxUserStorageMB: 10,
+		MaxImportEntries: 100,
+		AllowedFileTypes: []string{"text/plain", "text/markdown"},
+	}
+	SetupTestDB()
+	store := SetupTestStorage(t)
+
+	doc := models.Document{Title: "Wiki", UserID: 1}
+	database.DB.Create(&doc)
+	foreign := models.Document{Title: "Secret", UserID: 99}
+	database.DB.Create(&foreign)
+
+	r := GetTestRouter()
+	r.POST("/documents/:id/import", ImportDocumentFiles)
+
+	t.Run("Success - Imports supported files with their folders", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, buildImportRequest(t, doc.ID, map[string][]byte{
+			"wiki/Home.md":              []byte("# Home"),
+			"wiki/eng/Runbook.txt":      []byte("restart it"),
+			"wiki/eng/Runbook copy.txt": []byte("restart it"),
+			"wiki/logo.png":             {0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'},
+			"wiki/big.txt":              incompressibleText(1024*1024 + 1),
+		}))
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var response struct {
+			Files   []models.DocumentFile     `json:"files"`
+			Skipped []dtos.SkippedImportEntry `json:"skipped"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+
+		paths := map[string]models.DocumentFile{}
+		for _, f := range response.Files {
+			paths[f.Path+"/"+f.FileName] = f
+		}
+		assert.Len(t, paths, 3)
+		assert.Equal(t, "wiki", paths["wiki/Home.md"].Path)
+		assert.Equal(t, "text/markdown", paths["wiki/Home.md"].ContentType)
+		assert.Equal(t, "wiki/eng", paths["wiki/eng/Runbook.txt"].Path)
+		// Identical entries share one stored object
+		assert.Equal(t, paths["wiki/eng/Runbook.txt"].ObjectKey, paths["wiki/eng/Runbook copy.txt"].ObjectKey)
+
+		assert.Len(t, response.Skipped, 2)
+
+		var count int64
+		database.DB.Model(&models.DocumentFile{}).Where("document_id = ?", doc.ID).Count(&count)
+		assert.Equal(t, int64(3), count)
+	})
+
+	t.Run("Error - Zip slip rejects the whole archive", func(t *testing.T) {
+		before, _ := store.List(t.Context(), "documents/")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, buildImportRequest(t, doc.ID, map[string][]byte{
+			"a/ok.txt":            []byte("fine"),
+			"../../../etc/cron.d": []byte("* * * * * root evil"),
+		}))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		after, _ := store.List(t.Context(), "documents/")
+		assert.Equal(t, len(before), len(after))
+	})
+
+	t.Run("Error - Document of another user", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, buildImportRequest(t, foreign.ID, map[string][]byte{"a.txt": []byte("x")}))
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/dtos"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+)
+
+// @Summary      Share Document
+// @Description  Grant a user (by email) or a group viewer or editor access to a document. Sharing again with the same user or group changes the role. Only the owner can share, and only with groups they belong to.
+// @Tags         Documents
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "Document ID"
+// @Param        body body dtos.ShareDocumentRequest true "Share Document Request"
+// @Success      201  {object}  models.DocumentShare
+// @Security     BearerAuth
+// @Router       /api/v1/documents/{id}/shares [post]
+func ShareDocument(c *gin.Context) {
+	userID := c.GetUint("userID")
+	doc, ok := findDocument(c, userID, services.RoleOwner)
+	if !ok {
+		return
+	}
+
+	var input dtos.ShareDocumentRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if (input.Email == "") == (input.GroupID == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Specify either email or group_id"})
+		return
+	}
+
+	share := models.DocumentShare{DocumentID: doc.ID, Role: input.Role, CreatedBy: userID}
+	grantee := database.DB.Where("document_id = ?", doc.ID)
+	if input.Email != "" {
+		var user models.User
+		if err := database.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if user.ID == doc.UserID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The owner already has full access"})
+			return
+		}
+		share.UserID = &user.ID
+		grantee = grantee.Where("user_id = ?", user.ID)
+	} else {
+		member, err := services.IsGroupMember(userID, *input.GroupID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to share document"})
+			return
+		}
+		if !member {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+			return
+		}
+		share.GroupID = input.GroupID
+		grantee = grantee.Where("group_id = ?", *input.GroupID)
+	}
+
+	// One grant per grantee; sharing again only changes the role
+	status := http.StatusCreated
+	var existing models.DocumentShare
+	if err := grantee.First(&existing).Error; err == nil {
+		existing.Role = input.Role
+		share = existing
+		status = http.StatusOK
+	}
+	if err := database.DB.Save(&share).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to share document"})
+		return
+	}
+
+	c.JSON(status, share)
+}
+
+// @Summary      Get Document Shares
+// @Description  List who a document is shared with, one page at a time. Only the owner can see its shares.
+// @Tags         Documents
+// @Produce      json
+// @Param        id             path   int     true   "Document ID"
+// @Param        cursor         query  string  false  "next_cursor of the previous page"
+// @Param        limit          query  int     false  "Page size (default 50, max 100)"
+// @Param        sort           query  string  false  "created_at or updated_at, prefix with - for descending (default created_at)"
+// @Param        updated_since  query  string  false  "Only shares updated at or after this RFC 3339 timestamp or YYYY-MM-DD"
+// @Success      200  {object}  map[string]interface{}  "items and next_cursor"
+// @Security     BearerAuth
+// @Router       /api/v1/documents/{id}/shares [get]
+func GetDocumentShares(c *gin.Context) {
+	userID := c.GetUint("userID")
+	doc, ok := findDocument(c, userID, services.RoleOwner)
+	if !ok {
+		return
+	}
+
+	params, ok := bindListParams(c, "created_at", "created_at", "updated_at")
+	if !ok {
+		return
+	}
+
+	shares := []models.DocumentShare{}
+	next, err := services.Paginate(database.DB.Where("document_id = ?", doc.ID), "document_shares", params, &shares)
+	respondPage(c, shares, next, err, "Failed to retrieve shares")
+}
+
+// @Summary      Revoke Document Share
+// @Description  Remove a user's or group's access to a document
+// @Tags         Documents
+// @Produce      json
+// @Param        id       path      int  true  "Document ID"
+// @Param        shareId  path      int  true  "Share ID"
+// @Success      200      {object}  map[string]string
+// @Security     BearerAuth
+// @Router       /api/v1/documents/{id}/shares/{shareId} [delete]
+func DeleteDocumentShare(c *gin.Context) {
+	userID := c.GetUint("userID")
+	doc, ok := findDocument(c, userID, services.RoleOwner)
+	if !ok {
+		return
+	}
+	shareID, err := strconv.Atoi(c.Param("shareId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid share ID"})
+		return
+	}
+
+	result := database.DB.Where("id = ? AND document_id = ?", shareID, doc.ID).Delete(&models.DocumentShare{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke share"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Share revoked successfully"})
+}
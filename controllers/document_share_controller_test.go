@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+)
+
+func TestDocumentSharing(t *testing.T) {
+	SetupTestDB()
+	SetupTestStorage(t)
+
+	owner := models.User{Email: "owner@example.com", PasswordHash: "x", Name: "Owner"}
+	viewer := models.User{Email: "viewer@example.com", PasswordHash: "x", Name: "Viewer"}
+	member := models.User{Email: "member@example.com", PasswordHash: "x", Name: "Member"}
+	stranger := models.User{Email: "stranger@example.com", PasswordHash: "x", Name: "Stranger"}
+	database.DB.Create(&[]*models.User{&owner, &viewer, &member, &stranger})
+
+	doc := models.Document{Title: "Handbook", UserID: owner.ID}
+	database.DB.Create(&doc)
+	file := models.DocumentFile{DocumentID: doc.ID, FileName: "handbook.txt", ObjectKey: "documents/1/handbook.txt", ContentType: "text/plain", Size: 5}
+	database.DB.Create(&file)
+
+	routerFor := func(userID uint) *gin.Engine {
+		r := GetTestRouterAs(userID)
+		r.GET("/documents", GetDocuments)
+		r.GET("/documents/:id", GetDocument)
+		r.PUT("/documents/:id", UpdateDocument)
+		r.DELETE("/documents/:id", DeleteDocument)
+		r.GET("/documents/:id/files/:fileId/download", GetDocumentFileDownloadURL)
+		r.DELETE("/documents/:id/files/:fileId", DeleteDocumentFile)
+		r.POST("/documents/:id/shares", ShareDocument)
+		r.GET("/documents/:id/shares", GetDocumentShares)
+		r.DELETE("/documents/:id/shares/:shareId", DeleteDocumentShare)
+		r.POST("/groups", CreateGroup)
+		r.POST("/groups/:id/members", AddGroupMember)
+		r.DELETE("/groups/:id", DeleteGroup)
+		return r
+	}
+	send := func(userID uint, method, path string, payload interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		routerFor(userID).ServeHTTP(w, req)
+		return w
+	}
+	docPath := fmt.Sprintf("/documents/%d", doc.ID)
+
+	t.Run("Strangers cannot see the document", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, send(stranger.ID, "GET", docPath, nil).Code)
+		assert.Equal(t, http.StatusNotFound, send(viewer.ID, "POST", docPath+"/shares", map[string]string{"email": viewer.Email, "role": "editor"}).Code)
+	})
+
+	var share models.DocumentShare
+	t.Run("Viewer can read and download but not edit", func(t *testing.T) {
+		w := send(owner.ID, "POST", docPath+"/shares", map[string]string{"email": viewer.Email, "role": "viewer"})
+		assert.Equal(t, http.StatusCreated, w.Code)
+		json.Unmarshal(w.Body.Bytes(), &share)
+
+		var page struct {
+			Items []models.Document `json:"items"`
+		}
+		json.Unmarshal(send(viewer.ID, "GET", "/documents", nil).Body.Bytes(), &page)
+		if assert.Len(t, page.Items, 1) {
+			assert.Equal(t, "Handbook", page.Items[0].Title)
+		}
+		assert.Equal(t, http.StatusOK, send(viewer.ID, "GET", fmt.Sprintf("%s/files/%d/download", docPath, file.ID), nil).Code)
+		assert.Equal(t, http.StatusForbidden, send(viewer.ID, "PUT", docPath, map[string]string{"title": "Mine now"}).Code)
+		assert.Equal(t, http.StatusForbidden, send(viewer.ID, "GET", docPath+"/shares", nil).Code)
+	})
+
+	t.Run("Editor can edit but only the owner can delete", func(t *testing.T) {
+		w := send(owner.ID, "POST", docPath+"/shares", map[string]string{"email": viewer.Email, "role": "editor"})
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		assert.Equal(t, http.StatusOK, send(viewer.ID, "PUT", docPath, map[string]string{"title": "Handbook v2"}).Code)
+		assert.Equal(t, http.StatusForbidden, send(viewer.ID, "DELETE", fmt.Sprintf("%s/files/%d", docPath, file.ID), nil).Code)
+		assert.Equal(t, http.StatusForbidden, send(viewer.ID, "DELETE", docPath, nil).Code)
+
+		var shares struct {
+			Items []models.DocumentShare `json:"items"`
+		}
+		json.Unmarshal(send(owner.ID, "GET", docPath+"/shares", nil).Body.Bytes(), &shares)
+		if assert.Len(t, shares.Items, 1) {
+			assert.Equal(t, "editor", shares.Items[0].Role)
+		}
+	})
+
+	t.Run("Group members get access through the group", func(t *testing.T) {
+		w := send(owner.ID, "POST", "/groups", map[string]string{"name": "Support"})
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var group models.Group
+		json.Unmarshal(w.Body.Bytes(), &group)
+
+		w = send(owner.ID, "POST", fmt.Sprintf("/groups/%d/members", group.ID), map[string]string{"email": member.Email})
+		assert.Equal(t, http.StatusCreated, w.Code)
+		w = send(member.ID, "POST", fmt.Sprintf("/groups/%d/members", group.ID), map[string]string{"email": stranger.Email})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = send(owner.ID, "POST", docPath+"/shares", map[string]interface{}{"group_id": group.ID, "role": "viewer"})
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, http.StatusOK, send(member.ID, "GET", docPath, nil).Code)
+
+		role, _ := services.DocumentRole(member.ID, &doc)
+		assert.Equal(t, services.RoleViewer, role)
+
+		assert.Equal(t, http.StatusOK, send(owner.ID, "DELETE", fmt.Sprintf("/groups/%d", group.ID), nil).Code)
+		assert.Equal(t, http.StatusNotFound, send(member.ID, "GET", docPath, nil).Code)
+	})
+
+	t.Run("Revoking a share removes access", func(t *testing.T) {
+		w := send(owner.ID, "DELETE", fmt.Sprintf("%s/shares/%d", docPath, share.ID), nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, http.StatusNotFound, send(viewer.ID, "GET", docPath, nil).Code)
+	})
+
+	t.Run("Exactly one grantee is required", func(t *testing.T) {
+		w := send(owner.ID, "POST", docPath+"/shares", map[string]string{"role": "viewer"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = send(owner.ID, "POST", docPath+"/shares", map[string]string{"email": owner.Email, "role": "viewer"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
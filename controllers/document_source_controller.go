@@ -0,0 +1,250 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/dtos"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+)
+
+// defaultSourceMaxPages applies when a source is added without a page limit.
+const defaultSourceMaxPages = 50
+
+// @Summary      Add Web Source
+// @Description  Add a web page or sitemap.xml as a source of a document and crawl it right away. Each page is stored as a text snapshot file. A page source follows same-site links up to max_depth; a sitemap source fetches the listed pages. robots.txt is respected.
+// @Tags         Documents
+// @Accept       json
+// @Produce      json
+// @Param        id     path      int                               true  "Document ID"
+// @Param        input  body      dtos.CreateDocumentSourceRequest  true  "Source details"
+// @Success      201    {object}  map[string]interface{}
+// @Security     BearerAuth
+// @Router       /api/v1/documents/{id}/sources [post]
+func CreateDocumentSource(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	var input dtos.CreateDocumentSourceRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !strings.HasPrefix(input.URL, "http://") && !strings.HasPrefix(input.URL, "https://") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only http and https URLs are supported"})
+		return
+	}
+
+	doc, ok := findDocument(c, userID, services.RoleEditor)
+	if !ok {
+		return
+	}
+
+	source := models.DocumentSource{
+		DocumentID:           doc.ID,
+		URL:                  input.URL,
+		Kind:                 input.Kind,
+		MaxDepth:             input.MaxDepth,
+		MaxPages:             input.MaxPages,
+		RecrawlIntervalHours: input.RecrawlIntervalHours,
+	}
+	if source.Kind == "" {
+		source.Kind = "page"
+		if strings.HasSuffix(strings.ToLower(strings.SplitN(input.URL, "?", 2)[0]), ".xml") {
+			source.Kind = "sitemap"
+		}
+	}
+	if source.MaxPages == 0 {
+		source.MaxPages = defaultSourceMaxPages
+	}
+	// The source is only committed once its crawl lock is held, so a lock
+	// failure leaves no source behind that was never crawled
+	var unlock func()
+	var lockErr error
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&source).Error; err != nil {
+			return err
+		}
+		unlock, lockErr = services.LockDocumentSource(c.Request.Context(), source.ID)
+		return lockErr
+	})
+	if lockErr != nil {
+		respondLockError(c, nil, lockErr)
+		return
+	}
+	if err != nil {
+		if unlock != nil {
+			unlock()
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create source"})
+		return
+	}
+	defer unlock()
+
+	result, err := services.SyncDocumentSource(c.Request.Context(), &source)
+	if err != nil {
+		respondSyncError(c, &source, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"source": source, "result": result})
+}
+
+// @Summary      Get Web Sources
+// @Description  List the web sources of a document with their last crawl status, one page at a time
+// @Tags         Documents
+// @Produce      json
+// @Param        id             path   int     true   "Document ID"
+// @Param        cursor         query  string  false  "next_cursor of the previous page"
+// @Param        limit          query  int     false  "Page size (default 50, max 100)"
+// @Param        sort           query  string  false  "created_at or updated_at, prefix with - for descending (default created_at)"
+// @Param        updated_since  query  string  false  "Only sources updated at or after this RFC 3339 timestamp or YYYY-MM-DD"
+// @Success      200  {object}  map[string]interface{}  "items and next_cursor"
+// @Security     BearerAuth
+// @Router       /api/v1/documents/{id}/sources [get]
+func GetDocumentSources(c *gin.Context) {
+	userID := c.GetUint("userID")
+	doc, ok := findDocument(c, userID, services.RoleViewer)
+	if !ok {
+		return
+	}
+
+	params, ok := bindListParams(c, "created_at", "created_at", "updated_at")
+	if !ok {
+		return
+	}
+
+	sources := []models.DocumentSource{}
+	next, err := services.Paginate(database.DB.Where("document_id = ?", doc.ID), "document_sources", params, &sources)
+	respondPage(c, sources, next, err, "Failed to retrieve sources")
+}
+
+// @Summary      Re-crawl Web Source
+// @Description  Crawl a web source now. Pages whose text changed get a new file version; unchanged pages are left alone. Returns 409 while the source is already being crawled.
+// @Tags         Documents
+// @Produce      json
+// @Param        id        path      int  true  "Document ID"
+// @Param        sourceId  path      int  true  "Source ID"
+// @Success      200       {object}  map[string]interface{}
+// @Security     BearerAuth
+// @Router       /api/v1/documents/{id}/sources/{sourceId}/sync [post]
+func RecrawlDocumentSource(c *gin.Context) {
+	userID := c.GetUint("userID")
+	source, ok := findDocumentSource(c, userID, services.RoleEditor)
+	if !ok {
+		return
+	}
+
+	unlock, ok := lockDocumentSource(c, source)
+	if !ok {
+		return
+	}
+	defer unlock()
+
+	result, err := services.SyncDocumentSource(c.Request.Context(), source)
+	if err != nil {
+		respondSyncError(c, source, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"source": source, "result": result})
+}
+
+// @Summary      Delete Web Source
+// @Description  Stop crawling a web source. Files already crawled from it are kept.
+// @Tags         Documents
+// @Produce      json
+// @Param        id        path      int  true  "Document ID"
+// @Param        sourceId  path      int  true  "Source ID"
+// @Success      200       {object}  map[string]string
+// @Security     BearerAuth
+// @Router       /api/v1/documents/{id}/sources/{sourceId} [delete]
+func DeleteDocumentSource(c *gin.Context) {
+	userID := c.GetUint("userID")
+	source, ok := findDocumentSource(c, userID, services.RoleEditor)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Model(&models.DocumentFile{}).Where("source_id = ?", source.ID).Update("source_id", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to detach source files"})
+		return
+	}
+	if err := database.DB.Delete(source).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete source"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Source deleted successfully"})
+}
+
+// respondSyncError reports a failed crawl. The source itself was saved with
+// the error, so it is included for the client to show.
+func respondSyncError(c *gin.Context, source *models.DocumentSource, err error) {
+	switch {
+	case errors.Is(err, services.ErrStorageQuotaReached):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error(), "source": source})
+	default:
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to crawl source: " + err.Error(), "source": source})
+	}
+}
+
+// lockDocumentSource takes the crawl lock of source so a manual sync never
+// runs alongside the scheduled one. It writes the error response itself when
+// it fails.
+func lockDocumentSource(c *gin.Context, source *models.DocumentSource) (func(), bool) {
+	unlock, err := services.LockDocumentSource(c.Request.Context(), source.ID)
+	if err != nil {
+		respondLockError(c, source, err)
+		return nil, false
+	}
+	return unlock, true
+}
+
+// respondLockError writes the response for a failure to take the crawl lock of
+// source, which is included when it exists.
+func respondLockError(c *gin.Context, source *models.DocumentSource, err error) {
+	status, message := http.StatusServiceUnavailable, "Failed to lock source"
+	if errors.Is(err, services.ErrSourceLocked) {
+		status, message = http.StatusConflict, "Source is already being crawled"
+	}
+	if source == nil {
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+	c.JSON(status, gin.H{"error": message, "source": source})
+}
+
+// findDocumentSource loads the source named in the path and checks that
+// userID holds at least role on its document. It writes the error response
+// itself when it fails.
+func findDocumentSource(c *gin.Context, userID uint, role string) (*models.DocumentSource, bool) {
+	docID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+		return nil, false
+	}
+	sourceID, err := strconv.Atoi(c.Param("sourceId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid source ID"})
+		return nil, false
+	}
+
+	doc, ok := authorizeDocument(c, userID, docID, role, "Source not found")
+	if !ok {
+		return nil, false
+	}
+
+	var source models.DocumentSource
+	if err := database.DB.Where("id = ? AND document_id = ?", sourceID, doc.ID).First(&source).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Source not found"})
+		return nil, false
+	}
+
+	return &source, true
+}
@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"hsduc.com/rag/config"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+)
+
+func TestDocumentSourceCrawl(t *testing.T) {
+	config.App = &config.Config{
+		MaxUserStorageMB:  100,
+		CrawlUserAgent:    "RAGBot/1.0",
+		CrawlMaxPages:     100,
+		CrawlAllowPrivate: true,
+	}
+	SetupTestDB()
+	SetupTestStorage(t)
+
+	faq := "Returns are accepted within 30 days."
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprint(w, "User-agent: *\nAllow: /\n")
+		case "/help":
+			fmt.Fprint(w, `<html><head><title>Help</title></head><body><main><p>Need help?</p><a href="/help/faq">FAQ</a></main></body></html>`)
+		case "/help/faq":
+			fmt.Fprintf(w, `<html><head><title>FAQ</title></head><body><main><p>%s</p></main></body></html>`, faq)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+
+	doc := models.Document{Title: "Support site", UserID: 1}
+	database.DB.Create(&doc)
+
+	r := GetTestRouter()
+	r.POST("/documents/:id/sources", CreateDocumentSource)
+	r.POST("/documents/:id/sources/:sourceId/sync", RecrawlDocumentSource)
+
+	type syncResponse struct {
+		Source models.DocumentSource `json:"source"`
+		Result services.SyncResult   `json:"result"`
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"url": site.URL + "/help", "max_depth": 1, "recrawl_interval_hours": 24})
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/documents/%d/sources", doc.ID), bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created syncResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	assert.Equal(t, "page", created.Source.Kind)
+	assert.NotNil(t, created.Source.NextCrawlAt)
+	assert.Equal(t, services.SyncResult{Pages: 2, Created: 2}, created.Result)
+
+	var files []models.DocumentFile
+	database.DB.Where("source_id = ?", created.Source.ID).Order("id").Find(&files)
+	if assert.Len(t, files, 2) {
+		assert.Equal(t, "Help.txt", files[0].FileName)
+		assert.Equal(t, site.URL+"/help/faq", files[1].SourceURL)
+		assert.Equal(t, "text/plain", files[1].ContentType)
+	}
+
+	// Only the page whose text changed gets a new version
+	faq = "Returns are accepted within 60 days."
+	req, _ = http.NewRequest("POST", fmt.Sprintf("/documents/%d/sources/%d/sync", doc.ID, created.Source.ID), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var synced syncResponse
+	json.Unmarshal(w.Body.Bytes(), &synced)
+	assert.Equal(t, services.SyncResult{Pages: 2, Updated: 1, Unchanged: 1}, synced.Result)
+
+	var faqFile models.DocumentFile
+	database.DB.Where("source_url = ?", site.URL+"/help/faq").First(&faqFile)
+	assert.Equal(t, 2, faqFile.Version)
+	var versions int64
+	database.DB.Model(&models.DocumentFileVersion{}).Where("document_file_id = ?", faqFile.ID).Count(&versions)
+	assert.Equal(t, int64(1), versions)
+
+	// A site that is down is reported and recorded on the source
+	site.Close()
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	var source models.DocumentSource
+	database.DB.First(&source, created.Source.ID)
+	assert.NotEmpty(t, source.LastError)
+}
+
+// unavailableLocker fails like a lock store that cannot be reached.
+type unavailableLocker struct{}
+
+func (unavailableLocker) Acquire(ctx context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	return nil, false, errors.New("connection refused")
+}
+
+func TestCreateDocumentSourceLockUnavailable(t *testing.T) {
+	config.App = &config.Config{CrawlAllowPrivate: true}
+	SetupTestDB()
+	services.Locks = unavailableLocker{}
+
+	doc := models.Document{Title: "Support site", UserID: 1}
+	database.DB.Create(&doc)
+
+	r := GetTestRouter()
+	r.POST("/documents/:id/sources", CreateDocumentSource)
+
+	body, _ := json.Marshal(map[string]interface{}{"url": "http://127.0.0.1/help"})
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/documents/%d/sources", doc.ID), bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var sources int64
+	database.DB.Model(&models.DocumentSource{}).Count(&sources)
+	assert.Zero(t, sources, "no source is left behind uncrawled")
+}
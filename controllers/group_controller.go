@@ -0,0 +1,218 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/dtos"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+)
+
+// @Summary      Create Group
+// @Description  Create a group of users that documents can be shared with. The creator owns the group and is its first member.
+// @Tags         Groups
+// @Accept       json
+// @Produce      json
+// @Param        body body dtos.CreateGroupRequest true "Create Group Request"
+// @Success      201  {object}  models.Group
+// @Security     BearerAuth
+// @Router       /api/v1/groups [post]
+func CreateGroup(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	var input dtos.CreateGroupRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	group := models.Group{OwnerID: userID, Name: input.Name}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&group).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.GroupMember{GroupID: group.ID, UserID: userID}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create group"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, group)
+}
+
+// @Summary      Get Groups
+// @Description  Get the groups the authenticated user belongs to, with their members, one page at a time
+// @Tags         Groups
+// @Produce      json
+// @Param        cursor         query  string  false  "next_cursor of the previous page"
+// @Param        limit          query  int     false  "Page size (default 50, max 100)"
+// @Param        sort           query  string  false  "name or created_at, prefix with - for descending (default name)"
+// @Param        updated_since  query  string  false  "Only groups updated at or after this RFC 3339 timestamp or YYYY-MM-DD"
+// @Success      200  {object}  map[string]interface{}  "items and next_cursor"
+// @Security     BearerAuth
+// @Router       /api/v1/groups [get]
+func GetGroups(c *gin.Context) {
+	userID := c.GetUint("userID")
+	params, ok := bindListParams(c, "name", "name", "created_at")
+	if !ok {
+		return
+	}
+
+	groups := []models.Group{}
+	query := database.DB.
+		Where("id IN (?)", database.DB.Model(&models.GroupMember{}).Select("group_id").Where("user_id = ?", userID)).
+		Preload("Members.User")
+	next, err := services.Paginate(query, "groups", params, &groups)
+	respondPage(c, groups, next, err, "Failed to retrieve groups")
+}
+
+// @Summary      Add Group Member
+// @Description  Add a registered user to a group by email. Only the group owner can add members.
+// @Tags         Groups
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "Group ID"
+// @Param        body body dtos.AddGroupMemberRequest true "Add Group Member Request"
+// @Success      201  {object}  models.GroupMember
+// @Security     BearerAuth
+// @Router       /api/v1/groups/{id}/members [post]
+func AddGroupMember(c *gin.Context) {
+	userID := c.GetUint("userID")
+	group, ok := findOwnedGroup(c, userID)
+	if !ok {
+		return
+	}
+
+	var input dtos.AddGroupMemberRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	exists, err := services.IsGroupMember(user.ID, group.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add member"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already a member of this group"})
+		return
+	}
+
+	member := models.GroupMember{GroupID: group.ID, UserID: user.ID, User: user}
+	if err := database.DB.Omit("User").Create(&member).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add member"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, member)
+}
+
+// @Summary      Remove Group Member
+// @Description  Remove a user from a group. The owner can remove anyone but themselves; other members can only leave.
+// @Tags         Groups
+// @Produce      json
+// @Param        id      path      int  true  "Group ID"
+// @Param        userId  path      int  true  "User ID"
+// @Success      200     {object}  map[string]string
+// @Security     BearerAuth
+// @Router       /api/v1/groups/{id}/members/{userId} [delete]
+func RemoveGroupMember(c *gin.Context) {
+	userID := c.GetUint("userID")
+	groupID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+	memberID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var group models.Group
+	if err := database.DB.First(&group, groupID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+	if group.OwnerID != userID && uint(memberID) != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the group owner can remove other members"})
+		return
+	}
+	if uint(memberID) == group.OwnerID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The owner cannot leave the group; delete it instead"})
+		return
+	}
+
+	result := database.DB.Where("group_id = ? AND user_id = ?", group.ID, memberID).Delete(&models.GroupMember{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed successfully"})
+}
+
+// @Summary      Delete Group
+// @Description  Delete a group. Documents shared with it are no longer accessible to its members.
+// @Tags         Groups
+// @Produce      json
+// @Param        id   path      int  true  "Group ID"
+// @Success      200  {object}  map[string]string
+// @Security     BearerAuth
+// @Router       /api/v1/groups/{id} [delete]
+func DeleteGroup(c *gin.Context) {
+	userID := c.GetUint("userID")
+	group, ok := findOwnedGroup(c, userID)
+	if !ok {
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", group.ID).Delete(&models.DocumentShare{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", group.ID).Delete(&models.GroupMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(group).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete group"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Group deleted successfully"})
+}
+
+// findOwnedGroup loads the group in the :id path parameter if userID owns
+// it. It writes the error response itself when it fails.
+func findOwnedGroup(c *gin.Context, userID uint) (*models.Group, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return nil, false
+	}
+
+	var group models.Group
+	if err := database.DB.Where("id = ? AND owner_id = ?", id, userID).First(&group).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return nil, false
+	}
+
+	return &group, true
+}
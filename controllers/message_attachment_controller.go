@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"path"
+
+	"github.com/gin-gonic/gin"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+	"hsduc.com/rag/utils"
+)
+
+// @Summary      Upload Message Attachment
+// @Description  Upload an image or small file to send with a message by passing its id in attachment_ids. Images are shown to vision models; the text of other files is given to the model. Attachments not sent within a day are deleted.
+// @Tags         Messages
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        file  formData  file  true  "Image or file"
+// @Success      201   {object}  models.MessageAttachment
+// @Security     BearerAuth
+// @Router       /api/v1/messages/attachments [post]
+func UploadMessageAttachment(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is required"})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer file.Close()
+
+	// Sniff the real type from the content instead of trusting the client's header
+	head := make([]byte, utils.SniffLength)
+	n, _ := io.ReadFull(file, head)
+	fileName := path.Base(fileHeader.Filename)
+	contentType, err := services.ValidateAttachment(userID, head[:n], fileName, fileHeader.Size)
+	if err != nil {
+		respondUploadError(c, err, "Failed to read file")
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+	// Within the attachment size limit, so it can be held in memory
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	attachment := models.MessageAttachment{
+		UserID:      userID,
+		FileName:    fileName,
+		ObjectKey:   services.BuildAttachmentObjectKey(userID, fileName),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Text:        services.AttachmentText(data, contentType),
+	}
+	if err := services.UploadFile(c.Request.Context(), attachment.ObjectKey, contentType, bytes.NewReader(data), attachment.Size); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload file"})
+		return
+	}
+	if err := database.DB.Create(&attachment).Error; err != nil {
+		_ = services.DeleteFile(c.Request.Context(), attachment.ObjectKey)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attachment"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, attachment)
+}
+
+// @Summary      Get Message Attachment Content
+// @Description  Download an attachment the user uploaded
+// @Tags         Messages
+// @Produce      octet-stream
+// @Param        id   path  string  true  "Attachment ID"
+// @Success      200
+// @Security     BearerAuth
+// @Router       /api/v1/messages/attachments/{id}/content [get]
+func GetMessageAttachmentContent(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	attachment, ok := findMessageAttachment(c, userID)
+	if !ok {
+		return
+	}
+
+	serveObject(c, attachment.ObjectKey, attachment.FileName, attachment.ContentType, "", attachment.CreatedAt)
+}
+
+// @Summary      Delete Message Attachment
+// @Description  Delete an attachment that has not been sent yet. Sent attachments are deleted with their message.
+// @Tags         Messages
+// @Produce      json
+// @Param        id   path  string  true  "Attachment ID"
+// @Success      200  {object}  map[string]interface{}
+// @Security     BearerAuth
+// @Router       /api/v1/messages/attachments/{id} [delete]
+func DeleteMessageAttachment(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	attachment, ok := findMessageAttachment(c, userID)
+	if !ok {
+		return
+	}
+	if attachment.MessageID != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Attachment was already sent"})
+		return
+	}
+
+	if err := database.DB.Delete(attachment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete attachment"})
+		return
+	}
+	_ = services.DeleteFile(c.Request.Context(), attachment.ObjectKey)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Attachment deleted"})
+}
+
+// findMessageAttachment loads the attachment in the :id path parameter if
+// userID uploaded it. It writes the error response itself when it fails.
+func findMessageAttachment(c *gin.Context, userID uint) (*models.MessageAttachment, bool) {
+	var attachment models.MessageAttachment
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&attachment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return nil, false
+	}
+	return &attachment, true
+}
@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"hsduc.com/rag/config"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+)
+
+func TestMessageAttachments(t *testing.T) {
+	var lastRequest, lastMessage json.RawMessage
+	mockOpenAI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []json.RawMessage `json:"messages"`
+		}
+		lastRequest, _ = io.ReadAll(r.Body)
+		json.Unmarshal(lastRequest, &req)
+		lastMessage = req.Messages[len(req.Messages)-1]
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`)
+	}))
+	defer mockOpenAI.Close()
+
+	config.App = &config.Config{
+		OpenAIApiKey:        "test-key",
+		OpenAIBaseURL:       mockOpenAI.URL,
+		MaxAttachmentSizeMB: 1,
+		AllowedFileTypes:    []string{"text/plain"},
+		VisionModels:        []string{services.ChatModel},
+	}
+	SetupTestDB()
+	SetupTestStorage(t)
+
+	r := GetTestRouter()
+	r.POST("/messages", CreateMessage)
+	r.POST("/messages/attachments", UploadMessageAttachment)
+	r.GET("/messages/attachments/:id/content", GetMessageAttachmentContent)
+	r.DELETE("/messages/attachments/:id", DeleteMessageAttachment)
+
+	upload := func(name string, content []byte) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, _ := writer.CreateFormFile("file", name)
+		part.Write(content)
+		writer.Close()
+		req, _ := http.NewRequest("POST", "/messages/attachments", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	uploaded := func(name string, content []byte) models.MessageAttachment {
+		w := upload(name, content)
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var attachment models.MessageAttachment
+		json.Unmarshal(w.Body.Bytes(), &attachment)
+		return attachment
+	}
+	send := func(method, path string, payload interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 64)...)
+	conversation := models.Conversation{UserID: 1, Title: "Errors"}
+	database.DB.Create(&conversation)
+
+	t.Run("Upload validation", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnsupportedMediaType, upload("tool.exe", []byte("MZ\x90\x00\x03\x00\x00\x00")).Code)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, upload("huge.txt", bytes.Repeat([]byte("a"), 1024*1024+1)).Code)
+
+		screenshot := uploaded("screenshot.png", png)
+		assert.Equal(t, "image/png", screenshot.ContentType)
+		assert.Nil(t, screenshot.MessageID)
+	})
+
+	t.Run("Images go to vision models as image parts", func(t *testing.T) {
+		screenshot := uploaded("error.png", png)
+		log := uploaded("server.log.txt", []byte("panic: assignment to entry in nil map"))
+
+		w := send("POST", "/messages", map[string]interface{}{
+			"conversation_id": conversation.ID, "role": "user", "content": "What does this error mean?",
+			"attachment_ids": []uint{screenshot.ID, log.ID},
+		})
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var resp struct {
+			UserMessage models.Message `json:"user_message"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		assert.Len(t, resp.UserMessage.Attachments, 2)
+
+		var sent struct {
+			Content []struct {
+				Type     string `json:"type"`
+				Text     string `json:"text"`
+				ImageURL struct {
+					URL string `json:"url"`
+				} `json:"image_url"`
+			} `json:"content"`
+		}
+		assert.NoError(t, json.Unmarshal(lastMessage, &sent))
+		if assert.Len(t, sent.Content, 2) {
+			assert.Contains(t, sent.Content[0].Text, "What does this error mean?")
+			assert.Contains(t, sent.Content[0].Text, "Attached file server.log.txt:\npanic: assignment to entry in nil map")
+			assert.Equal(t, "image_url", sent.Content[1].Type)
+			assert.True(t, strings.HasPrefix(sent.Content[1].ImageURL.URL, "data:image/png;base64,"))
+		}
+
+		w = send("POST", "/messages", map[string]interface{}{"conversation_id": conversation.ID, "role": "user", "attachment_ids": []uint{screenshot.ID}})
+		assert.Equal(t, http.StatusBadRequest, w.Code, "an attachment is sent only once")
+		w = send("POST", "/messages", map[string]interface{}{"conversation_id": conversation.ID, "role": "assistant", "content": "x", "attachment_ids": []uint{uploaded("a.png", png).ID}})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = send("POST", "/messages", map[string]interface{}{"conversation_id": conversation.ID, "role": "user", "content": "And how do I fix it?"})
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		assert.NotContains(t, string(lastRequest), "data:image/png", "earlier images are not sent again")
+		assert.Contains(t, string(lastRequest), "[Attached image error.png]")
+		assert.Contains(t, string(lastRequest), "panic: assignment to entry in nil map", "file text is kept")
+
+		assert.Equal(t, http.StatusConflict, send("DELETE", fmt.Sprintf("/messages/attachments/%d", screenshot.ID), nil).Code)
+		w = send("GET", fmt.Sprintf("/messages/attachments/%d/content", screenshot.ID), nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, png, w.Body.Bytes())
+	})
+
+	t.Run("Other models get the image names", func(t *testing.T) {
+		config.App.VisionModels = nil
+		defer func() { config.App.VisionModels = []string{services.ChatModel} }()
+
+		w := send("POST", "/messages", map[string]interface{}{
+			"conversation_id": conversation.ID, "role": "user", "attachment_ids": []uint{uploaded("again.png", png).ID},
+		})
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var sent struct {
+			Content string `json:"content"`
+		}
+		assert.NoError(t, json.Unmarshal(lastMessage, &sent))
+		assert.Equal(t, "\n\n[Attached image again.png]", sent.Content)
+	})
+
+	t.Run("Unsent attachments are deleted", func(t *testing.T) {
+		discarded := uploaded("discarded.png", png)
+		assert.Equal(t, http.StatusOK, send("DELETE", fmt.Sprintf("/messages/attachments/%d", discarded.ID), nil).Code)
+
+		forgotten := uploaded("forgotten.png", png)
+		database.DB.Model(&models.MessageAttachment{}).Where("id = ?", forgotten.ID).Update("created_at", time.Now().Add(-25*time.Hour))
+		var objectKey string
+		database.DB.Model(&models.MessageAttachment{}).Where("id = ?", forgotten.ID).Pluck("object_key", &objectKey)
+
+		removed, err := services.PurgeUnsentAttachments(t.Context())
+		assert.NoError(t, err)
+		assert.Equal(t, 1, removed)
+		_, err = services.StatFile(t.Context(), objectKey)
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, send("GET", fmt.Sprintf("/messages/attachments/%d/content", forgotten.ID), nil).Code)
+	})
+}
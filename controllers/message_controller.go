@@ -3,10 +3,13 @@ package controllers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 	"hsduc.com/rag/database"
 	"hsduc.com/rag/dtos"
 	"hsduc.com/rag/models"
@@ -14,7 +17,7 @@ import (
 )
 
 // @Summary      Create Message
-// @Description  Create a new message
+// @Description  Create a new message, written directly or from a prompt template filled in with variable values, optionally with uploaded attachments
 // @Tags         Messages
 // @Accept       json
 // @Produce      json
@@ -44,7 +47,33 @@ func CreateMessage(c *gin.Context) {
 		return
 	}
 
-	if err := database.DB.Create(&input).Error; err != nil {
+	if bodyInterface.TemplateID != nil {
+		content, ok := renderPromptTemplate(c, userID, &bodyInterface)
+		if !ok {
+			return
+		}
+		input.Content = content
+	}
+
+	if len(bodyInterface.AttachmentIDs) > 0 && input.Role != "user" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only user messages can have attachments"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&input).Error; err != nil {
+			return err
+		}
+		if err := services.AttachToMessage(tx, userID, input.ID, bodyInterface.AttachmentIDs); err != nil {
+			return err
+		}
+		return tx.Where("message_id = ?", input.ID).Order("id").Find(&input.Attachments).Error
+	})
+	if errors.Is(err, services.ErrUnknownAttachment) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Attachment not found or already sent"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create message"})
 		return
 	}
@@ -57,7 +86,7 @@ func CreateMessage(c *gin.Context) {
 	if input.Role == "user" {
 		// Fetch last 10 messages for context
 		var previousMessages []models.Message
-		database.DB.Where("conversation_id = ?", input.ConversationID).
+		database.DB.Preload("Attachments").Where("conversation_id = ?", input.ConversationID).
 			Order("created_at desc").
 			Limit(10).
 			Find(&previousMessages)
@@ -67,12 +96,18 @@ func CreateMessage(c *gin.Context) {
 			previousMessages[i], previousMessages[j] = previousMessages[j], previousMessages[i]
 		}
 
-		replyContent, err := services.GetChatbotResponse(previousMessages, []string{})
+		assistant := conversationAssistant(userID, &conversation)
+		settings := services.AssistantChatSettings(assistant)
+		documents, citations := retrieveContext(c, userID, &conversation, input.Content, bodyInterface.Filter, assistant)
+		replyContent, err := services.GetChatbotResponse(previousMessages, documents, settings)
 		if err == nil && replyContent != "" {
 			assistantMsg := models.Message{
 				ConversationID: input.ConversationID,
 				Role:           "assistant",
 				Content:        replyContent,
+				Citations:      citations,
+				Model:          settings.ModelName(),
+				PromptVersion:  settings.PromptVersion(),
 			}
 			database.DB.Create(&assistantMsg)
 
@@ -88,11 +123,15 @@ func CreateMessage(c *gin.Context) {
 }
 
 // @Summary      Get Messages
-// @Description  Get messages for a conversation
+// @Description  List the messages of a conversation one page at a time, oldest first by default
 // @Tags         Messages
 // @Produce      json
-// @Param        conversation_id query string true "Conversation ID"
-// @Success      200  {array}   models.Message
+// @Param        conversation_id  query  string  true   "Conversation ID"
+// @Param        cursor           query  string  false  "next_cursor of the previous page"
+// @Param        limit            query  int     false  "Page size (default 50, max 100)"
+// @Param        sort             query  string  false  "created_at or updated_at, prefix with - for descending (default created_at)"
+// @Param        updated_since    query  string  false  "Only messages updated at or after this RFC 3339 timestamp or YYYY-MM-DD"
+// @Success      200  {object}  map[string]interface{}  "items and next_cursor"
 // @Security     BearerAuth
 // @Router       /api/v1/messages [get]
 func GetMessages(c *gin.Context) {
@@ -111,13 +150,45 @@ func GetMessages(c *gin.Context) {
 		return
 	}
 
-	var messages []models.Message
-	if err := database.DB.Where("conversation_id = ?", conversationID).Find(&messages).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch messages"})
+	params, ok := bindListParams(c, "created_at", "created_at", "updated_at")
+	if !ok {
+		return
+	}
+
+	messages := []models.Message{}
+	next, err := services.Paginate(database.DB.Preload("Attachments").Where("conversation_id = ?", conversationID), "messages", params, &messages)
+	respondPage(c, messages, next, err, "Failed to fetch messages")
+}
+
+// @Summary      Search Messages
+// @Description  Full-text search over the messages of all the user's conversations. Every word of q must match; results are ranked by relevance and carry an excerpt with matches wrapped in <mark>.
+// @Tags         Messages
+// @Produce      json
+// @Param        q              query  string  true   "Search words"
+// @Param        cursor         query  string  false  "next_cursor of the previous page"
+// @Param        limit          query  int     false  "Page size (default 50, max 100)"
+// @Param        updated_since  query  string  false  "Only messages updated at or after this RFC 3339 timestamp or YYYY-MM-DD"
+// @Success      200  {object}  map[string]interface{}  "items and next_cursor"
+// @Security     BearerAuth
+// @Router       /api/v1/messages/search [get]
+func SearchMessages(c *gin.Context) {
+	var input dtos.SearchMessagesRequest
+	if err := c.ShouldBindQuery(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	params, ok := bindListParams(c, "relevance", "relevance")
+	if !ok {
 		return
 	}
 
-	c.JSON(http.StatusOK, messages)
+	userID := c.MustGet("userID").(uint)
+	results, next, err := services.SearchMessages(userID, input.Query, params)
+	if errors.Is(err, services.ErrEmptySearch) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Search needs at least one letter or number"})
+		return
+	}
+	respondPage(c, results, next, err, "Failed to search messages")
 }
 
 // @Summary      Get Message
@@ -132,7 +203,7 @@ func GetMessage(c *gin.Context) {
 	id := c.Param("id")
 	userID := c.MustGet("userID").(uint)
 	var message models.Message
-	if err := database.DB.Joins("JOIN conversations on messages.conversation_id = conversations.id").
+	if err := database.DB.Preload("Attachments").Joins("JOIN conversations on messages.conversation_id = conversations.id").
 		Where("messages.id = ? AND conversations.user_id = ?", id, userID).
 		First(&message).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
@@ -179,7 +250,7 @@ func UpdateMessage(c *gin.Context) {
 }
 
 // @Summary      Delete Message
-// @Description  Delete a message by id
+// @Description  Move a message to the trash
 // @Tags         Messages
 // @Produce      json
 // @Param        id   path      string  true  "Message ID"
@@ -200,3 +271,41 @@ func DeleteMessage(c *gin.Context) {
 	database.DB.Delete(&message)
 	c.JSON(http.StatusOK, gin.H{"message": "Message deleted"})
 }
+
+// retrieveContext finds passages of the files dropped into the conversation,
+// the user's documents within the optional filter and the assistant's
+// knowledge relevant to the question, formatted for the system prompt,
+// together with one citation per file they came from.
+// Retrieval problems only cost context, so they are logged and not returned.
+func retrieveContext(c *gin.Context, userID uint, conversation *models.Conversation, question string, scope *dtos.DocumentFilter, assistant *models.Assistant) ([]string, []models.Citation) {
+	var filter services.DocumentFilter
+	if scope != nil {
+		filter = services.DocumentFilter{Tags: scope.Tags, Metadata: scope.Metadata, ContentTypes: scope.ContentTypes}
+		if scope.CollectionID != nil {
+			ids, err := services.CollectionSubtreeIDs(userID, *scope.CollectionID)
+			if err != nil {
+				log.Printf("Retrieval failed: %v", err)
+				return []string{}, nil
+			}
+			filter.CollectionIDs = ids
+		}
+	}
+
+	passages, err := services.RetrieveConversationPassages(c.Request.Context(), userID, conversation.ID, question, filter, assistant, 5)
+	if err != nil {
+		log.Printf("Retrieval failed: %v", err)
+		return []string{}, nil
+	}
+
+	documents := make([]string, 0, len(passages))
+	var citations []models.Citation
+	cited := map[[2]uint]bool{}
+	for _, p := range passages {
+		documents = append(documents, "Source: "+p.FileName+"\n"+p.Text)
+		if key := [2]uint{p.FileID, p.ConversationFileID}; !cited[key] {
+			cited[key] = true
+			citations = append(citations, models.Citation{DocumentID: p.DocumentID, FileID: p.FileID, ConversationFileID: p.ConversationFileID, FileName: p.FileName, Version: p.Version})
+		}
+	}
+	return documents, citations
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -13,6 +14,7 @@ import (
 	"hsduc.com/rag/database"
 	"hsduc.com/rag/dtos"
 	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
 )
 
 func TestCreateMessage(t *testing.T) {
@@ -145,9 +147,12 @@ func TestGetMessages(t *testing.T) {
 			},
 			expectedStatus: http.StatusOK,
 			checkResponse: func(t *testing.T, w *httptest.ResponseRecorder) {
-				var messages []models.Message
-				err := json.Unmarshal(w.Body.Bytes(), &messages)
+				var page struct {
+					Items []models.Message `json:"items"`
+				}
+				err := json.Unmarshal(w.Body.Bytes(), &page)
 				assert.NoError(t, err)
+				messages := page.Items
 				assert.Len(t, messages, 2)
 				assert.Equal(t, "Hello", messages[0].Content)
 				assert.Equal(t, "Hi there", messages[1].Content)
@@ -410,3 +415,242 @@ func TestDeleteMessage(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateMessageRetrievesScopedContext(t *testing.T) {
+	var systemPrompt string
+	mockOpenAI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		systemPrompt = req.Messages[0].Content
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`)
+	}))
+	defer mockOpenAI.Close()
+
+	config.App = &config.Config{OpenAIApiKey: "test-key", OpenAIBaseURL: mockOpenAI.URL}
+	SetupTestDB()
+	store := SetupTestStorage(t)
+
+	for i, team := range []string{"payments", "search"} {
+		content := []byte(fmt.Sprintf("The %s refund window is %d days.", team, (i+1)*30))
+		key := fmt.Sprintf("documents/%d/1_policy.txt", i+1)
+		store.Put(t.Context(), key, "text/plain", bytes.NewReader(content), int64(len(content)))
+		doc := models.Document{Title: team, UserID: 1, Metadata: map[string]string{"team": team}}
+		database.DB.Create(&doc)
+		services.SyncLabels(database.DB, doc.ID, 0, nil, doc.Metadata)
+		database.DB.Create(&models.DocumentFile{DocumentID: doc.ID, FileName: team + "-policy.txt", ObjectKey: key, ContentType: "text/plain", Size: int64(len(content))})
+	}
+	conversation := models.Conversation{Title: "Refunds", UserID: 1}
+	database.DB.Create(&conversation)
+
+	r := GetTestRouter()
+	r.POST("/messages", CreateMessage)
+
+	body, _ := json.Marshal(dtos.CreateMessageRequest{
+		ConversationID: conversation.ID,
+		Role:           "user",
+		Content:        "How long is the refund window?",
+		Filter:         &dtos.DocumentFilter{Metadata: map[string]string{"team": "payments"}},
+	})
+	req, _ := http.NewRequest("POST", "/messages", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, systemPrompt, "Source: payments-policy.txt\nThe payments refund window is 30 days.")
+	assert.NotContains(t, systemPrompt, "search")
+
+	var resp struct {
+		AssistantMessage models.Message `json:"assistant_message"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if assert.Len(t, resp.AssistantMessage.Citations, 1) {
+		assert.Equal(t, "payments-policy.txt", resp.AssistantMessage.Citations[0].FileName)
+	}
+
+	// The extracted text is kept, so later questions do not read the storage
+	var file models.DocumentFile
+	database.DB.Where("file_name = ?", "payments-policy.txt").First(&file)
+	assert.NoError(t, services.DeleteFile(t.Context(), file.ObjectKey))
+	ask := func() {
+		req, _ := http.NewRequest("POST", "/messages", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	systemPrompt = ""
+	ask()
+	assert.Contains(t, systemPrompt, "The payments refund window is 30 days.")
+
+	// A new object is chunked again
+	content := []byte("The payments refund window is 45 days.")
+	key := "documents/1/2_policy.txt"
+	store.Put(t.Context(), key, "text/plain", bytes.NewReader(content), int64(len(content)))
+	database.DB.Model(&file).UpdateColumn("object_key", key)
+	ask()
+	assert.Contains(t, systemPrompt, "The payments refund window is 45 days.")
+	var chunks int64
+	database.DB.Model(&models.DocumentFileChunk{}).Where("document_file_id = ?", file.ID).Count(&chunks)
+	assert.EqualValues(t, 1, chunks)
+}
+
+func TestSearchMessages(t *testing.T) {
+	SetupTestDB()
+	r := GetTestRouter()
+	r.GET("/messages/search", SearchMessages)
+
+	trip := models.Conversation{UserID: 1, Title: "Trip"}
+	cooking := models.Conversation{UserID: 1, Title: "Cooking"}
+	other := models.Conversation{UserID: 2, Title: "Someone else"}
+	database.DB.Create(&[]*models.Conversation{&trip, &cooking, &other})
+	database.DB.Create(&[]models.Message{
+		{ConversationID: trip.ID, Role: "assistant", Content: "Kyoto is lovely in autumn; book the <ryokan> early."},
+		{ConversationID: cooking.ID, Role: "assistant", Content: "Let the risotto rest before serving. Autumn squash works well."},
+		{ConversationID: cooking.ID, Role: "user", Content: "Which squash?"},
+		{ConversationID: other.ID, Role: "assistant", Content: "Autumn leaves in Kyoto"},
+	})
+
+	type page struct {
+		Items []struct {
+			ConversationTitle string `json:"conversation_title"`
+			Snippet           string `json:"snippet"`
+		} `json:"items"`
+		NextCursor *string `json:"next_cursor"`
+	}
+	search := func(query string) (int, page) {
+		req, _ := http.NewRequest("GET", "/messages/search?"+query, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var body page
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body
+	}
+
+	t.Run("Matches all words across conversations", func(t *testing.T) {
+		code, body := search("q=autumn+kyoto")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Nil(t, body.NextCursor)
+		if assert.Len(t, body.Items, 1) {
+			assert.Equal(t, "Trip", body.Items[0].ConversationTitle)
+			assert.Equal(t, "<mark>Kyoto</mark> is lovely in <mark>autumn</mark>; book the &lt;ryokan&gt; early.", body.Items[0].Snippet)
+		}
+	})
+
+	t.Run("Paginates", func(t *testing.T) {
+		_, first := search("q=autumn&limit=1")
+		assert.Len(t, first.Items, 1)
+		if assert.NotNil(t, first.NextCursor) {
+			_, second := search("q=autumn&limit=1&cursor=" + *first.NextCursor)
+			assert.Len(t, second.Items, 1)
+			assert.Nil(t, second.NextCursor)
+			assert.NotEqual(t, first.Items[0].ConversationTitle, second.Items[0].ConversationTitle)
+
+			code, _ := search("q=squash&limit=1&cursor=" + *first.NextCursor)
+			assert.Equal(t, http.StatusBadRequest, code, "cursors belong to their search")
+		}
+	})
+
+	t.Run("Short words are searched", func(t *testing.T) {
+		database.DB.Create(&models.Message{ConversationID: trip.ID, Role: "user", Content: "Should we go by JR pass?"})
+		code, body := search("q=JR")
+		assert.Equal(t, http.StatusOK, code)
+		if assert.Len(t, body.Items, 1) {
+			assert.Equal(t, "Should we go by <mark>JR</mark> pass?", body.Items[0].Snippet)
+		}
+	})
+
+	t.Run("Deleted messages are not found", func(t *testing.T) {
+		database.DB.Where("content = ?", "Which squash?").Delete(&models.Message{})
+		_, body := search("q=squash")
+		assert.Len(t, body.Items, 1)
+	})
+
+	t.Run("Query is required", func(t *testing.T) {
+		code, _ := search("")
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = search("q=%3F%21")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
+
+func TestCitationsKeepFileVersion(t *testing.T) {
+	mockOpenAI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`)
+	}))
+	defer mockOpenAI.Close()
+
+	config.App = &config.Config{
+		OpenAIApiKey:     "test-key",
+		OpenAIBaseURL:    mockOpenAI.URL,
+		MaxUploadSizeMB:  10,
+		MaxUserStorageMB: 100,
+		AllowedFileTypes: []string{"text/plain"},
+	}
+	SetupTestDB()
+	store := SetupTestStorage(t)
+
+	content := []byte("The refund window is 30 days.")
+	key := "documents/1/1_policy.txt"
+	store.Put(t.Context(), key, "text/plain", bytes.NewReader(content), int64(len(content)))
+	doc := models.Document{Title: "Policies", UserID: 1}
+	database.DB.Create(&doc)
+	docFile := models.DocumentFile{DocumentID: doc.ID, FileName: "policy.txt", ObjectKey: key, ContentType: "text/plain", Size: int64(len(content)), Version: 1}
+	database.DB.Create(&docFile)
+	conversation := models.Conversation{Title: "Refunds", UserID: 1}
+	database.DB.Create(&conversation)
+
+	r := GetTestRouter()
+	r.POST("/messages", CreateMessage)
+	r.GET("/messages/:id", GetMessage)
+	r.PUT("/documents/:id/files/:fileId", ReplaceDocumentFile)
+
+	ask := func() models.Message {
+		body, _ := json.Marshal(dtos.CreateMessageRequest{ConversationID: conversation.ID, Role: "user", Content: "How long is the refund window?"})
+		req, _ := http.NewRequest("POST", "/messages", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var resp struct {
+			AssistantMessage models.Message `json:"assistant_message"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp.AssistantMessage
+	}
+
+	first := ask()
+	if assert.Len(t, first.Citations, 1) {
+		assert.Equal(t, 1, first.Citations[0].Version)
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", "policy.txt")
+	part.Write([]byte("The refund window is 60 days."))
+	writer.Close()
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/documents/%d/files/%d", doc.ID, docFile.ID), body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	second := ask()
+	if assert.Len(t, second.Citations, 1) {
+		assert.Equal(t, 2, second.Citations[0].Version)
+	}
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/messages/%d", first.ID), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var earlier models.Message
+	json.Unmarshal(w.Body.Bytes(), &earlier)
+	if assert.Len(t, earlier.Citations, 1) {
+		assert.Equal(t, 1, earlier.Citations[0].Version, "an older answer still cites the version it used")
+	}
+}
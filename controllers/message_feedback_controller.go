@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/dtos"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+)
+
+// @Summary      Rate Message
+// @Description  Give a thumbs up or down, with optional reason categories and a comment, on an assistant message. Rating a message again replaces the earlier feedback.
+// @Tags         Messages
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "Message ID"
+// @Param        body body dtos.MessageFeedbackRequest true "Feedback"
+// @Success      200  {object}  models.MessageFeedback  "Feedback replaced"
+// @Success      201  {object}  models.MessageFeedback  "Feedback created"
+// @Security     BearerAuth
+// @Router       /api/v1/messages/{id}/feedback [post]
+func RateMessage(c *gin.Context) {
+	id := c.Param("id")
+	userID := c.MustGet("userID").(uint)
+	var message models.Message
+	if err := database.DB.Joins("JOIN conversations on messages.conversation_id = conversations.id").
+		Where("messages.id = ? AND conversations.user_id = ?", id, userID).
+		First(&message).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	if message.Role != "assistant" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only assistant messages can be rated"})
+		return
+	}
+
+	var input dtos.MessageFeedbackRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	reasons := input.Reasons
+	if reasons == nil {
+		reasons = []string{}
+	}
+
+	status := http.StatusOK
+	var feedback models.MessageFeedback
+	err := database.DB.Where("message_id = ?", message.ID).First(&feedback).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		status = http.StatusCreated
+		feedback = models.MessageFeedback{MessageID: message.ID, UserID: userID}
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save feedback"})
+		return
+	}
+	feedback.Rating = input.Rating
+	feedback.Reasons = reasons
+	feedback.Comment = input.Comment
+	if err := database.DB.Save(&feedback).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save feedback"})
+		return
+	}
+
+	c.JSON(status, feedback)
+}
+
+// @Summary      Feedback Report
+// @Description  Aggregate the user's message feedback by model, prompt version or cited document: up and down counts, the share of up ratings and how often each reason was given. Compare periods with since and until to see whether a retrieval or prompt change helped.
+// @Tags         Messages
+// @Produce      json
+// @Param        group_by  query  string  true   "model, prompt or document"
+// @Param        since     query  string  false  "Only feedback given or changed at or after this RFC 3339 timestamp or YYYY-MM-DD"
+// @Param        until     query  string  false  "Only feedback given or changed before this RFC 3339 timestamp or YYYY-MM-DD"
+// @Success      200  {array}   services.FeedbackReportRow
+// @Security     BearerAuth
+// @Router       /api/v1/feedback/report [get]
+func GetFeedbackReport(c *gin.Context) {
+	groupBy := c.Query("group_by")
+	switch groupBy {
+	case services.FeedbackByModel, services.FeedbackByPrompt, services.FeedbackByDocument:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group_by must be model, prompt or document"})
+		return
+	}
+
+	var filter services.FeedbackReportFilter
+	for name, target := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		raw := c.Query(name)
+		if raw == "" {
+			continue
+		}
+		t, err := parseQueryTime(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name + ", expected RFC 3339 or YYYY-MM-DD"})
+			return
+		}
+		*target = &t
+	}
+
+	userID := c.MustGet("userID").(uint)
+	rows, err := services.FeedbackReport(userID, groupBy, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build feedback report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rows)
+}
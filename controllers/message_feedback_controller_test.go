@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+)
+
+func TestMessageFeedback(t *testing.T) {
+	SetupTestDB()
+	r := GetTestRouter()
+	r.POST("/messages/:id/feedback", RateMessage)
+	r.GET("/feedback/report", GetFeedbackReport)
+
+	send := func(method, path string, payload interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	report := func(query string) []services.FeedbackReportRow {
+		w := send("GET", "/feedback/report"+query, nil)
+		assert.Equal(t, http.StatusOK, w.Code, query)
+		var rows []services.FeedbackReportRow
+		json.Unmarshal(w.Body.Bytes(), &rows)
+		return rows
+	}
+
+	handbook := models.Document{UserID: 1, Title: "Handbook"}
+	pricing := models.Document{UserID: 1, Title: "Pricing"}
+	database.DB.Create(&[]*models.Document{&handbook, &pricing})
+	conv := models.Conversation{UserID: 1, Title: "Questions"}
+	foreign := models.Conversation{UserID: 2, Title: "Theirs"}
+	database.DB.Create(&[]*models.Conversation{&conv, &foreign})
+
+	question := models.Message{ConversationID: conv.ID, Role: "user", Content: "How many days off?"}
+	good := models.Message{ConversationID: conv.ID, Role: "assistant", Content: "25 days", Model: "gpt-4o-mini", PromptVersion: "v1",
+		Citations: []models.Citation{{DocumentID: handbook.ID, FileID: 1, FileName: "a.pdf"}, {DocumentID: handbook.ID, FileID: 2, FileName: "b.pdf"}}}
+	bad := models.Message{ConversationID: conv.ID, Role: "assistant", Content: "It costs 5", Model: "gpt-4o-mini", PromptVersion: "v2",
+		Citations: []models.Citation{{DocumentID: handbook.ID, FileID: 1, FileName: "a.pdf"}, {DocumentID: pricing.ID, FileID: 3, FileName: "c.pdf"}}}
+	legacy := models.Message{ConversationID: conv.ID, Role: "assistant", Content: "Hello"}
+	theirs := models.Message{ConversationID: foreign.ID, Role: "assistant", Content: "Not yours"}
+	database.DB.Create(&[]*models.Message{&question, &good, &bad, &legacy, &theirs})
+
+	t.Run("Validation", func(t *testing.T) {
+		w := send("POST", fmt.Sprintf("/messages/%d/feedback", question.ID), map[string]interface{}{"rating": "up"})
+		assert.Equal(t, http.StatusBadRequest, w.Code, "user messages cannot be rated")
+
+		w = send("POST", fmt.Sprintf("/messages/%d/feedback", theirs.ID), map[string]interface{}{"rating": "up"})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = send("POST", fmt.Sprintf("/messages/%d/feedback", good.ID), map[string]interface{}{"rating": "meh"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = send("POST", fmt.Sprintf("/messages/%d/feedback", good.ID), map[string]interface{}{"rating": "up", "reasons": []string{"vibes"}})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Rate and re-rate", func(t *testing.T) {
+		w := send("POST", fmt.Sprintf("/messages/%d/feedback", good.ID), map[string]interface{}{"rating": "down"})
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		w = send("POST", fmt.Sprintf("/messages/%d/feedback", good.ID), map[string]interface{}{"rating": "up", "reasons": []string{"accurate", "well_sourced"}})
+		assert.Equal(t, http.StatusOK, w.Code)
+		var feedback models.MessageFeedback
+		json.Unmarshal(w.Body.Bytes(), &feedback)
+		assert.Equal(t, "up", feedback.Rating)
+		assert.Equal(t, []string{"accurate", "well_sourced"}, feedback.Reasons)
+
+		var count int64
+		database.DB.Model(&models.MessageFeedback{}).Where("message_id = ?", good.ID).Count(&count)
+		assert.Equal(t, int64(1), count)
+
+		w = send("POST", fmt.Sprintf("/messages/%d/feedback", bad.ID), map[string]interface{}{"rating": "down", "reasons": []string{"inaccurate", "outdated"}, "comment": "Prices changed"})
+		assert.Equal(t, http.StatusCreated, w.Code)
+		w = send("POST", fmt.Sprintf("/messages/%d/feedback", legacy.ID), map[string]interface{}{"rating": "up"})
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+
+	t.Run("Reports", func(t *testing.T) {
+		rows := report("?group_by=model")
+		if assert.Len(t, rows, 2) {
+			assert.Equal(t, "gpt-4o-mini", rows[0].Key)
+			assert.Equal(t, 1, rows[0].Up)
+			assert.Equal(t, 1, rows[0].Down)
+			assert.Equal(t, 0.5, rows[0].Score)
+			assert.Equal(t, map[string]int{"accurate": 1, "well_sourced": 1, "inaccurate": 1, "outdated": 1}, rows[0].Reasons)
+			assert.Equal(t, "unknown", rows[1].Key)
+		}
+
+		rows = report("?group_by=prompt")
+		if assert.Len(t, rows, 3) {
+			assert.Equal(t, []string{"unknown", "v1", "v2"}, []string{rows[0].Key, rows[1].Key, rows[2].Key})
+			assert.Equal(t, 1.0, rows[1].Score)
+			assert.Equal(t, 0.0, rows[2].Score)
+		}
+
+		rows = report("?group_by=document")
+		if assert.Len(t, rows, 2) {
+			assert.Equal(t, "Handbook", rows[0].Title)
+			assert.Equal(t, 2, rows[0].Total, "a message counts once per document it cites")
+			assert.Equal(t, "Pricing", rows[1].Title)
+			assert.Equal(t, map[string]int{"inaccurate": 1, "outdated": 1}, rows[1].Reasons)
+		}
+
+		assert.Empty(t, report("?group_by=model&since=2999-01-01"))
+		assert.Equal(t, http.StatusBadRequest, send("GET", "/feedback/report?group_by=user", nil).Code)
+		assert.Equal(t, http.StatusBadRequest, send("GET", "/feedback/report?group_by=model&until=soon", nil).Code)
+	})
+
+	t.Run("Purging a conversation removes its feedback", func(t *testing.T) {
+		database.DB.Delete(&conv)
+		_, err := services.EmptyTrash(t.Context(), 1)
+		assert.NoError(t, err)
+		var count int64
+		database.DB.Model(&models.MessageFeedback{}).Count(&count)
+		assert.Equal(t, int64(0), count)
+	})
+}
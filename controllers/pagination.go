@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"hsduc.com/rag/services"
+)
+
+// bindListParams reads cursor, limit, sort and updated_since from the query
+// string. sort may name one of sortColumns, prefixed with "-" for descending
+// order; defaultSort applies when it is absent. It writes the error response
+// itself when it fails.
+//
+// Every list endpoint pages this way except those whose results are bounded
+// or only make sense whole: the collection tree, conversation folders,
+// conversation files (at most services.MaxConversationFiles), version
+// histories, which lead with the current version, and aggregates such as tag
+// counts, facets and feedback reports.
+func bindListParams(c *gin.Context, defaultSort string, sortColumns ...string) (services.ListParams, bool) {
+	params := services.ListParams{
+		Cursor: c.Query("cursor"),
+		Limit:  services.DefaultPageSize,
+		Sort:   c.DefaultQuery("sort", defaultSort),
+	}
+
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return params, false
+		}
+		params.Limit = min(limit, services.MaxPageSize)
+	}
+
+	if !slices.Contains(sortColumns, strings.TrimPrefix(params.Sort, "-")) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sort, expected one of " + strings.Join(sortColumns, ", ") + " with an optional - prefix"})
+		return params, false
+	}
+
+	if raw := c.Query("updated_since"); raw != "" {
+		t, err := parseQueryTime(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid updated_since, expected RFC 3339 or YYYY-MM-DD"})
+			return params, false
+		}
+		params.UpdatedSince = &t
+	}
+
+	return params, true
+}
+
+// parseQueryTime accepts an RFC 3339 timestamp or a plain date.
+func parseQueryTime(raw string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Parse(time.DateOnly, raw)
+	}
+	return t, nil
+}
+
+// respondPage writes one page of a list with the cursor of the next page,
+// null on the last page, or the error of loading it.
+func respondPage(c *gin.Context, items interface{}, nextCursor string, err error, failure string) {
+	if errors.Is(err, services.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failure})
+		return
+	}
+
+	var next interface{}
+	if nextCursor != "" {
+		next = nextCursor
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "next_cursor": next})
+}
@@ -0,0 +1,276 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/dtos"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+)
+
+// @Summary      Create Prompt Template
+// @Description  Create a reusable prompt with {{variable}} placeholders. Private templates are only visible to their owner; shared ones can be used by everyone. Names are unique per user.
+// @Tags         Prompt Templates
+// @Accept       json
+// @Produce      json
+// @Param        body body dtos.PromptTemplateRequest true "Prompt Template Request"
+// @Success      201  {object}  models.PromptTemplate
+// @Security     BearerAuth
+// @Router       /api/v1/prompt-templates [post]
+func CreatePromptTemplate(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var input dtos.PromptTemplateRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tpl := models.PromptTemplate{
+		UserID:      userID,
+		Name:        strings.TrimSpace(input.Name),
+		Description: input.Description,
+		Content:     input.Content,
+		Variables:   services.TemplateVariables(input.Content),
+		Version:     1,
+		Visibility:  promptTemplateVisibility(input.Visibility),
+	}
+	if !checkPromptTemplateName(c, &tpl) {
+		return
+	}
+
+	if err := database.DB.Create(&tpl).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create prompt template"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, tpl)
+}
+
+// @Summary      Get Prompt Templates
+// @Description  List the user's own prompt templates and every shared one, one page at a time
+// @Tags         Prompt Templates
+// @Produce      json
+// @Param        visibility     query  string  false  "private or shared"
+// @Param        cursor         query  string  false  "next_cursor of the previous page"
+// @Param        limit          query  int     false  "Page size (default 50, max 100)"
+// @Param        sort           query  string  false  "name, created_at or updated_at, prefix with - for descending (default name)"
+// @Param        updated_since  query  string  false  "Only templates updated at or after this RFC 3339 timestamp or YYYY-MM-DD"
+// @Success      200  {object}  map[string]interface{}  "items and next_cursor"
+// @Security     BearerAuth
+// @Router       /api/v1/prompt-templates [get]
+func GetPromptTemplates(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	query := services.VisiblePromptTemplates(userID)
+	switch visibility := c.Query("visibility"); visibility {
+	case "":
+	case models.PromptTemplatePrivate, models.PromptTemplateShared:
+		query = query.Where("visibility = ?", visibility)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "visibility must be private or shared"})
+		return
+	}
+
+	params, ok := bindListParams(c, "name", "name", "created_at", "updated_at")
+	if !ok {
+		return
+	}
+
+	templates := []models.PromptTemplate{}
+	next, err := services.Paginate(query, "prompt_templates", params, &templates)
+	respondPage(c, templates, next, err, "Failed to fetch prompt templates")
+}
+
+// @Summary      Get Prompt Template
+// @Description  Get a prompt template the user owns or that is shared
+// @Tags         Prompt Templates
+// @Produce      json
+// @Param        id   path      string  true  "Prompt Template ID"
+// @Success      200  {object}  models.PromptTemplate
+// @Security     BearerAuth
+// @Router       /api/v1/prompt-templates/{id} [get]
+func GetPromptTemplate(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	tpl, ok := findPromptTemplate(c, userID, false)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, tpl)
+}
+
+// @Summary      Update Prompt Template
+// @Description  Replace a prompt template the user owns. A change of content is recorded as a new version.
+// @Tags         Prompt Templates
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "Prompt Template ID"
+// @Param        body body dtos.PromptTemplateRequest true "Prompt Template Request"
+// @Success      200  {object}  models.PromptTemplate
+// @Security     BearerAuth
+// @Router       /api/v1/prompt-templates/{id} [put]
+func UpdatePromptTemplate(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	tpl, ok := findPromptTemplate(c, userID, true)
+	if !ok {
+		return
+	}
+
+	var input dtos.PromptTemplateRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tpl.Name = strings.TrimSpace(input.Name)
+	tpl.Description = input.Description
+	tpl.Visibility = promptTemplateVisibility(input.Visibility)
+	if !checkPromptTemplateName(c, tpl) {
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if input.Content != tpl.Content {
+			return services.AdvancePromptTemplateVersion(tx, tpl, input.Content)
+		}
+		return tx.Save(tpl).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update prompt template"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tpl)
+}
+
+// @Summary      Delete Prompt Template
+// @Description  Permanently delete a prompt template the user owns with its version history. Messages already sent from it are kept.
+// @Tags         Prompt Templates
+// @Produce      json
+// @Param        id   path      string  true  "Prompt Template ID"
+// @Success      200  {object}  map[string]interface{}
+// @Security     BearerAuth
+// @Router       /api/v1/prompt-templates/{id} [delete]
+func DeletePromptTemplate(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	tpl, ok := findPromptTemplate(c, userID, true)
+	if !ok {
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("prompt_template_id = ?", tpl.ID).Delete(&models.PromptTemplateVersion{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(tpl).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete prompt template"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Prompt template deleted"})
+}
+
+// @Summary      Get Prompt Template Versions
+// @Description  List the version history of a prompt template, newest first
+// @Tags         Prompt Templates
+// @Produce      json
+// @Param        id   path      string  true  "Prompt Template ID"
+// @Success      200  {array}   models.PromptTemplateVersion
+// @Security     BearerAuth
+// @Router       /api/v1/prompt-templates/{id}/versions [get]
+func GetPromptTemplateVersions(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	tpl, ok := findPromptTemplate(c, userID, false)
+	if !ok {
+		return
+	}
+
+	var versions []models.PromptTemplateVersion
+	if err := database.DB.Where("prompt_template_id = ?", tpl.ID).Order("version desc").Find(&versions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve prompt template versions"})
+		return
+	}
+
+	// The current version lives on the template itself
+	c.JSON(http.StatusOK, append([]models.PromptTemplateVersion{services.CurrentPromptTemplateVersion(tpl)}, versions...))
+}
+
+// findPromptTemplate loads the template in the :id path parameter if userID
+// can see it, or, with owned, change it. It writes the error response itself
+// when it fails.
+func findPromptTemplate(c *gin.Context, userID uint, owned bool) (*models.PromptTemplate, bool) {
+	var tpl models.PromptTemplate
+	if err := services.VisiblePromptTemplates(userID).Where("id = ?", c.Param("id")).First(&tpl).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Prompt template not found"})
+		return nil, false
+	}
+	if owned && tpl.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner can change a prompt template"})
+		return nil, false
+	}
+	return &tpl, true
+}
+
+// checkPromptTemplateName verifies that tpl has a name no other template of
+// the same user uses. It writes the error response itself when the check
+// fails.
+func checkPromptTemplateName(c *gin.Context, tpl *models.PromptTemplate) bool {
+	if tpl.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Prompt template name must not be empty"})
+		return false
+	}
+
+	var count int64
+	err := database.DB.Model(&models.PromptTemplate{}).
+		Where("user_id = ? AND name = ? AND id <> ?", tpl.UserID, tpl.Name, tpl.ID).
+		Count(&count).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up prompt template"})
+		return false
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A prompt template with this name already exists"})
+		return false
+	}
+	return true
+}
+
+func promptTemplateVisibility(visibility string) string {
+	if visibility == "" {
+		return models.PromptTemplatePrivate
+	}
+	return visibility
+}
+
+// renderPromptTemplate writes the content of a message sent from a template.
+// It writes the error response itself when it fails.
+func renderPromptTemplate(c *gin.Context, userID uint, input *dtos.CreateMessageRequest) (string, bool) {
+	var tpl models.PromptTemplate
+	if err := services.VisiblePromptTemplates(userID).Where("id = ?", *input.TemplateID).First(&tpl).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Prompt template not found"})
+		return "", false
+	}
+
+	content := tpl.Content
+	if input.TemplateVersion != 0 {
+		var err error
+		if content, err = services.PromptTemplateVersionContent(&tpl, input.TemplateVersion); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Prompt template version not found"})
+			return "", false
+		}
+	}
+
+	rendered, err := services.RenderTemplate(content, input.Variables)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return rendered, true
+}
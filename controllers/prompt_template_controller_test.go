@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+)
+
+func TestPromptTemplates(t *testing.T) {
+	SetupTestDB()
+	router := func(userID uint) *gin.Engine {
+		r := GetTestRouterAs(userID)
+		r.POST("/prompt-templates", CreatePromptTemplate)
+		r.GET("/prompt-templates", GetPromptTemplates)
+		r.GET("/prompt-templates/:id", GetPromptTemplate)
+		r.PUT("/prompt-templates/:id", UpdatePromptTemplate)
+		r.DELETE("/prompt-templates/:id", DeletePromptTemplate)
+		r.GET("/prompt-templates/:id/versions", GetPromptTemplateVersions)
+		r.POST("/messages", CreateMessage)
+		return r
+	}
+	owner, colleague := router(1), router(2)
+
+	send := func(r *gin.Engine, method, path string, payload interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	names := func(r *gin.Engine, query string) []string {
+		w := send(r, "GET", "/prompt-templates"+query, nil)
+		assert.Equal(t, http.StatusOK, w.Code, query)
+		var page struct {
+			Items []models.PromptTemplate `json:"items"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &page)
+		list := []string{}
+		for _, tpl := range page.Items {
+			list = append(list, tpl.Name)
+		}
+		return list
+	}
+
+	var greeting, notes models.PromptTemplate
+	t.Run("Create", func(t *testing.T) {
+		w := send(owner, "POST", "/prompt-templates", map[string]interface{}{
+			"name":       "Greeting",
+			"content":    "Write a reply to {{customer_name}} about order {{ order_id }}. Sign as {{customer_name}}'s agent.",
+			"visibility": "shared",
+		})
+		assert.Equal(t, http.StatusCreated, w.Code)
+		json.Unmarshal(w.Body.Bytes(), &greeting)
+		assert.Equal(t, []string{"customer_name", "order_id"}, greeting.Variables)
+		assert.Equal(t, 1, greeting.Version)
+
+		w = send(owner, "POST", "/prompt-templates", map[string]interface{}{"name": "Notes", "content": "Summarize the call"})
+		assert.Equal(t, http.StatusCreated, w.Code)
+		json.Unmarshal(w.Body.Bytes(), &notes)
+		assert.Equal(t, models.PromptTemplatePrivate, notes.Visibility)
+
+		w = send(owner, "POST", "/prompt-templates", map[string]interface{}{"name": "Notes", "content": "Again"})
+		assert.Equal(t, http.StatusConflict, w.Code)
+		w = send(owner, "POST", "/prompt-templates", map[string]interface{}{"name": "Public", "content": "x", "visibility": "everyone"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Visibility", func(t *testing.T) {
+		assert.Equal(t, []string{"Greeting", "Notes"}, names(owner, ""))
+		assert.Equal(t, []string{"Notes"}, names(owner, "?visibility=private"))
+		assert.Equal(t, []string{"Greeting"}, names(colleague, ""))
+
+		assert.Equal(t, http.StatusOK, send(colleague, "GET", fmt.Sprintf("/prompt-templates/%d", greeting.ID), nil).Code)
+		assert.Equal(t, http.StatusNotFound, send(colleague, "GET", fmt.Sprintf("/prompt-templates/%d", notes.ID), nil).Code)
+		w := send(colleague, "PUT", fmt.Sprintf("/prompt-templates/%d", greeting.ID), map[string]interface{}{"name": "Mine", "content": "x"})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, http.StatusForbidden, send(colleague, "DELETE", fmt.Sprintf("/prompt-templates/%d", greeting.ID), nil).Code)
+	})
+
+	t.Run("Versioning", func(t *testing.T) {
+		w := send(owner, "PUT", fmt.Sprintf("/prompt-templates/%d", greeting.ID), map[string]interface{}{
+			"name": "Greeting", "content": "Greet {{customer_name}} warmly.", "visibility": "shared",
+		})
+		assert.Equal(t, http.StatusOK, w.Code)
+		var updated models.PromptTemplate
+		json.Unmarshal(w.Body.Bytes(), &updated)
+		assert.Equal(t, 2, updated.Version)
+		assert.Equal(t, []string{"customer_name"}, updated.Variables)
+
+		w = send(owner, "PUT", fmt.Sprintf("/prompt-templates/%d", greeting.ID), map[string]interface{}{
+			"name": "Greeting", "description": "For first replies", "content": "Greet {{customer_name}} warmly.", "visibility": "shared",
+		})
+		json.Unmarshal(w.Body.Bytes(), &updated)
+		assert.Equal(t, 2, updated.Version, "only content changes make a new version")
+
+		w = send(colleague, "GET", fmt.Sprintf("/prompt-templates/%d/versions", greeting.ID), nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var versions []models.PromptTemplateVersion
+		json.Unmarshal(w.Body.Bytes(), &versions)
+		if assert.Len(t, versions, 2) {
+			assert.Equal(t, 2, versions[0].Version)
+			assert.Equal(t, 1, versions[1].Version)
+			assert.Equal(t, []string{"customer_name", "order_id"}, versions[1].Variables)
+		}
+	})
+
+	t.Run("Send a message from a template", func(t *testing.T) {
+		conv := models.Conversation{UserID: 2, Title: "Support"}
+		database.DB.Create(&conv)
+		message := func(payload map[string]interface{}) *httptest.ResponseRecorder {
+			payload["conversation_id"] = conv.ID
+			payload["role"] = "user"
+			return send(colleague, "POST", "/messages", payload)
+		}
+		content := func(w *httptest.ResponseRecorder) string {
+			var body struct {
+				UserMessage models.Message `json:"user_message"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &body)
+			return body.UserMessage.Content
+		}
+
+		w := message(map[string]interface{}{"template_id": greeting.ID, "variables": map[string]string{"customer_name": "Ada"}})
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "Greet Ada warmly.", content(w))
+
+		w = message(map[string]interface{}{"template_id": greeting.ID, "template_version": 1, "variables": map[string]string{"customer_name": "Ada", "order_id": "42"}})
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "Write a reply to Ada about order 42. Sign as Ada's agent.", content(w))
+
+		w = message(map[string]interface{}{"template_id": greeting.ID, "template_version": 1, "variables": map[string]string{"customer_name": "Ada"}})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "order_id")
+
+		assert.Equal(t, http.StatusNotFound, message(map[string]interface{}{"template_id": greeting.ID, "template_version": 7}).Code)
+		assert.Equal(t, http.StatusNotFound, message(map[string]interface{}{"template_id": notes.ID}).Code, "private templates of others cannot be used")
+		assert.Equal(t, http.StatusBadRequest, message(map[string]interface{}{"template_id": greeting.ID, "content": "Both"}).Code)
+		assert.Equal(t, http.StatusBadRequest, message(map[string]interface{}{}).Code)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, send(owner, "DELETE", fmt.Sprintf("/prompt-templates/%d", greeting.ID), nil).Code)
+		assert.Equal(t, http.StatusNotFound, send(owner, "GET", fmt.Sprintf("/prompt-templates/%d", greeting.ID), nil).Code)
+		var count int64
+		database.DB.Model(&models.PromptTemplateVersion{}).Where("prompt_template_id = ?", greeting.ID).Count(&count)
+		assert.Equal(t, int64(0), count)
+	})
+}
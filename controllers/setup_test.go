@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"context"
+	"testing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
@@ -9,6 +10,7 @@ import (
 	"gorm.io/gorm"
 	"hsduc.com/rag/database"
 	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
 )
 
 func SetupTestDB() {
@@ -17,8 +19,9 @@ func SetupTestDB() {
 	if err != nil {
 		panic("Failed to connect database")
 	}
-	db.Migrator().DropTable(&models.Conversation{}, &models.Message{})
-	db.AutoMigrate(&models.Conversation{}, &models.Message{})
+	db.Migrator().DropTable(&models.User{}, &models.Conversation{}, &models.Message{}, &models.Document{}, &models.DocumentFile{}, &models.DocumentFileVersion{}, &models.DocumentSource{}, &models.DocumentLabel{}, &models.Collection{}, &models.Group{}, &models.GroupMember{}, &models.DocumentShare{}, &models.ConversationShare{}, &models.DataExport{}, &models.ConversationFolder{}, &models.ConversationTag{}, &models.MessageFeedback{}, &models.PromptTemplate{}, &models.PromptTemplateVersion{}, &models.Assistant{}, &models.MessageAttachment{}, &models.ConversationFile{}, &models.ConversationFileChunk{}, &models.DocumentFileChunk{})
+	db.AutoMigrate(&models.User{}, &models.Conversation{}, &models.Message{}, &models.Document{}, &models.DocumentFile{}, &models.DocumentFileVersion{}, &models.DocumentSource{}, &models.DocumentLabel{}, &models.Collection{}, &models.Group{}, &models.GroupMember{}, &models.DocumentShare{}, &models.ConversationShare{}, &models.DataExport{}, &models.ConversationFolder{}, &models.ConversationTag{}, &models.MessageFeedback{}, &models.PromptTemplate{}, &models.PromptTemplateVersion{}, &models.Assistant{}, &models.MessageAttachment{}, &models.ConversationFile{}, &models.ConversationFileChunk{}, &models.DocumentFileChunk{})
+	database.EnsureSearchIndexes(db)
 	database.DB = db
 
 	// Initialize mock redis (using go-redis mock or just simple connect if available)
@@ -32,13 +35,33 @@ func SetupTestDB() {
 
 	// Just testing the ping so we know if it's there
 	_, _ = database.Redis.Ping(context.Background()).Result()
+
+	// Upload, crawl and object locks are kept in memory so they work without Redis
+	services.Locks = services.NewLocalLocker()
+}
+
+// SetupTestStorage points the storage service at a temporary local directory
+// for the duration of the test.
+func SetupTestStorage(t *testing.T) *services.LocalStorage {
+	store, err := services.NewLocalStorage(t.TempDir(), "http://localhost:8080/storage", []byte("test-signing-key"))
+	if err != nil {
+		t.Fatalf("Failed to create local storage: %v", err)
+	}
+	services.Store = store
+	t.Cleanup(func() { services.Store = nil })
+	return store
 }
 
 func GetTestRouter() *gin.Engine {
+	return GetTestRouterAs(1)
+}
+
+// GetTestRouterAs returns a router whose requests are authenticated as userID.
+func GetTestRouterAs(userID uint) *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	r := gin.Default()
 	r.Use(func(c *gin.Context) {
-		c.Set("userID", uint(1))
+		c.Set("userID", userID)
 		c.Next()
 	})
 	return r
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"hsduc.com/rag/services"
+)
+
+// @Summary      Download Local Object
+// @Description  Serve an object from local storage using a signed URL issued by the API
+// @Tags         Storage
+// @Param        key        path   string  true  "Object key"
+// @Param        expires    query  string  true  "Expiry as a Unix timestamp"
+// @Param        signature  query  string  true  "URL signature"
+// @Success      200
+// @Router       /storage/{key} [get]
+func ServeLocalObject(c *gin.Context) {
+	key, ok := verifyLocalObjectURL(c)
+	if !ok {
+		return
+	}
+
+	serveObject(c, key, path.Base(key), "", "", time.Time{})
+}
+
+// @Summary      Upload Local Object
+// @Description  Store an object in local storage using a signed upload URL issued by the API
+// @Tags         Storage
+// @Accept       application/octet-stream
+// @Produce      json
+// @Param        key        path   string  true  "Object key"
+// @Param        expires    query  string  true  "Expiry as a Unix timestamp"
+// @Param        signature  query  string  true  "URL signature"
+// @Success      200  {object}  map[string]string
+// @Router       /storage/{key} [put]
+func UploadLocalObject(c *gin.Context) {
+	key, ok := verifyLocalObjectURL(c)
+	if !ok {
+		return
+	}
+
+	contentType := c.GetHeader("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	if err := services.UploadFile(c.Request.Context(), key, contentType, c.Request.Body, c.Request.ContentLength); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store object"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Object stored"})
+}
+
+// verifyLocalObjectURL checks the signature of a local storage URL and returns
+// the object key. It writes the error response itself when it fails.
+func verifyLocalObjectURL(c *gin.Context) (string, bool) {
+	local, ok := services.Store.(*services.LocalStorage)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Local storage is not enabled"})
+		return "", false
+	}
+
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if !local.VerifySignature(c.Request.Method, key, c.Query("expires"), c.Query("signature")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired signature"})
+		return "", false
+	}
+
+	return key, true
+}
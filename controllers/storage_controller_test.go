@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeLocalObject(t *testing.T) {
+	store := SetupTestStorage(t)
+	content := []byte("%PDF-1.7 signed download")
+	store.Put(context.Background(), "documents/1/1_manual.pdf", "application/pdf", bytes.NewReader(content), int64(len(content)))
+
+	r := GetTestRouter()
+	r.GET("/storage/*key", ServeLocalObject)
+
+	signed, _ := store.PresignGet(context.Background(), "documents/1/1_manual.pdf", time.Minute)
+	u, _ := url.Parse(signed)
+
+	req, _ := http.NewRequest("GET", u.RequestURI(), nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+	assert.Equal(t, content, w.Body.Bytes())
+
+	// Tampering with the key invalidates the signature
+	req, _ = http.NewRequest("GET", "/storage/documents/1/2_other.pdf?"+u.RawQuery, nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestUploadLocalObject(t *testing.T) {
+	store := SetupTestStorage(t)
+
+	r := GetTestRouter()
+	r.PUT("/storage/*key", UploadLocalObject)
+
+	signed, _ := store.PresignPut(context.Background(), "documents/1/1_notes.txt", time.Minute)
+	u, _ := url.Parse(signed)
+
+	req, _ := http.NewRequest("PUT", u.RequestURI(), bytes.NewBufferString("direct upload"))
+	req.Header.Set("Content-Type", "text/plain")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	info, err := store.Stat(context.Background(), "documents/1/1_notes.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len("direct upload")), info.Size)
+
+	// A download signature cannot be used to upload
+	download, _ := store.PresignGet(context.Background(), "documents/1/1_notes.txt", time.Minute)
+	u, _ = url.Parse(download)
+	req, _ = http.NewRequest("PUT", u.RequestURI(), bytes.NewBufferString("overwrite"))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"hsduc.com/rag/services"
+)
+
+// @Summary      Get Trash
+// @Description  List the deleted conversations, messages, documents and files that can still be restored one page at a time, most recently deleted first by default, with when each will be purged for good
+// @Tags         Trash
+// @Produce      json
+// @Param        cursor         query  string  false  "next_cursor of the previous page"
+// @Param        limit          query  int     false  "Page size (default 50, max 100)"
+// @Param        sort           query  string  false  "deleted_at, prefix with - for descending (default -deleted_at)"
+// @Param        updated_since  query  string  false  "Only items deleted at or after this RFC 3339 timestamp or YYYY-MM-DD"
+// @Success      200  {object}  map[string]interface{}  "items and next_cursor"
+// @Security     BearerAuth
+// @Router       /api/v1/trash [get]
+func GetTrash(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	params, ok := bindListParams(c, "-deleted_at", "deleted_at")
+	if !ok {
+		return
+	}
+
+	items, next, err := services.ListTrash(userID, params)
+	respondPage(c, items, next, err, "Failed to fetch trash")
+}
+
+// @Summary      Restore From Trash
+// @Description  Restore a deleted item. A document comes back with the files deleted along with it; a message or file can only be restored while its conversation or document is not in the trash.
+// @Tags         Trash
+// @Produce      json
+// @Param        kind  path  string  true  "conversations, messages, documents or files"
+// @Param        id    path  int     true  "Item ID"
+// @Success      200  {object}  map[string]interface{}
+// @Security     BearerAuth
+// @Router       /api/v1/trash/{kind}/{id}/restore [post]
+func RestoreTrashItem(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var restored interface{}
+	switch c.Param("kind") {
+	case services.TrashConversations:
+		restored, err = services.RestoreConversation(userID, uint(id))
+	case services.TrashMessages:
+		restored, err = services.RestoreMessage(userID, uint(id))
+	case services.TrashDocuments:
+		restored, err = services.RestoreDocument(userID, uint(id))
+	case services.TrashFiles:
+		restored, err = services.RestoreFile(userID, uint(id))
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown item kind"})
+		return
+	}
+
+	switch {
+	case errors.Is(err, services.ErrNotInTrash):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found in trash"})
+	case errors.Is(err, services.ErrParentInTrash):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrStorageQuotaReached):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore item"})
+	default:
+		c.JSON(http.StatusOK, restored)
+	}
+}
+
+// @Summary      Empty Trash
+// @Description  Permanently delete everything in the trash now. This cannot be undone.
+// @Tags         Trash
+// @Produce      json
+// @Success      200  {object}  map[string]interface{}
+// @Security     BearerAuth
+// @Router       /api/v1/trash [delete]
+func EmptyTrash(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	removed, err := services.EmptyTrash(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to empty trash"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Trash emptied", "deleted": removed})
+}
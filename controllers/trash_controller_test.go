@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"hsduc.com/rag/config"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+)
+
+func TestTrash(t *testing.T) {
+	SetupTestDB()
+	SetupTestStorage(t)
+	config.App = &config.Config{TrashRetentionDays: 30}
+	ctx := context.Background()
+
+	r := GetTestRouter()
+	r.DELETE("/conversations/:id", DeleteConversation)
+	r.DELETE("/messages/:id", DeleteMessage)
+	r.DELETE("/documents/:id", DeleteDocument)
+	r.DELETE("/documents/:id/files/:fileId", DeleteDocumentFile)
+	r.GET("/trash", GetTrash)
+	r.DELETE("/trash", EmptyTrash)
+	r.POST("/trash/:kind/:id/restore", RestoreTrashItem)
+
+	send := func(method, path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	trash := func() []services.TrashItem {
+		var page struct {
+			Items []services.TrashItem `json:"items"`
+		}
+		json.Unmarshal(send("GET", "/trash").Body.Bytes(), &page)
+		return page.Items
+	}
+	kinds := func(items []services.TrashItem) []string {
+		names := []string{}
+		for _, item := range items {
+			names = append(names, item.Kind+":"+item.Title)
+		}
+		return names
+	}
+	count := func(model interface{}, id uint) int64 {
+		var n int64
+		database.DB.Unscoped().Model(model).Where("id = ?", id).Count(&n)
+		return n
+	}
+
+	old := models.Conversation{UserID: 1, Title: "Old chat"}
+	kept := models.Conversation{UserID: 1, Title: "Kept chat"}
+	database.DB.Create(&[]*models.Conversation{&old, &kept})
+	oldMsg := models.Message{ConversationID: old.ID, Role: "user", Content: "Goes with the chat"}
+	typo := models.Message{ConversationID: kept.ID, Role: "user", Content: "Typo"}
+	database.DB.Create(&[]*models.Message{&oldMsg, &typo})
+
+	doc := models.Document{UserID: 1, Title: "Report", Tags: []string{"finance"}}
+	database.DB.Create(&doc)
+	var files []models.DocumentFile
+	for _, name := range []string{"draft.txt", "final.txt"} {
+		file := models.DocumentFile{DocumentID: doc.ID, FileName: name, ObjectKey: services.BuildObjectKey(doc.ID, name), ContentType: "text/plain", Size: 4}
+		assert.NoError(t, services.UploadFile(ctx, file.ObjectKey, "text/plain", strings.NewReader("data"), 4))
+		database.DB.Create(&file)
+		files = append(files, file)
+	}
+	draft, final := files[0], files[1]
+
+	t.Run("Deleted items are listed", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, send("DELETE", fmt.Sprintf("/messages/%d", typo.ID)).Code)
+		assert.Equal(t, http.StatusOK, send("DELETE", fmt.Sprintf("/conversations/%d", old.ID)).Code)
+		assert.Equal(t, http.StatusOK, send("DELETE", fmt.Sprintf("/documents/%d/files/%d", doc.ID, draft.ID)).Code)
+		time.Sleep(5 * time.Millisecond)
+		assert.Equal(t, http.StatusOK, send("DELETE", fmt.Sprintf("/documents/%d", doc.ID)).Code)
+
+		items := trash()
+		assert.Equal(t, []string{"documents:Report", "conversations:Old chat", "messages:Typo"}, kinds(items))
+		if assert.NotNil(t, items[0].PurgeAt) {
+			assert.WithinDuration(t, items[0].DeletedAt.Add(30*24*time.Hour), *items[0].PurgeAt, time.Second)
+		}
+
+		walk := func(query string) []string {
+			var walked []services.TrashItem
+			path := "/trash?" + query
+			for range 5 {
+				var page struct {
+					Items      []services.TrashItem `json:"items"`
+					NextCursor *string              `json:"next_cursor"`
+				}
+				w := send("GET", path)
+				assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+				json.Unmarshal(w.Body.Bytes(), &page)
+				walked = append(walked, page.Items...)
+				if page.NextCursor == nil {
+					break
+				}
+				path = "/trash?" + query + "&cursor=" + *page.NextCursor
+			}
+			return kinds(walked)
+		}
+		assert.Equal(t, kinds(items), walk("limit=2"), "pages follow the same order")
+		assert.Equal(t, []string{"messages:Typo", "conversations:Old chat", "documents:Report"}, walk("limit=1&sort=deleted_at"))
+
+		_, err := services.StatFile(ctx, final.ObjectKey)
+		assert.NoError(t, err, "storage is kept while in the trash")
+	})
+
+	t.Run("Restore a document with the files deleted along with it", func(t *testing.T) {
+		w := send("POST", fmt.Sprintf("/trash/files/%d/restore", draft.ID))
+		assert.Equal(t, http.StatusConflict, w.Code, "the document is still in the trash")
+
+		w = send("POST", fmt.Sprintf("/trash/documents/%d/restore", doc.ID))
+		assert.Equal(t, http.StatusOK, w.Code)
+		var restored models.Document
+		json.Unmarshal(w.Body.Bytes(), &restored)
+		if assert.Len(t, restored.Files, 1) {
+			assert.Equal(t, "final.txt", restored.Files[0].FileName)
+		}
+
+		var labels int64
+		database.DB.Model(&models.DocumentLabel{}).Where("document_id = ? AND name = ?", doc.ID, "finance").Count(&labels)
+		assert.Equal(t, int64(1), labels, "labels are indexed again")
+		assert.Equal(t, []string{"files:draft.txt", "conversations:Old chat", "messages:Typo"}, kinds(trash()))
+	})
+
+	t.Run("Restore conversations and messages", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, send("POST", fmt.Sprintf("/trash/messages/%d/restore", typo.ID)).Code)
+		assert.Equal(t, http.StatusOK, send("POST", fmt.Sprintf("/trash/conversations/%d/restore", old.ID)).Code)
+		assert.Equal(t, http.StatusNotFound, send("POST", fmt.Sprintf("/trash/conversations/%d/restore", old.ID)).Code)
+		assert.Equal(t, http.StatusNotFound, send("POST", "/trash/groups/1/restore").Code)
+		assert.Equal(t, []string{"files:draft.txt"}, kinds(trash()))
+	})
+
+	t.Run("Purge after the retention period", func(t *testing.T) {
+		database.DB.Unscoped().Model(&models.DocumentFile{}).Where("id = ?", draft.ID).Update("deleted_at", time.Now().Add(-31*24*time.Hour))
+
+		removed, err := services.PurgeTrash(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, removed)
+		assert.Equal(t, int64(0), count(&models.DocumentFile{}, draft.ID))
+		_, err = services.StatFile(ctx, draft.ObjectKey)
+		assert.Error(t, err)
+		_, err = services.StatFile(ctx, final.ObjectKey)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Empty trash", func(t *testing.T) {
+		send("DELETE", fmt.Sprintf("/conversations/%d", old.ID))
+		w := send("DELETE", "/trash")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, int64(0), count(&models.Conversation{}, old.ID))
+		assert.Equal(t, int64(0), count(&models.Message{}, oldMsg.ID))
+		assert.Equal(t, int64(1), count(&models.Conversation{}, kept.ID))
+		assert.Empty(t, trash())
+	})
+}
+
+func TestTrashPagesItemsDeletedTogether(t *testing.T) {
+	SetupTestDB()
+	config.App = &config.Config{}
+
+	r := GetTestRouter()
+	r.GET("/trash", GetTrash)
+
+	deletedAt := gorm.DeletedAt{Time: time.Now().Truncate(time.Second), Valid: true}
+	kept := models.Conversation{UserID: 1, Title: "Kept"}
+	database.DB.Create(&kept)
+	doc := models.Document{UserID: 1, Title: "Kept"}
+	database.DB.Create(&doc)
+	for i := range 3 {
+		database.DB.Create(&models.Conversation{UserID: 1, Title: fmt.Sprint("chat ", i), DeletedAt: deletedAt})
+		database.DB.Create(&models.Message{ConversationID: kept.ID, Role: "user", Content: fmt.Sprint("message ", i), DeletedAt: deletedAt})
+		database.DB.Create(&models.Document{UserID: 1, Title: fmt.Sprint("doc ", i), DeletedAt: deletedAt})
+		database.DB.Create(&models.DocumentFile{DocumentID: doc.ID, FileName: fmt.Sprint("file ", i), ObjectKey: "k", DeletedAt: deletedAt})
+	}
+
+	walk := func(query string) []string {
+		var walked []string
+		path := "/trash?" + query
+		for range 20 {
+			var page struct {
+				Items      []services.TrashItem `json:"items"`
+				NextCursor *string              `json:"next_cursor"`
+			}
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", path, nil)
+			r.ServeHTTP(w, req)
+			json.Unmarshal(w.Body.Bytes(), &page)
+			for _, item := range page.Items {
+				walked = append(walked, item.Kind+":"+item.Title)
+			}
+			if page.NextCursor == nil {
+				break
+			}
+			path = "/trash?" + query + "&cursor=" + *page.NextCursor
+		}
+		return walked
+	}
+
+	asc := walk("limit=5&sort=deleted_at")
+	assert.Equal(t, []string{
+		"conversations:chat 0", "conversations:chat 1", "conversations:chat 2",
+		"documents:doc 0", "documents:doc 1", "documents:doc 2",
+		"files:file 0", "files:file 1", "files:file 2",
+		"messages:message 0", "messages:message 1", "messages:message 2",
+	}, asc)
+	desc := walk("limit=2")
+	slices.Reverse(desc)
+	assert.Equal(t, asc, desc)
+}
@@ -0,0 +1,284 @@
+package controllers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/dtos"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/services"
+	"hsduc.com/rag/utils"
+)
+
+// @Summary      Create Resumable Upload
+// @Description  Start a resumable upload for a document file; chunks are then sent with PATCH
+// @Tags         Uploads
+// @Accept       json
+// @Produce      json
+// @Param        id    path  int  true  "Document ID"
+// @Param        body  body  dtos.InitiateUploadRequest  true  "Upload Request"
+// @Success      201   {object}  dtos.UploadSessionResponse
+// @Security     BearerAuth
+// @Router       /api/v1/documents/{id}/uploads [post]
+func CreateUpload(c *gin.Context) {
+	userID := c.GetUint("userID")
+	doc, ok := findDocument(c, userID, services.RoleEditor)
+	if !ok {
+		return
+	}
+
+	var input dtos.InitiateUploadRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := services.ValidateUploadSize(doc.UserID, input.Size); err != nil {
+		respondUploadError(c, err, "Failed to check storage quota")
+		return
+	}
+
+	// Replaced by the sniffed type once the first chunk arrives
+	contentType := input.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	session := services.UploadSession{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		DocumentID:  doc.ID,
+		FileName:    input.FileName,
+		ContentType: contentType,
+		Size:        input.Size,
+		CreatedAt:   time.Now(),
+	}
+	if err := services.SaveUploadSession(c.Request.Context(), &session); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to create upload"})
+		return
+	}
+
+	c.Header("Location", fmt.Sprintf("/api/v1/documents/%d/uploads/%s", doc.ID, session.ID))
+	c.JSON(http.StatusCreated, uploadSessionResponse(&session))
+}
+
+// @Summary      Get Upload Offset
+// @Description  Get how many bytes of a resumable upload the server has received
+// @Tags         Uploads
+// @Param        id        path  int     true  "Document ID"
+// @Param        uploadId  path  string  true  "Upload ID"
+// @Success      200
+// @Header       200  {integer}  Upload-Offset  "Bytes received so far"
+// @Header       200  {integer}  Upload-Length  "Total size of the upload"
+// @Security     BearerAuth
+// @Router       /api/v1/documents/{id}/uploads/{uploadId} [head]
+func GetUploadOffset(c *gin.Context) {
+	session, ok := findUploadSession(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(session.Size, 10))
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+}
+
+// @Summary      Upload Chunk
+// @Description  Append a chunk to a resumable upload at the given offset; the final chunk attaches the file to the document
+// @Tags         Uploads
+// @Accept       application/offset+octet-stream
+// @Produce      json
+// @Param        id             path    int     true  "Document ID"
+// @Param        uploadId       path    string  true  "Upload ID"
+// @Param        Upload-Offset  header  int     true  "Offset of this chunk"
+// @Success      201  {object}  models.DocumentFile
+// @Success      204
+// @Security     BearerAuth
+// @Router       /api/v1/documents/{id}/uploads/{uploadId} [patch]
+func UploadChunk(c *gin.Context) {
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Offset header is required"})
+		return
+	}
+	length := c.Request.ContentLength
+	if length <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Content-Length header is required"})
+		return
+	}
+
+	session, ok := findUploadSession(c)
+	if !ok {
+		return
+	}
+
+	unlock, err := services.LockUploadSession(c.Request.Context(), session.ID)
+	if errors.Is(err, services.ErrUploadLocked) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload is locked by another request"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to lock upload"})
+		return
+	}
+	defer unlock()
+
+	// Reload under the lock so the offset reflects any chunk that finished meanwhile
+	session, err = services.GetUploadSession(c.Request.Context(), session.ID)
+	if err != nil {
+		respondUploadSessionError(c, err)
+		return
+	}
+
+	if offset != session.Offset {
+		c.Header("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload-Offset does not match the current offset"})
+		return
+	}
+	if offset+length > session.Size {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Chunk exceeds the declared upload size"})
+		return
+	}
+
+	// Access and quota were checked when the upload started, possibly hours ago.
+	// Checking again before the final chunk is stored lets the client retry it.
+	if offset+length == session.Size {
+		doc, ok := findDocument(c, session.UserID, services.RoleEditor)
+		if !ok {
+			return
+		}
+		if err := services.ValidateStorageQuota(doc.UserID, session.Size); err != nil {
+			respondUploadError(c, err, "Failed to check storage quota")
+			return
+		}
+	}
+
+	body := io.Reader(c.Request.Body)
+	if offset == 0 {
+		buffered := bufio.NewReaderSize(c.Request.Body, utils.SniffLength)
+		head, _ := buffered.Peek(utils.SniffLength)
+		contentType, err := services.ValidateContentType(head, session.FileName)
+		if err != nil {
+			respondUploadError(c, err, "Failed to read chunk")
+			return
+		}
+		session.ContentType = contentType
+		body = buffered
+	}
+
+	if err := services.AppendUploadChunk(c.Request.Context(), session, body, length); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store chunk"})
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	if session.Offset < session.Size {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	objectKey, err := services.FinishUploadSession(c.Request.Context(), session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assemble file"})
+		return
+	}
+	objectKey, contentHash, release, err := services.DedupeStoredObject(c.Request.Context(), objectKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read assembled file"})
+		return
+	}
+
+	docFile := models.DocumentFile{
+		DocumentID:  session.DocumentID,
+		FileName:    session.FileName,
+		ObjectKey:   objectKey,
+		ContentType: session.ContentType,
+		Size:        session.Size,
+		ContentHash: contentHash,
+	}
+	err = database.DB.Create(&docFile).Error
+	release()
+	if err != nil {
+		// The object may be shared with an earlier upload of the same content
+		_ = deleteDocumentFileFromStorage(c.Request.Context(), objectKey)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file record"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, docFile)
+}
+
+// @Summary      Cancel Resumable Upload
+// @Description  Abort a resumable upload and discard the received chunks
+// @Tags         Uploads
+// @Produce      json
+// @Param        id        path  int     true  "Document ID"
+// @Param        uploadId  path  string  true  "Upload ID"
+// @Success      200  {object}  map[string]string
+// @Security     BearerAuth
+// @Router       /api/v1/documents/{id}/uploads/{uploadId} [delete]
+func CancelUpload(c *gin.Context) {
+	session, ok := findUploadSession(c)
+	if !ok {
+		return
+	}
+
+	if err := services.AbortUploadSession(c.Request.Context(), session); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel upload"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Upload cancelled"})
+}
+
+// findUploadSession loads the upload named in the path and checks it belongs to
+// the caller and document. It writes the error response itself when it fails.
+func findUploadSession(c *gin.Context) (*services.UploadSession, bool) {
+	userID := c.GetUint("userID")
+	docID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+		return nil, false
+	}
+
+	session, err := services.GetUploadSession(c.Request.Context(), c.Param("uploadId"))
+	if err != nil {
+		respondUploadSessionError(c, err)
+		return nil, false
+	}
+	if session.UserID != userID || session.DocumentID != uint(docID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return nil, false
+	}
+
+	return session, true
+}
+
+// respondUploadSessionError writes 404 for an upload that expired or never
+// existed and 503 when Redis, which holds the sessions, fails.
+func respondUploadSessionError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrUploadNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return
+	}
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to load upload"})
+}
+
+func uploadSessionResponse(s *services.UploadSession) dtos.UploadSessionResponse {
+	return dtos.UploadSessionResponse{
+		ID:        s.ID,
+		FileName:  s.FileName,
+		Size:      s.Size,
+		Offset:    s.Offset,
+		ExpiresAt: s.ExpiresAt.Format(time.RFC3339),
+	}
+}
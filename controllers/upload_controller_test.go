@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"hsduc.com/rag/database"
+)
+
+func TestUploadChunk(t *testing.T) {
+	tests := []struct {
+		name           string
+		headers        map[string]string
+		body           []byte
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "Error - Missing Upload-Offset",
+			body:           []byte("chunk"),
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Upload-Offset header is required",
+		},
+		{
+			name:           "Error - Negative Upload-Offset",
+			headers:        map[string]string{"Upload-Offset": "-5"},
+			body:           []byte("chunk"),
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Upload-Offset header is required",
+		},
+		{
+			name:           "Error - Empty chunk",
+			headers:        map[string]string{"Upload-Offset": "0"},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Content-Length header is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetupTestDB()
+			r := GetTestRouter()
+			r.PATCH("/documents/:id/uploads/:uploadId", UploadChunk)
+
+			req, _ := http.NewRequest("PATCH", "/documents/1/uploads/abc", bytes.NewBuffer(tt.body))
+			req.Header.Set("Content-Type", "application/offset+octet-stream")
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			var response map[string]string
+			json.Unmarshal(w.Body.Bytes(), &response)
+			assert.Equal(t, tt.expectedError, response["error"])
+		})
+	}
+}
+
+func TestUploadSessionRedisUnavailable(t *testing.T) {
+	SetupTestDB()
+	// Nothing listens on port 1, so every session lookup fails
+	database.Redis = redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+
+	r := GetTestRouter()
+	r.HEAD("/documents/:id/uploads/:uploadId", GetUploadOffset)
+	r.PATCH("/documents/:id/uploads/:uploadId", UploadChunk)
+
+	req, _ := http.NewRequest("HEAD", "/documents/1/uploads/abc", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	req, _ = http.NewRequest("PATCH", "/documents/1/uploads/abc", bytes.NewBufferString("chunk"))
+	req.Header.Set("Upload-Offset", "0")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"log"
+
+	"gorm.io/gorm"
+	"hsduc.com/rag/models"
+)
+
+// messageFulltextIndex is the MySQL FULLTEXT index on message content.
+const messageFulltextIndex = "idx_messages_content_fulltext"
+
+// sqliteMessageSearch keeps an FTS5 table in sync with messages through
+// triggers and rebuilds it from the current rows.
+var sqliteMessageSearch = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(content, content='messages', content_rowid='id')`,
+	`CREATE TRIGGER IF NOT EXISTS messages_fts_insert AFTER INSERT ON messages BEGIN
+		INSERT INTO messages_fts(rowid, content) VALUES (new.id, new.content);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS messages_fts_delete AFTER DELETE ON messages BEGIN
+		INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.id, old.content);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS messages_fts_update AFTER UPDATE OF content ON messages BEGIN
+		INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.id, old.content);
+		INSERT INTO messages_fts(rowid, content) VALUES (new.id, new.content);
+	END`,
+	`INSERT INTO messages_fts(messages_fts) VALUES ('rebuild')`,
+}
+
+// EnsureSearchIndexes creates the full-text index used by message search:
+// a FULLTEXT index on MySQL and an FTS5 table on SQLite. When SQLite is built
+// without FTS5 the search falls back to LIKE and only a warning is logged.
+func EnsureSearchIndexes(db *gorm.DB) error {
+	switch db.Dialector.Name() {
+	case "mysql":
+		if db.Migrator().HasIndex(&models.Message{}, messageFulltextIndex) {
+			return nil
+		}
+		return db.Exec("CREATE FULLTEXT INDEX " + messageFulltextIndex + " ON messages (content)").Error
+	case "sqlite":
+		for _, stmt := range sqliteMessageSearch {
+			if err := db.Exec(stmt).Error; err != nil {
+				log.Printf("Full-text message search unavailable, falling back to LIKE: %v", err)
+				return nil
+			}
+		}
+	}
+	return nil
+}
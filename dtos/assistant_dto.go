@@ -0,0 +1,15 @@
+package dtos
+
+// AssistantRequest creates or replaces an assistant. Empty model settings use
+// the defaults.
+type AssistantRequest struct {
+	Name         string   `json:"name" binding:"required,max=255"`
+	Description  string   `json:"description" binding:"max=1000"`
+	Instructions string   `json:"instructions"`
+	Model        string   `json:"model" binding:"max=100"`
+	Temperature  *float32 `json:"temperature" binding:"omitempty,min=0,max=2"`
+	MaxTokens    int      `json:"max_tokens" binding:"min=0"`
+	DocumentIDs  []uint   `json:"document_ids"`
+	Tools        []string `json:"tools" binding:"dive,oneof=library_search"`
+	Visibility   string   `json:"visibility" binding:"omitempty,oneof=private shared"`
+}
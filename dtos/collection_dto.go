@@ -0,0 +1,15 @@
+package dtos
+
+type CreateCollectionRequest struct {
+	Name     string `json:"name" binding:"required,max=255"`
+	ParentID *uint  `json:"parent_id"`
+}
+
+type RenameCollectionRequest struct {
+	Name string `json:"name" binding:"required,max=255"`
+}
+
+type MoveCollectionRequest struct {
+	// ParentID nil moves the collection to the root
+	ParentID *uint `json:"parent_id"`
+}
@@ -1,9 +1,30 @@
 package dtos
 
 type CreateConversationRequest struct {
-	Title string `json:"title" binding:"required"`
+	// Title defaults to the assistant's name when AssistantID is given
+	Title       string `json:"title" binding:"required_without=AssistantID"`
+	AssistantID *uint  `json:"assistant_id"`
 }
 
 type UpdateConversationRequest struct {
 	Title string `json:"title" binding:"required"`
 }
+
+// ShareConversationRequest creates a public link. A zero ExpiresInHours
+// means the link never expires.
+type ShareConversationRequest struct {
+	ExpiresInHours int `json:"expires_in_hours" binding:"min=0"`
+}
+
+type MoveConversationRequest struct {
+	// FolderID nil takes the conversation out of its folder
+	FolderID *uint `json:"folder_id"`
+}
+
+type UpdateConversationTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+type ConversationFolderRequest struct {
+	Name string `json:"name" binding:"required,max=255"`
+}
@@ -1,11 +1,82 @@
 package dtos
 
 type CreateDocumentRequest struct {
-	Title       string `json:"title" binding:"required"`
-	Description string `json:"description"`
+	Title        string            `json:"title" binding:"required"`
+	CollectionID *uint             `json:"collection_id"`
+	Description  string            `json:"description"`
+	Tags         []string          `json:"tags"`
+	Metadata     map[string]string `json:"metadata"`
 }
 
+// UpdateDocumentRequest leaves tags or metadata unchanged when they are omitted.
 type UpdateDocumentRequest struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	Tags        []string          `json:"tags"`
+	Metadata    map[string]string `json:"metadata"`
+}
+
+type UpdateLabelsRequest struct {
+	Tags     []string          `json:"tags"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// DocumentFilter scopes document retrieval by collection, labels and file
+// content type. A collection includes all of its sub-collections.
+type DocumentFilter struct {
+	CollectionID *uint             `json:"collection_id"`
+	Tags         []string          `json:"tags"`
+	Metadata     map[string]string `json:"metadata"`
+	ContentTypes []string          `json:"content_types"`
+}
+
+type InitiateUploadRequest struct {
+	FileName    string `json:"file_name" binding:"required"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size" binding:"required,min=1"`
+}
+
+type InitiateUploadResponse struct {
+	UploadURL string `json:"upload_url"`
+	ObjectKey string `json:"object_key"`
+	ExpiresIn string `json:"expires_in"`
+}
+
+type CompleteUploadRequest struct {
+	ObjectKey string `json:"object_key" binding:"required"`
+	FileName  string `json:"file_name" binding:"required"`
+}
+
+type UploadSessionResponse struct {
+	ID        string `json:"id"`
+	FileName  string `json:"file_name"`
+	Size      int64  `json:"size"`
+	Offset    int64  `json:"offset"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+type SkippedImportEntry struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+type CreateDocumentSourceRequest struct {
+	URL                  string `json:"url" binding:"required,url"`
+	Kind                 string `json:"kind" binding:"omitempty,oneof=page sitemap"`
+	MaxDepth             int    `json:"max_depth" binding:"min=0,max=5"`
+	MaxPages             int    `json:"max_pages" binding:"min=0"`
+	RecrawlIntervalHours int    `json:"recrawl_interval_hours" binding:"min=0"`
+}
+
+type MoveDocumentRequest struct {
+	// CollectionID nil moves the document to the root
+	CollectionID *uint `json:"collection_id"`
+}
+
+// ShareDocumentRequest grants a user, by email, or a group access to a
+// document. Exactly one of Email and GroupID must be set.
+type ShareDocumentRequest struct {
+	Email   string `json:"email" binding:"omitempty,email"`
+	GroupID *uint  `json:"group_id"`
+	Role    string `json:"role" binding:"required,oneof=viewer editor"`
 }
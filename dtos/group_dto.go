@@ -0,0 +1,9 @@
+package dtos
+
+type CreateGroupRequest struct {
+	Name string `json:"name" binding:"required,max=255"`
+}
+
+type AddGroupMemberRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
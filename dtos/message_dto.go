@@ -3,9 +3,31 @@ package dtos
 type CreateMessageRequest struct {
 	ConversationID uint   `json:"conversation_id" binding:"required"`
 	Role           string `json:"role" binding:"required,oneof=user assistant system"`
-	Content        string `json:"content" binding:"required"`
+	// Content is required unless the message is written from a template or
+	// only carries attachments
+	Content string `json:"content" binding:"required_without_all=TemplateID AttachmentIDs,excluded_with=TemplateID"`
+	// TemplateID sends the prompt template rendered with Variables as the
+	// content; TemplateVersion picks an earlier version than the current one
+	TemplateID      *uint             `json:"template_id"`
+	TemplateVersion int               `json:"template_version" binding:"min=0"`
+	Variables       map[string]string `json:"variables"`
+	// AttachmentIDs are uploaded attachments to send with a user message
+	AttachmentIDs []uint `json:"attachment_ids" binding:"max=10"`
+	// Filter limits the documents searched for context, e.g. to metadata team=payments
+	Filter *DocumentFilter `json:"filter"`
 }
 
 type UpdateMessageRequest struct {
 	Content string `json:"content" binding:"required"`
 }
+
+type SearchMessagesRequest struct {
+	Query string `form:"q" binding:"required"`
+}
+
+type MessageFeedbackRequest struct {
+	Rating string `json:"rating" binding:"required,oneof=up down"`
+	// Reasons categorize the rating
+	Reasons []string `json:"reasons" binding:"max=10,dive,oneof=accurate helpful well_sourced inaccurate incomplete irrelevant_sources missing_sources outdated too_long unsafe other"`
+	Comment string   `json:"comment" binding:"max=2000"`
+}
@@ -0,0 +1,10 @@
+package dtos
+
+// PromptTemplateRequest creates or replaces a prompt template. Variables are
+// written as {{name}} in Content.
+type PromptTemplateRequest struct {
+	Name        string `json:"name" binding:"required,max=255"`
+	Description string `json:"description" binding:"max=1000"`
+	Content     string `json:"content" binding:"required"`
+	Visibility  string `json:"visibility" binding:"omitempty,oneof=private shared"`
+}
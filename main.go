@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"log"
+	"time"
 
 	"github.com/joho/godotenv"
 	"hsduc.com/rag/config"
 	"hsduc.com/rag/database"
 	"hsduc.com/rag/routes"
+	"hsduc.com/rag/services"
 )
 
 // @title           Chatbot RAG API
@@ -30,7 +33,24 @@ func main() {
 	// Initialize Database Connections
 	database.ConnectMySQL()
 	database.ConnectRedis()
-	database.ConnectMinio()
+	if err := services.InitStorage(); err != nil {
+		log.Fatal("Failed to initialize storage:", err)
+	}
+
+	// Garbage-collect abandoned resumable uploads
+	go services.StartUploadGC(context.Background(), time.Hour)
+
+	// Remove account data exports past their download window
+	go services.StartExportGC(context.Background(), time.Hour)
+
+	// Permanently delete trash older than the retention period
+	go services.StartTrashPurger(context.Background(), time.Hour)
+
+	// Delete chat attachments that were uploaded but never sent
+	go services.StartAttachmentGC(context.Background(), time.Hour)
+
+	// Re-crawl web sources that are due
+	go services.StartSourceRecrawler(context.Background(), 10*time.Minute)
 
 	// Setup Routes
 	r := routes.SetupRouter()
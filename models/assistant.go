@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Visibilities of an assistant. Shared assistants can be chatted with, but not
+// changed, by every user.
+const (
+	AssistantPrivate = "private"
+	AssistantShared  = "shared"
+)
+
+// AssistantToolLibrarySearch lets an assistant also search the library of
+// the user chatting with it, beyond its own documents.
+const AssistantToolLibrarySearch = "library_search"
+
+// Assistant bundles instructions, model settings and knowledge documents that
+// conversations can be started with.
+type Assistant struct {
+	ID           uint   `gorm:"primarykey" json:"id"`
+	UserID       uint   `gorm:"not null;index" json:"user_id"`
+	Name         string `gorm:"size:255;not null" json:"name"`
+	Description  string `gorm:"size:1000" json:"description,omitempty"`
+	Instructions string `gorm:"type:text" json:"instructions"`
+	// Model, Temperature and MaxTokens override the defaults when set
+	Model       string   `gorm:"size:100" json:"model,omitempty"`
+	Temperature *float32 `json:"temperature,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+	// DocumentIDs are searched in every conversation with the assistant, with
+	// the access of its owner
+	DocumentIDs []uint    `gorm:"serializer:json;type:text" json:"document_ids"`
+	Tools       []string  `gorm:"serializer:json;type:text" json:"tools"`
+	Visibility  string    `gorm:"size:20;not null;default:private;index" json:"visibility"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Collection is a folder in a user's document tree. Root collections have no
+// parent.
+type Collection struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	UserID    uint           `gorm:"not null;index" json:"user_id"`
+	ParentID  *uint          `gorm:"index" json:"parent_id"`
+	Name      string         `gorm:"size:255;not null" json:"name"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
@@ -7,12 +7,18 @@ import (
 )
 
 type Conversation struct {
-	ID        uint           `gorm:"primarykey" json:"id"`
-	UserID    uint           `gorm:"not null;index" json:"user_id"`
-	Title     string         `gorm:"size:255;not null" json:"title"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
-	Messages  []Message      `json:"messages,omitempty"`
-	User      User           `json:"user,omitempty"`
+	ID       uint     `gorm:"primarykey" json:"id"`
+	UserID   uint     `gorm:"not null;index" json:"user_id"`
+	Title    string   `gorm:"size:255;not null" json:"title"`
+	Pinned   bool     `gorm:"not null;default:false" json:"pinned"`
+	Archived bool     `gorm:"not null;default:false" json:"archived"`
+	FolderID *uint    `gorm:"index" json:"folder_id"`
+	Tags     []string `gorm:"serializer:json;type:text" json:"tags"`
+	// AssistantID is the assistant the conversation was started with, if any
+	AssistantID *uint          `gorm:"index" json:"assistant_id"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	Messages    []Message      `json:"messages,omitempty"`
+	User        User           `json:"user,omitempty"`
 }
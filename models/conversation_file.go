@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// ConversationFile is a file dropped into a single conversation. Only its
+// extracted text is kept, as chunks searched when answering in that
+// conversation; it is deleted with the conversation.
+type ConversationFile struct {
+	ID             uint      `gorm:"primarykey" json:"id"`
+	ConversationID uint      `gorm:"not null;index" json:"conversation_id"`
+	FileName       string    `gorm:"size:255;not null" json:"file_name"`
+	ContentType    string    `gorm:"size:100" json:"content_type"`
+	Size           int64     `json:"size"`
+	Chunks         int       `json:"chunks"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// ConversationFileChunk is one passage of the text of a ConversationFile.
+type ConversationFileChunk struct {
+	ID                 uint   `gorm:"primarykey" json:"id"`
+	ConversationFileID uint   `gorm:"not null;index" json:"conversation_file_id"`
+	ConversationID     uint   `gorm:"not null;index" json:"conversation_id"`
+	Position           int    `gorm:"not null" json:"position"`
+	Text               string `gorm:"type:text;not null" json:"text"`
+}
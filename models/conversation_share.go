@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ConversationShare is a public, read-only link to a snapshot of a
+// conversation taken when the link was created. Anyone with the token can
+// read it until it expires or is revoked.
+type ConversationShare struct {
+	ID             uint            `gorm:"primarykey" json:"id"`
+	ConversationID uint            `gorm:"not null;index" json:"conversation_id"`
+	UserID         uint            `gorm:"not null;index" json:"user_id"`
+	Token          string          `gorm:"size:64;not null;uniqueIndex" json:"token"`
+	Title          string          `gorm:"size:255;not null" json:"title"`
+	Messages       []SharedMessage `gorm:"serializer:json;type:longtext" json:"messages,omitempty"`
+	ExpiresAt      *time.Time      `json:"expires_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeletedAt      gorm.DeletedAt  `gorm:"index" json:"-"`
+}
+
+// SharedMessage is a message as it appeared when the conversation was shared.
+type SharedMessage struct {
+	Role      string    `json:"role"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
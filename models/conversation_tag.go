@@ -0,0 +1,10 @@
+package models
+
+// ConversationTag indexes the tags of conversations so they can be filtered
+// with plain SQL. The Tags field on Conversation is the source of truth; these
+// rows are rewritten with it.
+type ConversationTag struct {
+	ID             uint   `gorm:"primarykey" json:"id"`
+	ConversationID uint   `gorm:"not null;index" json:"conversation_id"`
+	Name           string `gorm:"size:100;not null;index" json:"name"`
+}
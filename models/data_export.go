@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// DataExport is a ZIP of everything stored for a user, built in the
+// background. Status moves from "pending" through "running" to "ready" or
+// "failed".
+type DataExport struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	Status    string     `gorm:"size:20;not null" json:"status"`
+	ObjectKey string     `gorm:"size:500" json:"-"`
+	Size      int64      `json:"size"`
+	Error     string     `gorm:"size:1000" json:"error,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
@@ -7,13 +7,33 @@ import (
 )
 
 type DocumentFile struct {
-	ID          uint           `gorm:"primarykey" json:"id"`
-	DocumentID  uint           `gorm:"not null;index" json:"document_id"`
-	FileName    string         `gorm:"size:255;not null" json:"file_name"`
-	ObjectKey   string         `gorm:"size:500;not null" json:"object_key"`
-	ContentType string         `gorm:"size:100" json:"content_type"`
-	Size        int64          `json:"size"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	ID          uint              `gorm:"primarykey" json:"id"`
+	DocumentID  uint              `gorm:"not null;index" json:"document_id"`
+	FileName    string            `gorm:"size:255;not null" json:"file_name"`
+	Path        string            `gorm:"size:1000" json:"path"`
+	ObjectKey   string            `gorm:"size:500;not null" json:"object_key"`
+	ContentType string            `gorm:"size:100" json:"content_type"`
+	Size        int64             `json:"size"`
+	Checksum    string            `gorm:"size:100" json:"checksum"`
+	ContentHash string            `gorm:"size:64;index" json:"content_hash"`
+	Version     int               `gorm:"not null;default:1" json:"version"`
+	SourceID    *uint             `gorm:"index" json:"source_id,omitempty"`
+	SourceURL   string            `gorm:"size:2000" json:"source_url,omitempty"`
+	Tags        []string          `gorm:"serializer:json;type:text" json:"tags"`
+	Metadata    map[string]string `gorm:"serializer:json;type:text" json:"metadata"`
+	// ChunkedObjectKey is the object whose text the DocumentFileChunk rows of
+	// the file hold; they are rebuilt when it differs from ObjectKey
+	ChunkedObjectKey string         `gorm:"size:500;not null;default:''" json:"-"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// DocumentFileChunk is one passage of the extracted text of a DocumentFile,
+// kept so that answering a question does not download and parse the file.
+type DocumentFileChunk struct {
+	ID             uint   `gorm:"primarykey" json:"id"`
+	DocumentFileID uint   `gorm:"not null;index" json:"document_file_id"`
+	Position       int    `gorm:"not null" json:"position"`
+	Text           string `gorm:"type:text;not null" json:"text"`
 }
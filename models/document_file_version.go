@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// DocumentFileVersion is an archived earlier revision of a DocumentFile.
+// The current revision always lives on the DocumentFile itself.
+type DocumentFileVersion struct {
+	ID             uint      `gorm:"primarykey" json:"id"`
+	DocumentFileID uint      `gorm:"not null;uniqueIndex:idx_file_version" json:"document_file_id"`
+	Version        int       `gorm:"not null;uniqueIndex:idx_file_version" json:"version"`
+	FileName       string    `gorm:"size:255;not null" json:"file_name"`
+	ObjectKey      string    `gorm:"size:500;not null;index" json:"object_key"`
+	ContentType    string    `gorm:"size:100" json:"content_type"`
+	Size           int64     `json:"size"`
+	ContentHash    string    `gorm:"size:64" json:"content_hash"`
+	CreatedAt      time.Time `json:"created_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+// DocumentLabel indexes the tags and metadata of documents and files so they
+// can be filtered with plain SQL. The Tags and Metadata fields on Document and
+// DocumentFile are the source of truth; these rows are rewritten with them.
+type DocumentLabel struct {
+	ID             uint   `gorm:"primarykey" json:"id"`
+	DocumentID     uint   `gorm:"not null;index" json:"document_id"`
+	DocumentFileID uint   `gorm:"not null;default:0;index" json:"document_file_id"` // 0 for document labels
+	Kind           string `gorm:"size:10;not null;index:idx_label" json:"kind"`     // "tag" or "meta"
+	Name           string `gorm:"size:100;not null;index:idx_label" json:"name"`
+	Value          string `gorm:"size:500;index:idx_label" json:"value"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// DocumentShare grants a user or every member of a group access to a
+// document. Exactly one of UserID and GroupID is set. Role is "viewer" or
+// "editor".
+type DocumentShare struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	DocumentID uint      `gorm:"not null;index" json:"document_id"`
+	UserID     *uint     `gorm:"index" json:"user_id,omitempty"`
+	GroupID    *uint     `gorm:"index" json:"group_id,omitempty"`
+	Role       string    `gorm:"size:20;not null" json:"role"`
+	CreatedBy  uint      `gorm:"not null" json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DocumentSource is a web page or sitemap whose pages are crawled into a
+// Document as text snapshots, optionally re-crawled on a schedule.
+type DocumentSource struct {
+	ID                   uint           `gorm:"primarykey" json:"id"`
+	DocumentID           uint           `gorm:"not null;index" json:"document_id"`
+	URL                  string         `gorm:"size:2000;not null" json:"url"`
+	Kind                 string         `gorm:"size:20;not null;default:page" json:"kind"` // "page" or "sitemap"
+	MaxDepth             int            `gorm:"not null;default:0" json:"max_depth"`
+	MaxPages             int            `gorm:"not null" json:"max_pages"`
+	RecrawlIntervalHours int            `gorm:"not null;default:0" json:"recrawl_interval_hours"`
+	LastCrawledAt        *time.Time     `json:"last_crawled_at"`
+	NextCrawlAt          *time.Time     `gorm:"index" json:"next_crawl_at"`
+	LastError            string         `gorm:"type:text" json:"last_error"`
+	CreatedAt            time.Time      `json:"created_at"`
+	UpdatedAt            time.Time      `json:"updated_at"`
+	DeletedAt            gorm.DeletedAt `gorm:"index" json:"-"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Group is a named set of users that documents can be shared with. Only the
+// owner manages its members.
+type Group struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	OwnerID   uint           `gorm:"not null;index" json:"owner_id"`
+	Name      string         `gorm:"size:255;not null" json:"name"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	Members   []GroupMember  `json:"members,omitempty"`
+}
+
+type GroupMember struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	GroupID   uint      `gorm:"not null;uniqueIndex:idx_group_member" json:"group_id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_group_member;index" json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	User      User      `json:"user,omitempty"`
+}
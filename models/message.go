@@ -7,11 +7,27 @@ import (
 )
 
 type Message struct {
-	ID             uint           `gorm:"primarykey" json:"id"`
-	ConversationID uint           `gorm:"not null" json:"conversation_id"`
-	Role           string         `gorm:"size:50;not null" json:"role"` // e.g., "user", "assistant"
-	Content        string         `gorm:"type:text;not null" json:"content"`
-	CreatedAt      time.Time      `json:"created_at"`
-	UpdatedAt      time.Time      `json:"updated_at"`
-	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+	ID             uint       `gorm:"primarykey" json:"id"`
+	ConversationID uint       `gorm:"not null" json:"conversation_id"`
+	Role           string     `gorm:"size:50;not null" json:"role"` // e.g., "user", "assistant"
+	Content        string     `gorm:"type:text;not null" json:"content"`
+	Citations      []Citation `gorm:"serializer:json;type:text" json:"citations,omitempty"`
+	// Model and PromptVersion record what produced an assistant message
+	Model         string              `gorm:"size:100" json:"model,omitempty"`
+	PromptVersion string              `gorm:"size:64" json:"prompt_version,omitempty"`
+	CreatedAt     time.Time           `json:"created_at"`
+	UpdatedAt     time.Time           `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt      `gorm:"index" json:"-"`
+	Attachments   []MessageAttachment `json:"attachments,omitempty"`
+}
+
+// Citation points an assistant message at a document file it drew on, or at
+// a file dropped into the conversation.
+type Citation struct {
+	DocumentID         uint   `json:"document_id"`
+	FileID             uint   `json:"file_id"`
+	ConversationFileID uint   `json:"conversation_file_id,omitempty"`
+	FileName           string `json:"file_name"`
+	// Version is the version of the document file the answer drew on
+	Version int `json:"version,omitempty"`
 }
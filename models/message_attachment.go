@@ -0,0 +1,28 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// MessageAttachment is an image or small file uploaded for a chat message.
+// It is uploaded before the message is sent, so MessageID stays nil until it
+// is attached.
+type MessageAttachment struct {
+	ID          uint   `gorm:"primarykey" json:"id"`
+	UserID      uint   `gorm:"not null;index" json:"user_id"`
+	MessageID   *uint  `gorm:"index" json:"message_id"`
+	FileName    string `gorm:"size:255;not null" json:"file_name"`
+	ObjectKey   string `gorm:"size:500;not null" json:"-"`
+	ContentType string `gorm:"size:100" json:"content_type"`
+	Size        int64  `json:"size"`
+	// Text is the extracted text of a file, kept so it is not extracted again
+	// on every reply; empty for images and files without text
+	Text      string    `gorm:"type:text" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// IsImage reports whether the attachment is an image.
+func (a *MessageAttachment) IsImage() bool {
+	return strings.HasPrefix(a.ContentType, "image/")
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// MessageFeedback is a user's rating of one assistant message. Each message
+// has at most one; rating again replaces it.
+type MessageFeedback struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	MessageID uint      `gorm:"not null;uniqueIndex" json:"message_id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	Rating    string    `gorm:"size:10;not null;index" json:"rating"` // "up" or "down"
+	Reasons   []string  `gorm:"serializer:json;type:text" json:"reasons"`
+	Comment   string    `gorm:"type:text" json:"comment,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
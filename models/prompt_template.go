@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// Visibilities of a prompt template. Shared templates can be used, but not
+// changed, by every user.
+const (
+	PromptTemplatePrivate = "private"
+	PromptTemplateShared  = "shared"
+)
+
+// PromptTemplate is a reusable message with {{variable}} placeholders. The
+// current revision of its content lives on the template itself; earlier ones
+// are kept as PromptTemplateVersions.
+type PromptTemplate struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	UserID      uint      `gorm:"not null;index" json:"user_id"`
+	Name        string    `gorm:"size:255;not null" json:"name"`
+	Description string    `gorm:"size:1000" json:"description,omitempty"`
+	Content     string    `gorm:"type:text;not null" json:"content"`
+	Variables   []string  `gorm:"serializer:json;type:text" json:"variables"`
+	Version     int       `gorm:"not null;default:1" json:"version"`
+	Visibility  string    `gorm:"size:20;not null;default:private;index" json:"visibility"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// PromptTemplateVersion is an archived earlier revision of a PromptTemplate.
+type PromptTemplateVersion struct {
+	ID               uint      `gorm:"primarykey" json:"id"`
+	PromptTemplateID uint      `gorm:"not null;uniqueIndex:idx_prompt_template_version" json:"prompt_template_id"`
+	Version          int       `gorm:"not null;uniqueIndex:idx_prompt_template_version" json:"version"`
+	Content          string    `gorm:"type:text;not null" json:"content"`
+	Variables        []string  `gorm:"serializer:json;type:text" json:"variables"`
+	CreatedAt        time.Time `json:"created_at"`
+}
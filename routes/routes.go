@@ -21,9 +21,9 @@ func SetupRouter() *gin.Engine {
 
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     origins,
-		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowMethods:     []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization", "Upload-Offset", "Range", "If-None-Match"},
+		ExposeHeaders:    []string{"Content-Length", "Location", "Upload-Offset", "Upload-Length", "Content-Range", "Content-Disposition", "ETag", "Accept-Ranges"},
 		AllowCredentials: true,
 	}))
 
@@ -33,6 +33,13 @@ func SetupRouter() *gin.Engine {
 	// Health Check Route
 	r.GET("/health", controllers.HealthCheck)
 
+	// Signed local storage URLs, authorized by their signature instead of a token
+	r.GET("/storage/*key", controllers.ServeLocalObject)
+	r.PUT("/storage/*key", controllers.UploadLocalObject)
+
+	// Public conversation share links, authorized by their token
+	r.GET("/share/:token", controllers.RenderSharedConversation)
+
 	api := r.Group("/api/v1")
 	{
 		// Auth Routes
@@ -43,38 +50,129 @@ func SetupRouter() *gin.Engine {
 			auth.POST("/refresh", controllers.RefreshToken)
 		}
 
+		api.GET("/shares/:token", controllers.GetSharedConversation)
+
 		// Protected Routes
 		protected := api.Group("")
 		protected.Use(middleware.AuthMiddleware())
 		{
 			protected.POST("/auth/logout", controllers.Logout)
 			protected.GET("/auth/me", controllers.GetMe)
+			protected.DELETE("/auth/me", controllers.DeleteAccount)
+			protected.GET("/auth/me/export", controllers.ExportAccount)
 
 			// Conversation Routes
 			protected.POST("/conversations", controllers.CreateConversation)
 			protected.GET("/conversations", controllers.GetConversations)
+			protected.POST("/conversations/import", controllers.ImportConversation)
+			protected.GET("/conversations/tags", controllers.GetConversationTags)
 			protected.GET("/conversations/:id", controllers.GetConversation)
 			protected.PUT("/conversations/:id", controllers.UpdateConversation)
 			protected.DELETE("/conversations/:id", controllers.DeleteConversation)
+			protected.GET("/conversations/:id/export", controllers.ExportConversation)
+			protected.POST("/conversations/:id/share", controllers.ShareConversation)
+			protected.GET("/conversations/:id/share", controllers.GetConversationShares)
+			protected.DELETE("/conversations/:id/share/:shareId", controllers.RevokeConversationShare)
+			protected.PUT("/conversations/:id/pin", controllers.PinConversation)
+			protected.DELETE("/conversations/:id/pin", controllers.UnpinConversation)
+			protected.PUT("/conversations/:id/archive", controllers.ArchiveConversation)
+			protected.DELETE("/conversations/:id/archive", controllers.UnarchiveConversation)
+			protected.POST("/conversations/:id/move", controllers.MoveConversation)
+			protected.PUT("/conversations/:id/tags", controllers.UpdateConversationTags)
+			protected.POST("/conversations/:id/files", controllers.UploadConversationFile)
+			protected.GET("/conversations/:id/files", controllers.GetConversationFiles)
+			protected.DELETE("/conversations/:id/files/:fileId", controllers.DeleteConversationFile)
+
+			// Conversation Folder Routes
+			protected.POST("/conversation-folders", controllers.CreateConversationFolder)
+			protected.GET("/conversation-folders", controllers.GetConversationFolders)
+			protected.PUT("/conversation-folders/:id", controllers.RenameConversationFolder)
+			protected.DELETE("/conversation-folders/:id", controllers.DeleteConversationFolder)
 
 			// Message Routes
 			protected.POST("/messages", controllers.CreateMessage)
 			protected.GET("/messages", controllers.GetMessages) // Use query ?conversation_id=X
+			protected.GET("/messages/search", controllers.SearchMessages)
+			protected.POST("/messages/attachments", controllers.UploadMessageAttachment)
+			protected.GET("/messages/attachments/:id/content", controllers.GetMessageAttachmentContent)
+			protected.DELETE("/messages/attachments/:id", controllers.DeleteMessageAttachment)
 			protected.GET("/messages/:id", controllers.GetMessage)
 			protected.PUT("/messages/:id", controllers.UpdateMessage)
 			protected.DELETE("/messages/:id", controllers.DeleteMessage)
+			protected.POST("/messages/:id/feedback", controllers.RateMessage)
+			protected.GET("/feedback/report", controllers.GetFeedbackReport)
+
+			// Prompt Template Routes
+			protected.POST("/prompt-templates", controllers.CreatePromptTemplate)
+			protected.GET("/prompt-templates", controllers.GetPromptTemplates)
+			protected.GET("/prompt-templates/:id", controllers.GetPromptTemplate)
+			protected.PUT("/prompt-templates/:id", controllers.UpdatePromptTemplate)
+			protected.DELETE("/prompt-templates/:id", controllers.DeletePromptTemplate)
+			protected.GET("/prompt-templates/:id/versions", controllers.GetPromptTemplateVersions)
+
+			// Assistant Routes
+			protected.POST("/assistants", controllers.CreateAssistant)
+			protected.GET("/assistants", controllers.GetAssistants)
+			protected.GET("/assistants/:id", controllers.GetAssistant)
+			protected.PUT("/assistants/:id", controllers.UpdateAssistant)
+			protected.DELETE("/assistants/:id", controllers.DeleteAssistant)
+
+			// Trash Routes
+			protected.GET("/trash", controllers.GetTrash)
+			protected.DELETE("/trash", controllers.EmptyTrash)
+			protected.POST("/trash/:kind/:id/restore", controllers.RestoreTrashItem)
+
+			// Group Routes
+			protected.POST("/groups", controllers.CreateGroup)
+			protected.GET("/groups", controllers.GetGroups)
+			protected.DELETE("/groups/:id", controllers.DeleteGroup)
+			protected.POST("/groups/:id/members", controllers.AddGroupMember)
+			protected.DELETE("/groups/:id/members/:userId", controllers.RemoveGroupMember)
 
 			// Document Routes
 			protected.POST("/documents", controllers.CreateDocument)
 			protected.GET("/documents", controllers.GetDocuments)
+			protected.GET("/documents/facets", controllers.GetDocumentFacets)
 			protected.GET("/documents/:id", controllers.GetDocument)
 			protected.PUT("/documents/:id", controllers.UpdateDocument)
 			protected.DELETE("/documents/:id", controllers.DeleteDocument)
+			protected.POST("/documents/:id/move", controllers.MoveDocument)
+			protected.POST("/documents/:id/shares", controllers.ShareDocument)
+			protected.GET("/documents/:id/shares", controllers.GetDocumentShares)
+			protected.DELETE("/documents/:id/shares/:shareId", controllers.DeleteDocumentShare)
+
+			// Collection Routes
+			protected.POST("/collections", controllers.CreateCollection)
+			protected.GET("/collections", controllers.GetCollections)
+			protected.GET("/collections/:id", controllers.GetCollection)
+			protected.PUT("/collections/:id", controllers.RenameCollection)
+			protected.POST("/collections/:id/move", controllers.MoveCollection)
+			protected.DELETE("/collections/:id", controllers.DeleteCollection)
 
 			// Document File Routes
 			protected.POST("/documents/:id/files", controllers.UploadDocumentFile)
+			protected.POST("/documents/:id/files/presign", controllers.InitiateDocumentFileUpload)
+			protected.POST("/documents/:id/files/complete", controllers.CompleteDocumentFileUpload)
+			protected.POST("/documents/:id/import", controllers.ImportDocumentFiles)
+			protected.POST("/documents/:id/sources", controllers.CreateDocumentSource)
+			protected.GET("/documents/:id/sources", controllers.GetDocumentSources)
+			protected.POST("/documents/:id/sources/:sourceId/sync", controllers.RecrawlDocumentSource)
+			protected.DELETE("/documents/:id/sources/:sourceId", controllers.DeleteDocumentSource)
 			protected.GET("/documents/:id/files/:fileId/download", controllers.GetDocumentFileDownloadURL)
+			protected.GET("/documents/:id/files/:fileId/content", controllers.StreamDocumentFile)
+			protected.GET("/documents/:id/files/:fileId/preview", controllers.GetDocumentFilePreview)
+			protected.PUT("/documents/:id/files/:fileId", controllers.ReplaceDocumentFile)
+			protected.PUT("/documents/:id/files/:fileId/labels", controllers.UpdateDocumentFileLabels)
 			protected.DELETE("/documents/:id/files/:fileId", controllers.DeleteDocumentFile)
+			protected.GET("/documents/:id/files/:fileId/versions", controllers.GetDocumentFileVersions)
+			protected.GET("/documents/:id/files/:fileId/versions/:version/download", controllers.GetDocumentFileVersionDownloadURL)
+			protected.POST("/documents/:id/files/:fileId/versions/:version/restore", controllers.RestoreDocumentFileVersion)
+
+			// Resumable Upload Routes
+			protected.POST("/documents/:id/uploads", controllers.CreateUpload)
+			protected.HEAD("/documents/:id/uploads/:uploadId", controllers.GetUploadOffset)
+			protected.PATCH("/documents/:id/uploads/:uploadId", controllers.UploadChunk)
+			protected.DELETE("/documents/:id/uploads/:uploadId", controllers.CancelUpload)
 		}
 	}
 
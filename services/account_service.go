@@ -0,0 +1,460 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+)
+
+// DataExportTTL is how long a finished account export can be downloaded.
+const DataExportTTL = 7 * 24 * time.Hour
+
+// DataExportBuildTimeout bounds how long building an export may take. An
+// export still pending or running after that was interrupted, usually by a
+// restart.
+const DataExportBuildTimeout = time.Hour
+
+var errDataExportInterrupted = errors.New("export was interrupted")
+
+// sessionTTL matches the lifetime of the sessions created at login.
+const sessionTTL = 7 * 24 * time.Hour
+
+func userSessionsKey(userID uint) string {
+	return fmt.Sprintf("user:%d:sessions", userID)
+}
+
+// TrackSession records a session under its user so all of them can be
+// revoked at once.
+func TrackSession(ctx context.Context, userID uint, sessionID string) error {
+	key := userSessionsKey(userID)
+	pipe := database.Redis.TxPipeline()
+	pipe.SAdd(ctx, key, sessionID)
+	pipe.Expire(ctx, key, sessionTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// RevokeUserSessions deletes every session of userID. Sessions created before
+// they were tracked per user are found by scanning.
+func RevokeUserSessions(ctx context.Context, userID uint) error {
+	key := userSessionsKey(userID)
+	ids, err := database.Redis.SMembers(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	keys := []string{key}
+	for _, id := range ids {
+		keys = append(keys, "session:"+id)
+	}
+	if err := database.Redis.Del(ctx, keys...).Err(); err != nil {
+		return err
+	}
+
+	owner := strconv.FormatUint(uint64(userID), 10)
+	iter := database.Redis.Scan(ctx, 0, "session:*", 1000).Iterator()
+	for iter.Next(ctx) {
+		if val, err := database.Redis.Get(ctx, iter.Val()).Result(); err == nil && val == owner {
+			if err := database.Redis.Del(ctx, iter.Val()).Err(); err != nil {
+				return err
+			}
+		}
+	}
+	return iter.Err()
+}
+
+// StartDataExport queues a new export for userID and builds it in the
+// background.
+func StartDataExport(userID uint) (*models.DataExport, error) {
+	export := models.DataExport{UserID: userID, Status: "pending"}
+	if err := database.DB.Create(&export).Error; err != nil {
+		return nil, err
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), DataExportBuildTimeout)
+		defer cancel()
+		if err := BuildDataExport(ctx, &export); err != nil {
+			log.Printf("Data export %d failed: %v", export.ID, err)
+		}
+	}()
+	return &export, nil
+}
+
+// BuildDataExport writes the ZIP for export to storage and records the
+// outcome on the export.
+func BuildDataExport(ctx context.Context, export *models.DataExport) error {
+	database.DB.Model(export).Update("status", "running")
+
+	tmp, err := os.CreateTemp("", "export-*.zip")
+	if err != nil {
+		return failDataExport(export, err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := writeAccountArchive(ctx, export.UserID, tmp); err != nil {
+		return failDataExport(export, err)
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return failDataExport(export, err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return failDataExport(export, err)
+	}
+
+	token, err := NewShareToken()
+	if err != nil {
+		return failDataExport(export, err)
+	}
+	key := fmt.Sprintf("exports/%d/%d-%s.zip", export.UserID, export.ID, token)
+	if err := UploadFile(ctx, key, "application/zip", tmp, size); err != nil {
+		return failDataExport(export, err)
+	}
+
+	expiresAt := time.Now().Add(DataExportTTL)
+	export.Status, export.ObjectKey, export.Size, export.ExpiresAt = "ready", key, size, &expiresAt
+	return database.DB.Save(export).Error
+}
+
+// FailStalledDataExport marks export failed when it has been pending or
+// running for longer than DataExportBuildTimeout, so a new one can be
+// started. It reports whether it did.
+func FailStalledDataExport(export *models.DataExport) bool {
+	if export.Status != "pending" && export.Status != "running" {
+		return false
+	}
+	if time.Since(export.UpdatedAt) < DataExportBuildTimeout {
+		return false
+	}
+	failDataExport(export, errDataExportInterrupted)
+	return true
+}
+
+func failDataExport(export *models.DataExport, cause error) error {
+	export.Status, export.Error = "failed", cause.Error()
+	database.DB.Save(export)
+	return cause
+}
+
+// writeAccountArchive writes the user's profile, conversations with their
+// attachments and files, documents and original files as a ZIP to w.
+func writeAccountArchive(ctx context.Context, userID uint, w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		return err
+	}
+	if err := writeZipJSON(zw, "profile.json", user); err != nil {
+		return err
+	}
+
+	var conversations []models.Conversation
+	if err := database.DB.Where("user_id = ?", userID).Order("id").Find(&conversations).Error; err != nil {
+		return err
+	}
+	for i := range conversations {
+		export, err := ExportConversation(&conversations[i])
+		if err != nil {
+			return err
+		}
+		name := fmt.Sprintf("conversations/%d-%s.json", conversations[i].ID, archiveSlug(conversations[i].Title))
+		if err := writeZipJSON(zw, name, export); err != nil {
+			return err
+		}
+	}
+
+	// Only the text of dropped-in files is kept, so that is what is exported
+	var conversationFiles []models.ConversationFile
+	err := database.DB.Joins("JOIN conversations ON conversations.id = conversation_files.conversation_id").
+		Where("conversations.user_id = ? AND conversations.deleted_at IS NULL", userID).
+		Order("conversation_files.id").
+		Find(&conversationFiles).Error
+	if err != nil {
+		return err
+	}
+	if err := writeZipJSON(zw, "conversation_files.json", conversationFiles); err != nil {
+		return err
+	}
+	for _, file := range conversationFiles {
+		var chunks []string
+		if err := database.DB.Model(&models.ConversationFileChunk{}).Where("conversation_file_id = ?", file.ID).Order("position").Pluck("text", &chunks).Error; err != nil {
+			return err
+		}
+		name := path.Base(file.FileName)
+		if path.Ext(name) != ".txt" {
+			name += ".txt"
+		}
+		w, err := zw.Create(fmt.Sprintf("conversation_files/%d/%d-%s", file.ConversationID, file.ID, name))
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, strings.Join(chunks, "\n\n")); err != nil {
+			return err
+		}
+	}
+
+	var attachments []models.MessageAttachment
+	if err := database.DB.Where("user_id = ?", userID).Order("id").Find(&attachments).Error; err != nil {
+		return err
+	}
+	if err := writeZipJSON(zw, "message_attachments.json", attachments); err != nil {
+		return err
+	}
+	for _, attachment := range attachments {
+		name := fmt.Sprintf("attachments/%d-%s", attachment.ID, path.Base(attachment.FileName))
+		if err := copyObjectToZip(ctx, zw, name, attachment.ObjectKey); err != nil {
+			return fmt.Errorf("attachment %d: %w", attachment.ID, err)
+		}
+	}
+
+	var folders []models.ConversationFolder
+	if err := database.DB.Where("user_id = ?", userID).Order("id").Find(&folders).Error; err != nil {
+		return err
+	}
+	if err := writeZipJSON(zw, "conversation_folders.json", folders); err != nil {
+		return err
+	}
+
+	var feedback []models.MessageFeedback
+	if err := database.DB.Where("user_id = ?", userID).Order("id").Find(&feedback).Error; err != nil {
+		return err
+	}
+	if err := writeZipJSON(zw, "message_feedback.json", feedback); err != nil {
+		return err
+	}
+
+	var templates []models.PromptTemplate
+	if err := database.DB.Where("user_id = ?", userID).Order("id").Find(&templates).Error; err != nil {
+		return err
+	}
+	if err := writeZipJSON(zw, "prompt_templates.json", templates); err != nil {
+		return err
+	}
+
+	var assistants []models.Assistant
+	if err := database.DB.Where("user_id = ?", userID).Order("id").Find(&assistants).Error; err != nil {
+		return err
+	}
+	if err := writeZipJSON(zw, "assistants.json", assistants); err != nil {
+		return err
+	}
+
+	var collections []models.Collection
+	if err := database.DB.Where("user_id = ?", userID).Order("id").Find(&collections).Error; err != nil {
+		return err
+	}
+	if err := writeZipJSON(zw, "collections.json", collections); err != nil {
+		return err
+	}
+
+	var documents []models.Document
+	if err := database.DB.Where("user_id = ?", userID).Preload("Files").Order("id").Find(&documents).Error; err != nil {
+		return err
+	}
+	if err := writeZipJSON(zw, "documents.json", documents); err != nil {
+		return err
+	}
+	for _, doc := range documents {
+		for _, file := range doc.Files {
+			name := fmt.Sprintf("files/%d-%s/%d-%s", doc.ID, archiveSlug(doc.Title), file.ID, path.Base(file.FileName))
+			if err := copyObjectToZip(ctx, zw, name, file.ObjectKey); err != nil {
+				return fmt.Errorf("file %d: %w", file.ID, err)
+			}
+		}
+	}
+
+	return zw.Close()
+}
+
+func writeZipJSON(zw *zip.Writer, name string, v interface{}) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func copyObjectToZip(ctx context.Context, zw *zip.Writer, name, objectKey string) error {
+	r, err := GetFile(ctx, objectKey)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// archiveSlug makes a title safe to use as a path segment in the archive.
+func archiveSlug(title string) string {
+	slug := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r < ' ' {
+			return '-'
+		}
+		return r
+	}, strings.TrimSpace(title))
+	slug, _ = truncateUTF8([]byte(slug), 80)
+	if slug == "" || slug == "." || slug == ".." {
+		return "untitled"
+	}
+	return slug
+}
+
+// DeleteAccount permanently removes a user with everything they own: rows
+// are hard-deleted, bypassing soft deletes, and storage objects nobody else
+// references are removed. Sessions must be revoked separately.
+func DeleteAccount(ctx context.Context, userID uint) error {
+	unscoped := func(model interface{}) *gorm.DB { return database.DB.Unscoped().Model(model) }
+
+	docIDs := unscoped(&models.Document{}).Select("id").Where("user_id = ?", userID)
+	fileIDs := unscoped(&models.DocumentFile{}).Select("id").Where("document_id IN (?)", docIDs)
+	conversationIDs := unscoped(&models.Conversation{}).Select("id").Where("user_id = ?", userID)
+	ownedGroupIDs := unscoped(&models.Group{}).Select("id").Where("owner_id = ?", userID)
+	templateIDs := unscoped(&models.PromptTemplate{}).Select("id").Where("user_id = ?", userID)
+
+	var objectKeys, versionKeys, exportKeys, attachmentKeys []string
+	if err := unscoped(&models.DocumentFile{}).Where("id IN (?)", fileIDs).Pluck("object_key", &objectKeys).Error; err != nil {
+		return err
+	}
+	if err := unscoped(&models.DocumentFileVersion{}).Where("document_file_id IN (?)", fileIDs).Pluck("object_key", &versionKeys).Error; err != nil {
+		return err
+	}
+	if err := unscoped(&models.DataExport{}).Where("user_id = ? AND object_key <> ''", userID).Pluck("object_key", &exportKeys).Error; err != nil {
+		return err
+	}
+	if err := unscoped(&models.MessageAttachment{}).Where("user_id = ?", userID).Pluck("object_key", &attachmentKeys).Error; err != nil {
+		return err
+	}
+
+	// Children before parents, since the subqueries read the parent tables
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Conversations of others started with the user's assistants continue
+		// with the default settings
+		assistantIDs := unscoped(&models.Assistant{}).Select("id").Where("user_id = ?", userID)
+		if err := tx.Unscoped().Model(&models.Conversation{}).Where("assistant_id IN (?)", assistantIDs).Update("assistant_id", nil).Error; err != nil {
+			return err
+		}
+
+		steps := []struct {
+			model interface{}
+			query string
+			arg   interface{}
+		}{
+			{&models.DocumentFileVersion{}, "document_file_id IN (?)", fileIDs},
+			{&models.DocumentFileChunk{}, "document_file_id IN (?)", fileIDs},
+			{&models.DocumentLabel{}, "document_id IN (?)", docIDs},
+			{&models.DocumentSource{}, "document_id IN (?)", docIDs},
+			{&models.DocumentShare{}, "document_id IN (?)", docIDs},
+			{&models.DocumentShare{}, "group_id IN (?)", ownedGroupIDs},
+			{&models.DocumentShare{}, "user_id = ?", userID},
+			{&models.DocumentFile{}, "document_id IN (?)", docIDs},
+			{&models.Document{}, "user_id = ?", userID},
+			{&models.Collection{}, "user_id = ?", userID},
+			{&models.GroupMember{}, "group_id IN (?)", ownedGroupIDs},
+			{&models.GroupMember{}, "user_id = ?", userID},
+			{&models.Group{}, "owner_id = ?", userID},
+			{&models.MessageFeedback{}, "user_id = ?", userID},
+			{&models.MessageAttachment{}, "user_id = ?", userID},
+			{&models.Message{}, "conversation_id IN (?)", conversationIDs},
+			{&models.ConversationTag{}, "conversation_id IN (?)", conversationIDs},
+			{&models.ConversationFileChunk{}, "conversation_id IN (?)", conversationIDs},
+			{&models.ConversationFile{}, "conversation_id IN (?)", conversationIDs},
+			{&models.ConversationShare{}, "user_id = ?", userID},
+			{&models.Conversation{}, "user_id = ?", userID},
+			{&models.ConversationFolder{}, "user_id = ?", userID},
+			{&models.PromptTemplateVersion{}, "prompt_template_id IN (?)", templateIDs},
+			{&models.PromptTemplate{}, "user_id = ?", userID},
+			{&models.Assistant{}, "user_id = ?", userID},
+			{&models.DataExport{}, "user_id = ?", userID},
+			{&models.User{}, "id = ?", userID},
+		}
+		for _, step := range steps {
+			if err := tx.Unscoped().Where(step.query, step.arg).Delete(step.model).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range append(objectKeys, versionKeys...) {
+		if err := ReleaseObject(ctx, key); err != nil {
+			log.Printf("Failed to release object %s of deleted user %d: %v", key, userID, err)
+		}
+	}
+	for _, key := range exportKeys {
+		if err := DeleteFile(ctx, key); err != nil {
+			log.Printf("Failed to delete export %s of deleted user %d: %v", key, userID, err)
+		}
+	}
+	for _, key := range attachmentKeys {
+		if err := DeleteFile(ctx, key); err != nil {
+			log.Printf("Failed to delete attachment %s of deleted user %d: %v", key, userID, err)
+		}
+	}
+	return nil
+}
+
+// PurgeExpiredExports deletes finished exports past their download window.
+// It returns the number removed.
+func PurgeExpiredExports(ctx context.Context) (int, error) {
+	var exports []models.DataExport
+	if err := database.DB.Where("expires_at < ?", time.Now()).Find(&exports).Error; err != nil {
+		return 0, err
+	}
+	for _, export := range exports {
+		if export.ObjectKey != "" {
+			if err := DeleteFile(ctx, export.ObjectKey); err != nil {
+				return 0, err
+			}
+		}
+		if err := database.DB.Delete(&export).Error; err != nil {
+			return 0, err
+		}
+	}
+	return len(exports), nil
+}
+
+// StartExportGC periodically removes expired account exports until ctx is cancelled.
+func StartExportGC(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := PurgeExpiredExports(ctx)
+			if err != nil {
+				log.Printf("Export GC failed: %v", err)
+				continue
+			}
+			if removed > 0 {
+				log.Printf("Export GC removed %d expired exports", removed)
+			}
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strings"
+)
+
+// maxCompressionRatio rejects zip entries that claim to expand far more than
+// any real document does, before a single byte is decompressed.
+const maxCompressionRatio = 100
+
+var (
+	ErrUnsupportedArchive = errors.New("archive must be a ZIP or tar.gz file")
+	ErrUnsafeArchivePath  = errors.New("archive contains an unsafe path")
+	ErrArchiveTooLarge    = errors.New("archive expands beyond the allowed size")
+)
+
+// ArchiveLimits bounds how much work unpacking a single archive may do.
+type ArchiveLimits struct {
+	MaxEntries   int
+	MaxTotalSize int64 // total uncompressed bytes, 0 for no limit
+}
+
+// ArchiveEntry is a regular file inside an archive. Path is cleaned, relative
+// and slash-separated.
+type ArchiveEntry struct {
+	Path string
+	Size int64 // as declared by the archive, not trusted
+}
+
+// WalkArchive calls fn for every regular file in a ZIP or tar.gz archive.
+// Directories, links and OS metadata files are skipped. Unpacking stops with
+// ErrUnsafeArchivePath if an entry would escape the archive root, and with
+// ErrArchiveTooLarge once the entry count or the decompressed bytes exceed
+// limits, whatever the archive headers claim.
+func WalkArchive(r io.ReaderAt, size int64, limits ArchiveLimits, fn func(entry ArchiveEntry, content io.Reader) error) error {
+	magic := make([]byte, 4)
+	n, _ := r.ReadAt(magic, 0)
+	magic = magic[:n]
+
+	budget := &archiveBudget{remaining: limits.MaxTotalSize}
+	if budget.remaining <= 0 {
+		budget.remaining = math.MaxInt64
+	}
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")), bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+		return walkZip(r, size, limits, budget, fn)
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return walkTarGz(io.NewSectionReader(r, 0, size), limits, budget, fn)
+	default:
+		return ErrUnsupportedArchive
+	}
+}
+
+func walkZip(r io.ReaderAt, size int64, limits ArchiveLimits, budget *archiveBudget, fn func(ArchiveEntry, io.Reader) error) error {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return ErrUnsupportedArchive
+	}
+	if limits.MaxEntries > 0 && len(archive.File) > limits.MaxEntries {
+		return fmt.Errorf("%w: more than %d entries", ErrArchiveTooLarge, limits.MaxEntries)
+	}
+
+	for _, f := range archive.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		name, err := cleanArchivePath(f.Name)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			continue
+		}
+		if f.CompressedSize64 > 0 && f.UncompressedSize64/f.CompressedSize64 > maxCompressionRatio {
+			return fmt.Errorf("%w: %s is suspiciously compressed", ErrArchiveTooLarge, name)
+		}
+
+		if err := walkZipFile(f, name, budget, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkZipFile(f *zip.File, name string, budget *archiveBudget, fn func(ArchiveEntry, io.Reader) error) error {
+	content, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	return fn(ArchiveEntry{Path: name, Size: int64(f.UncompressedSize64)}, budget.reader(content))
+}
+
+func walkTarGz(r io.Reader, limits ArchiveLimits, budget *archiveBudget, fn func(ArchiveEntry, io.Reader) error) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return ErrUnsupportedArchive
+	}
+	defer gz.Close()
+
+	// Count every decompressed byte, including the ones tar skips over
+	archive := tar.NewReader(budget.reader(gz))
+	for entries := 0; ; entries++ {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if errors.Is(err, ErrArchiveTooLarge) {
+				return err
+			}
+			return ErrUnsupportedArchive
+		}
+		if limits.MaxEntries > 0 && entries >= limits.MaxEntries {
+			return fmt.Errorf("%w: more than %d entries", ErrArchiveTooLarge, limits.MaxEntries)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name, err := cleanArchivePath(header.Name)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			continue
+		}
+
+		if err := fn(ArchiveEntry{Path: name, Size: header.Size}, archive); err != nil {
+			return err
+		}
+	}
+}
+
+// cleanArchivePath normalizes an entry name and rejects names that are
+// absolute or climb out of the archive root (zip-slip). It returns an empty
+// name for OS metadata such as __MACOSX folders and dotfiles.
+func cleanArchivePath(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || (len(name) > 1 && name[1] == ':') {
+		return "", fmt.Errorf("%w: %s", ErrUnsafeArchivePath, name)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("%w: %s", ErrUnsafeArchivePath, name)
+		}
+	}
+
+	clean := path.Clean(name)
+	for _, part := range strings.Split(clean, "/") {
+		if part == "__MACOSX" || strings.HasPrefix(part, ".") {
+			return "", nil
+		}
+	}
+	return clean, nil
+}
+
+// archiveBudget tracks the decompressed bytes still allowed for one archive.
+type archiveBudget struct {
+	remaining int64
+}
+
+func (b *archiveBudget) reader(r io.Reader) io.Reader {
+	return &budgetReader{r: r, budget: b}
+}
+
+type budgetReader struct {
+	r      io.Reader
+	budget *archiveBudget
+}
+
+func (br *budgetReader) Read(p []byte) (int, error) {
+	if br.budget.remaining <= 0 {
+		// Content ending exactly at the limit is fine, anything after it is not
+		var probe [1]byte
+		n, err := br.r.Read(probe[:])
+		if n > 0 {
+			return 0, ErrArchiveTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > br.budget.remaining {
+		p = p[:br.budget.remaining]
+	}
+	n, err := br.r.Read(p)
+	br.budget.remaining -= int64(n)
+	return n, err
+}
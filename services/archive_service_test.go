@@ -0,0 +1,106 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func buildTestZip(t *testing.T, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		assert.NoError(t, err)
+		w.Write(content)
+	}
+	assert.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func buildTestTarGz(t *testing.T, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		tw.Write(content)
+	}
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func walkTestArchive(data []byte, limits ArchiveLimits) (map[string]string, error) {
+	got := map[string]string{}
+	err := WalkArchive(bytes.NewReader(data), int64(len(data)), limits, func(entry ArchiveEntry, content io.Reader) error {
+		b, err := io.ReadAll(content)
+		got[entry.Path] = string(b)
+		return err
+	})
+	return got, err
+}
+
+func TestWalkArchive(t *testing.T) {
+	files := map[string][]byte{
+		"wiki/Home.md":            []byte("# Home"),
+		"wiki/./eng/Runbook.txt":  []byte("restart it"),
+		"__MACOSX/wiki/._Home.md": []byte("junk"),
+		"wiki/.DS_Store":          []byte("junk"),
+	}
+	want := map[string]string{"wiki/Home.md": "# Home", "wiki/eng/Runbook.txt": "restart it"}
+
+	got, err := walkTestArchive(buildTestZip(t, files), ArchiveLimits{})
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	got, err = walkTestArchive(buildTestTarGz(t, files), ArchiveLimits{})
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	_, err = walkTestArchive([]byte("plain text, not an archive"), ArchiveLimits{})
+	assert.ErrorIs(t, err, ErrUnsupportedArchive)
+}
+
+func TestWalkArchive_RejectsUnsafePaths(t *testing.T) {
+	for _, name := range []string{"../../etc/passwd", "/etc/passwd", "wiki/../../escape.txt", `..\windows.txt`, "C:/boot.ini"} {
+		t.Run(name, func(t *testing.T) {
+			files := map[string][]byte{name: []byte("x")}
+
+			_, err := walkTestArchive(buildTestZip(t, files), ArchiveLimits{})
+			assert.ErrorIs(t, err, ErrUnsafeArchivePath)
+
+			_, err = walkTestArchive(buildTestTarGz(t, files), ArchiveLimits{})
+			assert.ErrorIs(t, err, ErrUnsafeArchivePath)
+		})
+	}
+}
+
+func TestWalkArchive_Limits(t *testing.T) {
+	// Highly compressible content trips the ratio check before anything is unpacked
+	bomb := buildTestZip(t, map[string][]byte{"zeros.txt": make([]byte, 10*1024*1024)})
+	_, err := walkTestArchive(bomb, ArchiveLimits{})
+	assert.ErrorIs(t, err, ErrArchiveTooLarge)
+
+	// The decompressed byte budget is enforced regardless of what headers say
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	for _, data := range [][]byte{
+		buildTestZip(t, map[string][]byte{"a.txt": content, "b.txt": content}),
+		buildTestTarGz(t, map[string][]byte{"a.txt": content, "b.txt": content}),
+	} {
+		_, err = walkTestArchive(data, ArchiveLimits{MaxTotalSize: 1500})
+		assert.ErrorIs(t, err, ErrArchiveTooLarge)
+	}
+
+	_, err = walkTestArchive(buildTestZip(t, map[string][]byte{"a.txt": content}), ArchiveLimits{MaxTotalSize: int64(len(content))})
+	assert.NoError(t, err)
+
+	many := buildTestZip(t, map[string][]byte{"a.txt": nil, "b.txt": nil, "c.txt": nil})
+	_, err = walkTestArchive(many, ArchiveLimits{MaxEntries: 2})
+	assert.ErrorIs(t, err, ErrArchiveTooLarge)
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+
+	"gorm.io/gorm"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+)
+
+// ErrAssistantDocumentNotFound is returned when an assistant is given a
+// document its owner cannot use for it.
+var ErrAssistantDocumentNotFound = errors.New("document not found")
+
+// VisibleAssistants scopes a query to the assistants userID can chat with:
+// their own and every shared one.
+func VisibleAssistants(userID uint) *gorm.DB {
+	return database.DB.Where("user_id = ? OR visibility = ?", userID, models.AssistantShared)
+}
+
+// ValidateAssistantDocuments checks that userID can give an assistant with
+// visibility every document in ids. Private assistants need read access; shared
+// ones publish their documents to every user, so only the owner of a document
+// can add it to them.
+func ValidateAssistantDocuments(userID uint, ids []uint, visibility string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	role := RoleViewer
+	if visibility == models.AssistantShared {
+		role = RoleOwner
+	}
+	var count int64
+	err := AccessibleDocuments(database.DB.Model(&models.Document{}), userID, role).
+		Where("documents.id IN ?", ids).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count != int64(len(ids)) {
+		return ErrAssistantDocumentNotFound
+	}
+	return nil
+}
+
+// AssistantChatSettings are the settings replies of assistant are generated
+// with; nil gives the defaults.
+func AssistantChatSettings(assistant *models.Assistant) ChatSettings {
+	if assistant == nil {
+		return ChatSettings{}
+	}
+	return ChatSettings{
+		Instructions: assistant.Instructions,
+		Model:        assistant.Model,
+		Temperature:  assistant.Temperature,
+		MaxTokens:    assistant.MaxTokens,
+	}
+}
+
+// RetrieveConversationPassages returns up to limit passages for a question in
+// a conversation, from the files dropped into it and, without an assistant,
+// the user's library within filter. An assistant's own documents are searched
+// with the access of its owner, and the user's library only when the assistant
+// has library search enabled.
+func RetrieveConversationPassages(ctx context.Context, userID, conversationID uint, query string, filter DocumentFilter, assistant *models.Assistant, limit int) ([]Passage, error) {
+	var sources [][]Passage
+
+	files, err := conversationFilePassages(conversationID, queryTerms(query))
+	if err != nil {
+		return nil, err
+	}
+	sources = append(sources, files)
+
+	if assistant != nil && len(assistant.DocumentIDs) > 0 {
+		knowledge, err := RetrievePassages(ctx, assistant.UserID, query, DocumentFilter{DocumentIDs: assistant.DocumentIDs}, limit)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, knowledge)
+	}
+	if assistant == nil || slices.Contains(assistant.Tools, models.AssistantToolLibrarySearch) {
+		library, err := RetrievePassages(ctx, userID, query, filter, limit)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, library)
+	}
+
+	type passageKey struct {
+		fileID, conversationFileID uint
+		text                       string
+	}
+	var passages []Passage
+	seen := map[passageKey]bool{}
+	for _, source := range sources {
+		for _, p := range source {
+			key := passageKey{p.FileID, p.ConversationFileID, p.Text}
+			if !seen[key] {
+				seen[key] = true
+				passages = append(passages, p)
+			}
+		}
+	}
+
+	sort.SliceStable(passages, func(a, b int) bool { return passages[a].Score > passages[b].Score })
+	if len(passages) > limit {
+		passages = passages[:limit]
+	}
+	return passages, nil
+}
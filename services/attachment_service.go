@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"hsduc.com/rag/config"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/utils"
+)
+
+// ErrUnknownAttachment is returned when a message refers to an attachment the
+// user did not upload or that was already sent with another message.
+var ErrUnknownAttachment = errors.New("attachment not found or already sent")
+
+// attachmentImageTypes are the image formats vision models accept. Other
+// attachments must be of a type allowed for document uploads.
+var attachmentImageTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp"}
+
+// unsentAttachmentExpiry is how long an uploaded attachment may wait for the
+// message it is meant for.
+const unsentAttachmentExpiry = 24 * time.Hour
+
+// maxAttachmentText caps the text of one attached file given to the model.
+const maxAttachmentText = 20000
+
+// ValidateAttachment checks an uploaded attachment against the attachment size
+// limit and the user's storage quota, and sniffs its type from the leading
+// bytes.
+func ValidateAttachment(userID uint, head []byte, fileName string, size int64) (string, error) {
+	if err := ValidateAttachmentSize(size); err != nil {
+		return "", err
+	}
+	if err := ValidateStorageQuota(userID, size); err != nil {
+		return "", err
+	}
+
+	contentType := utils.SniffContentType(head, fileName)
+	if utils.IsAllowedContentType(contentType, attachmentImageTypes) {
+		return contentType, nil
+	}
+	return ValidateContentType(head, fileName)
+}
+
+// ValidateAttachmentSize checks a file sent into a chat against the attachment
+// size limit.
+func ValidateAttachmentSize(size int64) error {
+	maxSize := config.App.MaxAttachmentSizeMB * 1024 * 1024
+	if maxSize > 0 && size > maxSize {
+		return &UploadValidationError{
+			Kind:    ErrFileTooLarge,
+			Message: fmt.Sprintf("File exceeds the maximum size of %d MB for chat files", config.App.MaxAttachmentSizeMB),
+		}
+	}
+	return nil
+}
+
+// AttachmentText extracts the text of an attached file once, at upload, cut to
+// what the model is given. Images and files without text give "".
+func AttachmentText(data []byte, contentType string) string {
+	if strings.HasPrefix(contentType, "image/") {
+		return ""
+	}
+	text, err := extractText(data, contentType)
+	if err != nil {
+		return ""
+	}
+	if truncated, cut := truncateUTF8([]byte(text), maxAttachmentText); cut {
+		text = truncated + "\n[truncated]"
+	}
+	return text
+}
+
+// BuildAttachmentObjectKey generates a unique object key for an attachment.
+func BuildAttachmentObjectKey(userID uint, fileName string) string {
+	return fmt.Sprintf("attachments/%d/%d_%s", userID, time.Now().UnixNano(), fileName)
+}
+
+// AttachToMessage links unsent attachments of userID to a new message.
+func AttachToMessage(tx *gorm.DB, userID, messageID uint, ids []uint) error {
+	ids = slices.Compact(slices.Sorted(slices.Values(ids)))
+	if len(ids) == 0 {
+		return nil
+	}
+	result := tx.Model(&models.MessageAttachment{}).
+		Where("id IN ? AND user_id = ? AND message_id IS NULL", ids, userID).
+		Update("message_id", messageID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != int64(len(ids)) {
+		return ErrUnknownAttachment
+	}
+	return nil
+}
+
+// IsVisionModel reports whether model is configured to accept images.
+func IsVisionModel(model string) bool {
+	if config.App == nil {
+		return false
+	}
+	for _, vision := range config.App.VisionModels {
+		if strings.EqualFold(strings.TrimSpace(vision), model) {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteAttachments hard-deletes the attachments matched by query and then
+// their storage objects.
+func deleteAttachments(ctx context.Context, query *gorm.DB) (int, error) {
+	var attachments []models.MessageAttachment
+	if err := query.Find(&attachments).Error; err != nil {
+		return 0, err
+	}
+	if len(attachments) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]uint, 0, len(attachments))
+	for _, attachment := range attachments {
+		ids = append(ids, attachment.ID)
+	}
+	if err := database.DB.Where("id IN ?", ids).Delete(&models.MessageAttachment{}).Error; err != nil {
+		return 0, err
+	}
+	for _, attachment := range attachments {
+		if err := DeleteFile(ctx, attachment.ObjectKey); err != nil {
+			log.Printf("Failed to delete attachment %s: %v", attachment.ObjectKey, err)
+		}
+	}
+	return len(attachments), nil
+}
+
+// PurgeUnsentAttachments deletes attachments that were uploaded but never sent
+// with a message. It returns the number of attachments removed.
+func PurgeUnsentAttachments(ctx context.Context) (int, error) {
+	cutoff := time.Now().Add(-unsentAttachmentExpiry)
+	return deleteAttachments(ctx, database.DB.Where("message_id IS NULL AND created_at < ?", cutoff))
+}
+
+// StartAttachmentGC periodically purges unsent attachments until ctx is cancelled.
+func StartAttachmentGC(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := PurgeUnsentAttachments(ctx)
+			if err != nil {
+				log.Printf("Attachment GC failed: %v", err)
+				continue
+			}
+			if removed > 0 {
+				log.Printf("Attachment GC removed %d unsent attachments", removed)
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"errors"
+
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+)
+
+var ErrCollectionCycle = errors.New("a collection cannot be moved into itself or one of its sub-collections")
+
+// CollectionNode is a collection with its sub-collections and the number of
+// documents directly inside it.
+type CollectionNode struct {
+	models.Collection
+	DocumentCount int64             `json:"document_count"`
+	Children      []*CollectionNode `json:"children"`
+}
+
+// GetCollectionTree returns the user's collections as a tree of root nodes
+// sorted by name.
+func GetCollectionTree(userID uint) ([]*CollectionNode, error) {
+	var collections []models.Collection
+	if err := database.DB.Where("user_id = ?", userID).Order("name").Find(&collections).Error; err != nil {
+		return nil, err
+	}
+
+	var counts []struct {
+		CollectionID uint
+		Count        int64
+	}
+	err := database.DB.Model(&models.Document{}).
+		Select("collection_id, COUNT(*) AS count").
+		Where("user_id = ? AND collection_id IS NOT NULL", userID).
+		Group("collection_id").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[uint]*CollectionNode, len(collections))
+	for _, col := range collections {
+		nodes[col.ID] = &CollectionNode{Collection: col, Children: []*CollectionNode{}}
+	}
+	for _, c := range counts {
+		if node, ok := nodes[c.CollectionID]; ok {
+			node.DocumentCount = c.Count
+		}
+	}
+
+	roots := []*CollectionNode{}
+	for _, col := range collections {
+		node := nodes[col.ID]
+		if parent, ok := nodes[derefID(col.ParentID)]; ok && col.ParentID != nil {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+	return roots, nil
+}
+
+// CollectionSubtreeIDs returns rootID and the IDs of all collections below it.
+func CollectionSubtreeIDs(userID, rootID uint) ([]uint, error) {
+	var collections []models.Collection
+	if err := database.DB.Select("id, parent_id").Where("user_id = ?", userID).Find(&collections).Error; err != nil {
+		return nil, err
+	}
+
+	children := map[uint][]uint{}
+	for _, col := range collections {
+		if col.ParentID != nil {
+			children[*col.ParentID] = append(children[*col.ParentID], col.ID)
+		}
+	}
+
+	ids := []uint{rootID}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, children[ids[i]]...)
+	}
+	return ids, nil
+}
+
+// ValidateCollectionMove checks that moving collectionID under newParentID
+// keeps the tree acyclic.
+func ValidateCollectionMove(userID, collectionID uint, newParentID *uint) error {
+	if newParentID == nil {
+		return nil
+	}
+	subtree, err := CollectionSubtreeIDs(userID, collectionID)
+	if err != nil {
+		return err
+	}
+	for _, id := range subtree {
+		if id == *newParentID {
+			return ErrCollectionCycle
+		}
+	}
+	return nil
+}
+
+func derefID(id *uint) uint {
+	if id == nil {
+		return 0
+	}
+	return *id
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+)
+
+// ConversationExportVersion is the version of the JSON export format.
+// Imports reject other versions.
+const ConversationExportVersion = 1
+
+// maxImportMessages caps the size of an imported conversation.
+const maxImportMessages = 10000
+
+var ErrInvalidConversationImport = errors.New("invalid conversation export")
+
+// ConversationExport is the portable JSON form of a conversation.
+type ConversationExport struct {
+	Version    int               `json:"version"`
+	Title      string            `json:"title"`
+	CreatedAt  time.Time         `json:"created_at"`
+	ExportedAt time.Time         `json:"exported_at"`
+	Messages   []ExportedMessage `json:"messages"`
+}
+
+type ExportedMessage struct {
+	Role      string            `json:"role"`
+	Content   string            `json:"content"`
+	CreatedAt time.Time         `json:"created_at"`
+	Citations []models.Citation `json:"citations,omitempty"`
+}
+
+// ExportConversation loads a conversation's messages in order into the
+// export format.
+func ExportConversation(conversation *models.Conversation) (*ConversationExport, error) {
+	var messages []models.Message
+	if err := database.DB.Where("conversation_id = ?", conversation.ID).Order("created_at asc, id asc").Find(&messages).Error; err != nil {
+		return nil, err
+	}
+
+	export := &ConversationExport{
+		Version:    ConversationExportVersion,
+		Title:      conversation.Title,
+		CreatedAt:  conversation.CreatedAt,
+		ExportedAt: time.Now().UTC(),
+		Messages:   make([]ExportedMessage, 0, len(messages)),
+	}
+	for _, m := range messages {
+		export.Messages = append(export.Messages, ExportedMessage{Role: m.Role, Content: m.Content, CreatedAt: m.CreatedAt, Citations: m.Citations})
+	}
+	return export, nil
+}
+
+// RenderConversationMarkdown renders an export as a Markdown transcript.
+func RenderConversationMarkdown(export *ConversationExport) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# %s\n\n", export.Title)
+	fmt.Fprintf(&b, "_Exported %s_\n", export.ExportedAt.Format(time.RFC3339))
+	for _, m := range export.Messages {
+		fmt.Fprintf(&b, "\n## %s · %s\n\n", roleLabel(m.Role), m.CreatedAt.Format(time.RFC3339))
+		b.WriteString(strings.TrimSpace(m.Content))
+		b.WriteString("\n")
+		if len(m.Citations) > 0 {
+			b.WriteString("\n**Sources:**\n\n")
+			for _, c := range m.Citations {
+				if c.Version > 0 {
+					fmt.Fprintf(&b, "- %s (document %d, file %d, version %d)\n", c.FileName, c.DocumentID, c.FileID, c.Version)
+				} else {
+					fmt.Fprintf(&b, "- %s (document %d, file %d)\n", c.FileName, c.DocumentID, c.FileID)
+				}
+			}
+		}
+	}
+	return b.Bytes()
+}
+
+// RenderConversationHTML renders an export as a standalone HTML page styled
+// for printing, so browsers can save it as a PDF.
+func RenderConversationHTML(export *ConversationExport) ([]byte, error) {
+	var b bytes.Buffer
+	if err := conversationHTML.Execute(&b, export); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// ImportConversation recreates an exported conversation for userID, keeping
+// the original message timestamps.
+func ImportConversation(userID uint, export *ConversationExport) (*models.Conversation, error) {
+	if export.Version != ConversationExportVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidConversationImport, export.Version)
+	}
+	title := strings.TrimSpace(export.Title)
+	if title == "" {
+		return nil, fmt.Errorf("%w: title is required", ErrInvalidConversationImport)
+	}
+	if len(export.Messages) > maxImportMessages {
+		return nil, fmt.Errorf("%w: at most %d messages are allowed", ErrInvalidConversationImport, maxImportMessages)
+	}
+
+	conversation := models.Conversation{UserID: userID, Title: title, CreatedAt: export.CreatedAt}
+	messages := make([]models.Message, 0, len(export.Messages))
+	for i, m := range export.Messages {
+		if m.Role != "user" && m.Role != "assistant" && m.Role != "system" {
+			return nil, fmt.Errorf("%w: message %d has unknown role %q", ErrInvalidConversationImport, i+1, m.Role)
+		}
+		if m.Content == "" {
+			return nil, fmt.Errorf("%w: message %d is empty", ErrInvalidConversationImport, i+1)
+		}
+		// Citations point at documents of the exporting environment, which
+		// may not exist or belong to someone else here
+		messages = append(messages, models.Message{Role: m.Role, Content: m.Content, CreatedAt: m.CreatedAt, UpdatedAt: m.CreatedAt})
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&conversation).Error; err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+		for i := range messages {
+			messages[i].ConversationID = conversation.ID
+		}
+		return tx.CreateInBatches(&messages, 500).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	conversation.Messages = messages
+	return &conversation, nil
+}
+
+func roleLabel(role string) string {
+	switch role {
+	case "user":
+		return "User"
+	case "assistant":
+		return "Assistant"
+	case "system":
+		return "System"
+	default:
+		return role
+	}
+}
+
+var conversationHTML = template.Must(template.New("conversation").Funcs(template.FuncMap{"role": roleLabel}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+@page { size: A4; margin: 2cm; }
+body { font-family: Georgia, serif; font-size: 11pt; line-height: 1.5; color: #000; max-width: 48rem; margin: 0 auto; }
+h1 { font-size: 18pt; margin-bottom: 0; }
+.exported { color: #555; font-size: 9pt; }
+.message { border-top: 1px solid #ccc; padding: 0.5rem 0; break-inside: avoid; page-break-inside: avoid; }
+.meta { font-family: Helvetica, Arial, sans-serif; font-size: 9pt; color: #555; }
+.role { font-weight: bold; color: #000; }
+.content { white-space: pre-wrap; overflow-wrap: anywhere; }
+.sources { font-size: 9pt; color: #333; margin: 0.25rem 0 0; padding-left: 1.25rem; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="exported">Exported {{.ExportedAt.Format "2006-01-02 15:04 MST"}}</p>
+{{range .Messages}}<div class="message">
+<div class="meta"><span class="role">{{role .Role}}</span> &middot; {{.CreatedAt.Format "2006-01-02 15:04"}}</div>
+<div class="content">{{.Content}}</div>
+{{if .Citations}}<ul class="sources">{{range .Citations}}<li>{{.FileName}}</li>{{end}}</ul>
+{{end}}</div>
+{{end}}</body>
+</html>
+`))
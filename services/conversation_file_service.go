@@ -0,0 +1,109 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+)
+
+// MaxConversationFiles caps how many files can be dropped into one
+// conversation.
+const MaxConversationFiles = 10
+
+var (
+	ErrNoExtractableText        = errors.New("no text could be extracted from the file")
+	ErrTooManyConversationFiles = errors.New("too many files in this conversation")
+)
+
+// AddConversationFile extracts the text of an uploaded file and stores it in
+// chunks that only conversationID searches. The file itself is not kept.
+func AddConversationFile(conversationID uint, fileName, contentType string, data []byte) (*models.ConversationFile, error) {
+	text, err := extractText(data, contentType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoExtractableText, err)
+	}
+	passages := splitPassages(text)
+	if len(passages) == 0 {
+		return nil, ErrNoExtractableText
+	}
+
+	file := models.ConversationFile{
+		ConversationID: conversationID,
+		FileName:       fileName,
+		ContentType:    contentType,
+		Size:           int64(len(data)),
+		Chunks:         len(passages),
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Locking the conversation makes concurrent uploads count one at a time
+		var conversation models.Conversation
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&conversation, conversationID).Error; err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&models.ConversationFile{}).Where("conversation_id = ?", conversationID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= MaxConversationFiles {
+			return ErrTooManyConversationFiles
+		}
+
+		if err := tx.Create(&file).Error; err != nil {
+			return err
+		}
+		chunks := make([]models.ConversationFileChunk, 0, len(passages))
+		for i, passage := range passages {
+			chunks = append(chunks, models.ConversationFileChunk{
+				ConversationFileID: file.ID,
+				ConversationID:     conversationID,
+				Position:           i,
+				Text:               passage,
+			})
+		}
+		return tx.CreateInBatches(&chunks, 100).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// conversationFilePassages scores the chunks of the files dropped into
+// conversationID against the terms of a question.
+func conversationFilePassages(conversationID uint, terms []string) ([]Passage, error) {
+	var files []models.ConversationFile
+	if err := database.DB.Where("conversation_id = ?", conversationID).Find(&files).Error; err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+	names := make(map[uint]string, len(files))
+	for _, file := range files {
+		names[file.ID] = file.FileName
+	}
+
+	// Every chunk is scored; their number is bounded by MaxConversationFiles
+	// and the attachment size limit
+	var chunks []models.ConversationFileChunk
+	if err := database.DB.Where("conversation_id = ?", conversationID).Order("conversation_file_id, position").Find(&chunks).Error; err != nil {
+		return nil, err
+	}
+
+	var passages []Passage
+	for _, chunk := range chunks {
+		if score := scorePassage(chunk.Text, terms); score > 0 {
+			passages = append(passages, Passage{
+				ConversationFileID: chunk.ConversationFileID,
+				FileName:           names[chunk.ConversationFileID],
+				Text:               chunk.Text,
+				Score:              score,
+			})
+		}
+	}
+	return passages, nil
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"gorm.io/gorm"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+)
+
+// ConversationFilter narrows a user's conversations. Nil fields mean "no
+// constraint"; all given tags must match.
+type ConversationFilter struct {
+	Pinned   *bool
+	Archived *bool
+	// FolderID selects one folder; Unfiled selects conversations in none
+	FolderID *uint
+	Unfiled  bool
+	Tags     []string
+}
+
+// Apply adds the filter to a query on conversations.
+func (f ConversationFilter) Apply(db *gorm.DB) *gorm.DB {
+	if f.Pinned != nil {
+		db = db.Where("conversations.pinned = ?", *f.Pinned)
+	}
+	if f.Archived != nil {
+		db = db.Where("conversations.archived = ?", *f.Archived)
+	}
+	if f.FolderID != nil {
+		db = db.Where("conversations.folder_id = ?", *f.FolderID)
+	} else if f.Unfiled {
+		db = db.Where("conversations.folder_id IS NULL")
+	}
+	for _, tag := range f.Tags {
+		db = db.Where("EXISTS (SELECT 1 FROM conversation_tags WHERE conversation_tags.conversation_id = conversations.id AND name = ?)", tag)
+	}
+	return db
+}
+
+// SyncConversationTags rewrites the tag index rows of a conversation to match tags.
+func SyncConversationTags(tx *gorm.DB, conversationID uint, tags []string) error {
+	if err := tx.Where("conversation_id = ?", conversationID).Delete(&models.ConversationTag{}).Error; err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+
+	rows := make([]models.ConversationTag, 0, len(tags))
+	for _, tag := range tags {
+		rows = append(rows, models.ConversationTag{ConversationID: conversationID, Name: tag})
+	}
+	return tx.Create(&rows).Error
+}
+
+// GetConversationTags lists the tags used on userID's conversations with how
+// many conversations carry each, most used first.
+func GetConversationTags(userID uint) ([]FacetCount, error) {
+	tags := []FacetCount{}
+	err := database.DB.Model(&models.ConversationTag{}).
+		Select("conversation_tags.name AS value, COUNT(*) AS count").
+		Joins("JOIN conversations ON conversations.id = conversation_tags.conversation_id").
+		Where("conversations.user_id = ? AND conversations.deleted_at IS NULL", userID).
+		Group("conversation_tags.name").
+		Order("count DESC, value").
+		Scan(&tags).Error
+	return tags, err
+}
+
+// ConversationFolderSummary is a folder with the number of conversations in it.
+type ConversationFolderSummary struct {
+	models.ConversationFolder
+	ConversationCount int64 `json:"conversation_count"`
+}
+
+// GetConversationFolders lists userID's folders by name with their
+// conversation counts. Archived conversations are counted too.
+func GetConversationFolders(userID uint) ([]ConversationFolderSummary, error) {
+	var folders []models.ConversationFolder
+	if err := database.DB.Where("user_id = ?", userID).Order("name").Find(&folders).Error; err != nil {
+		return nil, err
+	}
+
+	var counts []struct {
+		FolderID uint
+		Count    int64
+	}
+	err := database.DB.Model(&models.Conversation{}).
+		Select("folder_id, COUNT(*) AS count").
+		Where("user_id = ? AND folder_id IS NOT NULL", userID).
+		Group("folder_id").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	byFolder := make(map[uint]int64, len(counts))
+	for _, c := range counts {
+		byFolder[c.FolderID] = c.Count
+	}
+
+	summaries := make([]ConversationFolderSummary, 0, len(folders))
+	for _, folder := range folders {
+		summaries = append(summaries, ConversationFolderSummary{ConversationFolder: folder, ConversationCount: byFolder[folder.ID]})
+	}
+	return summaries, nil
+}
@@ -0,0 +1,320 @@
+package services
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"hsduc.com/rag/config"
+)
+
+// maxPageBytes caps how much of a single page or sitemap is downloaded.
+const maxPageBytes = 5 * 1024 * 1024
+
+// maxRedirects is how many redirects a single fetch follows.
+const maxRedirects = 10
+
+var (
+	ErrDisallowedByRobots = errors.New("disallowed by robots.txt")
+	ErrPrivateAddress     = errors.New("refusing to connect to a private network address")
+	ErrOffHostRedirect    = errors.New("redirect leaves the source's host")
+)
+
+// CrawledPage is the extracted text of one fetched page.
+type CrawledPage struct {
+	URL   string
+	Title string
+	Text  string
+}
+
+// Crawler fetches pages from a single host, honouring robots.txt and the
+// configured depth and page limits.
+type Crawler struct {
+	client    *http.Client
+	userAgent string
+	maxDepth  int
+	maxPages  int
+	robots    map[string]*robotsRules
+}
+
+// NewCrawler returns a crawler that follows links up to maxDepth hops from
+// the start page and fetches at most maxPages pages.
+func NewCrawler(maxDepth, maxPages int) *Crawler {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !config.App.CrawlAllowPrivate {
+		dialer.Control = rejectPrivateAddress
+	}
+	// No proxy: the dialer must see the target's address for the private
+	// network check to apply
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+
+	if maxPages <= 0 || (config.App.CrawlMaxPages > 0 && maxPages > config.App.CrawlMaxPages) {
+		maxPages = config.App.CrawlMaxPages
+	}
+	c := &Crawler{
+		client:    &http.Client{Transport: transport, Timeout: 30 * time.Second},
+		userAgent: config.App.CrawlUserAgent,
+		maxDepth:  maxDepth,
+		maxPages:  maxPages,
+		robots:    map[string]*robotsRules{},
+	}
+	c.client.CheckRedirect = c.checkRedirect
+	return c
+}
+
+// checkRedirect holds redirects to the rules links are followed by: they must
+// stay on the host first requested and be allowed by robots.txt.
+func (c *Crawler) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if !sameHost(req.URL, via[0].URL) {
+		return fmt.Errorf("%w: %s", ErrOffHostRedirect, req.URL)
+	}
+	// robots.txt itself is being fetched while its rules are not known yet
+	if via[0].URL.Path != "/robots.txt" && !c.robotsFor(req.Context(), req.URL).Allowed(req.URL.RequestURI()) {
+		return fmt.Errorf("%w: %s", ErrDisallowedByRobots, req.URL)
+	}
+	return nil
+}
+
+// rejectPrivateAddress stops the crawler from being pointed at internal
+// services. It runs after DNS resolution, so it also covers hostnames that
+// resolve to private addresses.
+func rejectPrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+	return nil
+}
+
+// CrawlPages fetches start and follows links on the same host breadth-first.
+// Pages that fail after the first one are skipped.
+func (c *Crawler) CrawlPages(ctx context.Context, start string) ([]CrawledPage, error) {
+	startURL, err := parseCrawlURL(start)
+	if err != nil {
+		return nil, err
+	}
+
+	type queued struct {
+		url   string
+		depth int
+	}
+	queue := []queued{{startURL.String(), 0}}
+	seen := map[string]bool{startURL.String(): true}
+	var pages []CrawledPage
+
+	for len(queue) > 0 && len(pages) < c.maxPages {
+		next := queue[0]
+		queue = queue[1:]
+
+		page, links, err := c.fetchPage(ctx, next.url)
+		if err != nil {
+			if next.depth == 0 {
+				return nil, err
+			}
+			continue
+		}
+		pages = append(pages, *page)
+
+		if next.depth >= c.maxDepth {
+			continue
+		}
+		for _, link := range links {
+			u, err := url.Parse(link)
+			if err != nil || !sameHost(u, startURL) || seen[link] {
+				continue
+			}
+			seen[link] = true
+			queue = append(queue, queued{link, next.depth + 1})
+		}
+	}
+	return pages, nil
+}
+
+// CrawlSitemap fetches every page listed in a sitemap or sitemap index on the
+// same host as the sitemap. Listed pages are not followed further.
+func (c *Crawler) CrawlSitemap(ctx context.Context, sitemap string) ([]CrawledPage, error) {
+	sitemapURL, err := parseCrawlURL(sitemap)
+	if err != nil {
+		return nil, err
+	}
+
+	locs, err := c.sitemapLocations(ctx, sitemapURL, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var pages []CrawledPage
+	for _, loc := range locs {
+		if len(pages) >= c.maxPages {
+			break
+		}
+		page, _, err := c.fetchPage(ctx, loc)
+		if err != nil {
+			continue
+		}
+		pages = append(pages, *page)
+	}
+	return pages, nil
+}
+
+type sitemapDocument struct {
+	URLs     []sitemapEntry `xml:"url"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+type sitemapEntry struct {
+	Loc string `xml:"loc"`
+}
+
+// sitemapLocations lists the page URLs of a sitemap, descending one level
+// into sitemap indexes.
+func (c *Crawler) sitemapLocations(ctx context.Context, sitemapURL *url.URL, level int) ([]string, error) {
+	body, _, err := c.fetch(ctx, sitemapURL.String())
+	if err != nil {
+		return nil, err
+	}
+	var doc sitemapDocument
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("invalid sitemap: %w", err)
+	}
+
+	var locs []string
+	seen := map[string]bool{}
+	for _, entry := range doc.URLs {
+		u, err := url.Parse(strings.TrimSpace(entry.Loc))
+		if err != nil || !sameHost(u, sitemapURL) || seen[u.String()] {
+			continue
+		}
+		seen[u.String()] = true
+		locs = append(locs, u.String())
+	}
+	if level > 0 {
+		return locs, nil
+	}
+	for _, entry := range doc.Sitemaps {
+		u, err := url.Parse(strings.TrimSpace(entry.Loc))
+		if err != nil || !sameHost(u, sitemapURL) {
+			continue
+		}
+		nested, err := c.sitemapLocations(ctx, u, level+1)
+		if err != nil {
+			continue
+		}
+		locs = append(locs, nested...)
+	}
+	return locs, nil
+}
+
+// fetchPage downloads a page and extracts its text and links.
+func (c *Crawler) fetchPage(ctx context.Context, pageURL string) (*CrawledPage, []string, error) {
+	body, contentType, err := c.fetch(ctx, pageURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	page := &CrawledPage{URL: pageURL}
+	var links []string
+	switch contentType {
+	case "text/html", "application/xhtml+xml":
+		base, _ := url.Parse(pageURL)
+		page.Title, page.Text, links = extractHTML(body, base)
+	case "text/plain", "text/markdown":
+		page.Text = strings.TrimSpace(string(body))
+	default:
+		return nil, nil, fmt.Errorf("unsupported content type %q", contentType)
+	}
+	return page, links, nil
+}
+
+// fetch GETs a URL after checking robots.txt and returns the body and media type.
+func (c *Crawler) fetch(ctx context.Context, rawURL string) ([]byte, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+	if !c.robotsFor(ctx, u).Allowed(u.RequestURI()) {
+		return nil, "", fmt.Errorf("%w: %s", ErrDisallowedByRobots, rawURL)
+	}
+
+	resp, err := c.get(ctx, rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("fetching %s: %s", rawURL, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPageBytes))
+	if err != nil {
+		return nil, "", err
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return body, mediaType, nil
+}
+
+// robotsFor returns the robots.txt rules of u's host, fetching them once per
+// crawl. A missing or unreadable robots.txt allows everything.
+func (c *Crawler) robotsFor(ctx context.Context, u *url.URL) *robotsRules {
+	origin := u.Scheme + "://" + u.Host
+	if rules, ok := c.robots[origin]; ok {
+		return rules
+	}
+
+	rules := &robotsRules{}
+	if resp, err := c.get(ctx, origin+"/robots.txt"); err == nil {
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			rules = parseRobots(resp.Body, c.userAgent)
+		case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+			// Access to robots.txt itself is restricted, so treat the site as off limits
+			rules = &robotsRules{disallow: []string{"/"}}
+		}
+		resp.Body.Close()
+	}
+	c.robots[origin] = rules
+	return rules
+}
+
+func (c *Crawler) get(ctx context.Context, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	return c.client.Do(req)
+}
+
+// parseCrawlURL validates a user-supplied start URL.
+func parseCrawlURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid URL %q: only http and https URLs can be crawled", raw)
+	}
+	u.Fragment = ""
+	return u, nil
+}
+
+// sameHost keeps crawling on the host the source was added for.
+func sameHost(u, origin *url.URL) bool {
+	return (u.Scheme == "http" || u.Scheme == "https") && strings.EqualFold(u.Host, origin.Host)
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"hsduc.com/rag/config"
+)
+
+func newTestSite(t *testing.T) *httptest.Server {
+	var srv *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "User-agent: *\nDisallow: /private\n")
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `<html><head><title>Home</title><script>var x = 1;</script></head><body>
+			<nav><a href="/guide">Guide</a> <a href="/private/admin">Admin</a> <a href="https://elsewhere.example/">Elsewhere</a></nav>
+			<main><h1>Welcome</h1><p>Start   with the <a href="/guide#install">guide</a>.</p></main>
+			<footer>Copyright</footer></body></html>`)
+	})
+	mux.HandleFunc("/guide", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><head><title>Guide</title></head><body><article><p>Install it.</p><a href="/guide/deep">Deep</a></article></body></html>`)
+	})
+	mux.HandleFunc("/guide/deep", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body><p>Too deep.</p></body></html>`)
+	})
+	mux.HandleFunc("/private/admin", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("robots.txt disallowed page was fetched")
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/private/admin", http.StatusFound)
+	})
+	mux.HandleFunc("/away", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://elsewhere.example/", http.StatusFound)
+	})
+	mux.HandleFunc("/sitemap.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>%s/pages.xml</loc></sitemap>
+</sitemapindex>`, srv.URL)
+	})
+	mux.HandleFunc("/pages.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>%[1]s/guide</loc></url>
+  <url><loc>%[1]s/private/admin</loc></url>
+  <url><loc>https://elsewhere.example/page</loc></url>
+</urlset>`, srv.URL)
+	})
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCrawler(t *testing.T) {
+	config.App = &config.Config{CrawlUserAgent: "RAGBot/1.0", CrawlMaxPages: 100, CrawlAllowPrivate: true}
+	srv := newTestSite(t)
+	ctx := context.Background()
+
+	t.Run("Follows same-host links up to the depth limit", func(t *testing.T) {
+		pages, err := NewCrawler(1, 10).CrawlPages(ctx, srv.URL+"/")
+		assert.NoError(t, err)
+		if assert.Len(t, pages, 2) {
+			assert.Equal(t, "Home", pages[0].Title)
+			assert.Equal(t, "Welcome\nStart with the guide.", pages[0].Text)
+			assert.Equal(t, srv.URL+"/guide", pages[1].URL)
+			assert.Equal(t, "Install it.\nDeep", pages[1].Text)
+		}
+	})
+
+	t.Run("Stops at the page limit", func(t *testing.T) {
+		pages, err := NewCrawler(5, 1).CrawlPages(ctx, srv.URL+"/")
+		assert.NoError(t, err)
+		assert.Len(t, pages, 1)
+	})
+
+	t.Run("Start page disallowed by robots.txt", func(t *testing.T) {
+		_, err := NewCrawler(0, 10).CrawlPages(ctx, srv.URL+"/private/admin")
+		assert.ErrorIs(t, err, ErrDisallowedByRobots)
+	})
+
+	t.Run("Redirects follow the same rules as links", func(t *testing.T) {
+		_, err := NewCrawler(0, 10).CrawlPages(ctx, srv.URL+"/moved")
+		assert.ErrorIs(t, err, ErrDisallowedByRobots)
+		_, err = NewCrawler(0, 10).CrawlPages(ctx, srv.URL+"/away")
+		assert.ErrorIs(t, err, ErrOffHostRedirect)
+	})
+
+	t.Run("Sitemap index", func(t *testing.T) {
+		pages, err := NewCrawler(0, 10).CrawlSitemap(ctx, srv.URL+"/sitemap.xml")
+		assert.NoError(t, err)
+		if assert.Len(t, pages, 1) {
+			assert.Equal(t, srv.URL+"/guide", pages[0].URL)
+		}
+	})
+
+	t.Run("Private addresses are blocked by default", func(t *testing.T) {
+		config.App.CrawlAllowPrivate = false
+		defer func() { config.App.CrawlAllowPrivate = true }()
+
+		_, err := NewCrawler(0, 10).CrawlPages(ctx, srv.URL+"/")
+		assert.ErrorIs(t, err, ErrPrivateAddress)
+	})
+
+	t.Run("Rejects non-http URLs", func(t *testing.T) {
+		_, err := NewCrawler(0, 10).CrawlPages(ctx, "file:///etc/passwd")
+		assert.Error(t, err)
+		assert.True(t, strings.Contains(err.Error(), "only http and https"))
+	})
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"time"
+
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+)
+
+// HashContent returns the hex-encoded SHA-256 of everything read from r.
+func HashContent(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// objectLockRetry is how often a lock on an object held by another request
+// is retried.
+const objectLockRetry = 50 * time.Millisecond
+
+// FindObjectByHash returns the key of an already stored object with the given
+// content hash, so identical uploads can share it. The object is locked
+// against ReleaseObject until the returned function is called, which the
+// caller does once the row referencing the object is saved or has failed. When
+// nothing is found the returned function does nothing.
+func FindObjectByHash(ctx context.Context, hash string) (string, func(), bool) {
+	var existing models.DocumentFile
+	if err := database.DB.Where("content_hash = ?", hash).First(&existing).Error; err != nil {
+		return "", func() {}, false
+	}
+	unlock, err := lockObject(ctx, existing.ObjectKey)
+	if err != nil {
+		// Storing another copy is safe, sharing an object being released is not
+		log.Printf("Failed to lock object %s for deduplication: %v", existing.ObjectKey, err)
+		return "", func() {}, false
+	}
+	// The referencing rows may have been purged while waiting for the lock
+	if referenced, err := objectReferenced(existing.ObjectKey); err != nil || !referenced {
+		unlock()
+		return "", func() {}, false
+	}
+	return existing.ObjectKey, unlock, true
+}
+
+// DedupeStoredObject hashes an object that reached storage without being
+// hashed on the way, such as a direct or resumable upload. When the same
+// content is already stored it deletes the new object and returns the
+// existing one, locked like FindObjectByHash does.
+func DedupeStoredObject(ctx context.Context, objectKey string) (string, string, func(), error) {
+	reader, err := GetFile(ctx, objectKey)
+	if err != nil {
+		return "", "", nil, err
+	}
+	hash, err := HashContent(reader)
+	reader.Close()
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	existing, release, found := FindObjectByHash(ctx, hash)
+	if !found || existing == objectKey {
+		return objectKey, hash, release, nil
+	}
+	if err := DeleteFile(ctx, objectKey); err != nil {
+		log.Printf("Failed to delete duplicate object %s: %v", objectKey, err)
+	}
+	return existing, hash, release, nil
+}
+
+// ReleaseObject deletes an object from storage once no file or file version
+// rows reference it anymore, counting files in the trash. Call it after the
+// referencing row has been permanently deleted.
+func ReleaseObject(ctx context.Context, objectKey string) error {
+	unlock, err := lockObject(ctx, objectKey)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	referenced, err := objectReferenced(objectKey)
+	if err != nil || referenced {
+		return err
+	}
+	return DeleteFile(ctx, objectKey)
+}
+
+// objectReferenced reports whether any file, including those in the trash, or
+// file version points at objectKey.
+func objectReferenced(objectKey string) (bool, error) {
+	var refs, versionRefs int64
+	if err := database.DB.Unscoped().Model(&models.DocumentFile{}).Where("object_key = ?", objectKey).Count(&refs).Error; err != nil {
+		return false, err
+	}
+	if err := database.DB.Model(&models.DocumentFileVersion{}).Where("object_key = ?", objectKey).Count(&versionRefs).Error; err != nil {
+		return false, err
+	}
+	return refs+versionRefs > 0, nil
+}
+
+// lockObject waits for the lock that serializes sharing objectKey with
+// releasing it. The returned function releases the lock.
+func lockObject(ctx context.Context, objectKey string) (func(), error) {
+	for {
+		unlock, ok, err := acquireLock(ctx, "object:"+objectKey+":lock", time.Minute)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return unlock, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(objectLockRetry):
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"gorm.io/gorm"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+)
+
+// Document roles, from least to most privileged. Owners can do everything,
+// including deleting the document and managing its shares; editors can change
+// its content; viewers can read and download it.
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleOwner  = "owner"
+)
+
+var roleRank = map[string]int{RoleViewer: 1, RoleEditor: 2, RoleOwner: 3}
+
+// ValidShareRole reports whether role can be granted through a share.
+func ValidShareRole(role string) bool {
+	return role == RoleViewer || role == RoleEditor
+}
+
+// RoleAtLeast reports whether role grants everything required does.
+func RoleAtLeast(role, required string) bool {
+	return roleRank[role] >= roleRank[required]
+}
+
+// AccessibleDocuments restricts a query on documents to those userID owns or
+// has been granted at least role on, directly or through a group.
+func AccessibleDocuments(db *gorm.DB, userID uint, role string) *gorm.DB {
+	if role == RoleOwner {
+		return db.Where("documents.user_id = ?", userID)
+	}
+	roles := []string{RoleViewer, RoleEditor}
+	if role == RoleEditor {
+		roles = []string{RoleEditor}
+	}
+	return db.Where("(documents.user_id = ? OR documents.id IN (?))", userID, sharedDocumentIDs(userID, roles))
+}
+
+// DocumentRole returns the strongest role userID holds on doc, or "" when the
+// user has no access.
+func DocumentRole(userID uint, doc *models.Document) (string, error) {
+	if doc.UserID == userID {
+		return RoleOwner, nil
+	}
+
+	var roles []string
+	err := database.DB.Model(&models.DocumentShare{}).
+		Where("document_id = ?", doc.ID).
+		Where("(user_id = ? OR group_id IN (?))", userID, memberGroupIDs(userID)).
+		Pluck("role", &roles).Error
+	if err != nil {
+		return "", err
+	}
+
+	best := ""
+	for _, role := range roles {
+		if roleRank[role] > roleRank[best] {
+			best = role
+		}
+	}
+	return best, nil
+}
+
+// IsGroupMember reports whether userID belongs to groupID.
+func IsGroupMember(userID, groupID uint) (bool, error) {
+	var count int64
+	err := database.DB.Model(&models.GroupMember{}).Where("group_id = ? AND user_id = ?", groupID, userID).Count(&count).Error
+	return count > 0, err
+}
+
+func sharedDocumentIDs(userID uint, roles []string) *gorm.DB {
+	return database.DB.Model(&models.DocumentShare{}).
+		Select("document_id").
+		Where("role IN ?", roles).
+		Where("(user_id = ? OR group_id IN (?))", userID, memberGroupIDs(userID))
+}
+
+func memberGroupIDs(userID uint) *gorm.DB {
+	return database.DB.Model(&models.GroupMember{}).
+		Select("group_members.group_id").
+		Joins("JOIN `groups` ON `groups`.id = group_members.group_id AND `groups`.deleted_at IS NULL").
+		Where("group_members.user_id = ?", userID)
+}
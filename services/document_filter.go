@@ -0,0 +1,155 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+)
+
+// DocumentFilter narrows documents or files by collection, labels and file
+// attributes. Zero values mean "no constraint". All given tags and metadata
+// pairs must match; a label on a document also applies to all of its files.
+type DocumentFilter struct {
+	DocumentIDs   []uint
+	CollectionIDs []uint
+	Tags          []string
+	Metadata      map[string]string
+	ContentTypes  []string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	MinSize       int64
+	MaxSize       int64
+}
+
+// ApplyToDocuments adds the filter to a query on documents. Label conditions
+// match labels on the document or on any of its files; file conditions match
+// when at least one file satisfies all of them.
+func (f DocumentFilter) ApplyToDocuments(db *gorm.DB) *gorm.DB {
+	for _, tag := range f.Tags {
+		db = db.Where("EXISTS (SELECT 1 FROM document_labels WHERE document_labels.document_id = documents.id AND kind = 'tag' AND name = ?)", tag)
+	}
+	for _, key := range sortedKeys(f.Metadata) {
+		db = db.Where("EXISTS (SELECT 1 FROM document_labels WHERE document_labels.document_id = documents.id AND kind = 'meta' AND name = ? AND value = ?)", key, f.Metadata[key])
+	}
+	if f.DocumentIDs != nil {
+		db = db.Where("documents.id IN ?", f.DocumentIDs)
+	}
+	if f.CollectionIDs != nil {
+		db = db.Where("documents.collection_id IN ?", f.CollectionIDs)
+	}
+	if f.CreatedAfter != nil {
+		db = db.Where("documents.created_at >= ?", *f.CreatedAfter)
+	}
+	if f.CreatedBefore != nil {
+		db = db.Where("documents.created_at < ?", *f.CreatedBefore)
+	}
+
+	if len(f.ContentTypes) > 0 || f.MinSize > 0 || f.MaxSize > 0 {
+		files := database.DB.Model(&models.DocumentFile{}).Select("1").Where("document_files.document_id = documents.id")
+		db = db.Where("EXISTS (?)", f.applyFileAttributes(files))
+	}
+	return db
+}
+
+// ApplyToFiles adds the filter to a query on document_files that already
+// joins documents.
+func (f DocumentFilter) ApplyToFiles(db *gorm.DB) *gorm.DB {
+	labelScope := "document_labels.document_id = document_files.document_id AND document_labels.document_file_id IN (0, document_files.id)"
+	for _, tag := range f.Tags {
+		db = db.Where("EXISTS (SELECT 1 FROM document_labels WHERE "+labelScope+" AND kind = 'tag' AND name = ?)", tag)
+	}
+	for _, key := range sortedKeys(f.Metadata) {
+		db = db.Where("EXISTS (SELECT 1 FROM document_labels WHERE "+labelScope+" AND kind = 'meta' AND name = ? AND value = ?)", key, f.Metadata[key])
+	}
+	if f.DocumentIDs != nil {
+		db = db.Where("documents.id IN ?", f.DocumentIDs)
+	}
+	if f.CollectionIDs != nil {
+		db = db.Where("documents.collection_id IN ?", f.CollectionIDs)
+	}
+	if f.CreatedAfter != nil {
+		db = db.Where("documents.created_at >= ?", *f.CreatedAfter)
+	}
+	if f.CreatedBefore != nil {
+		db = db.Where("documents.created_at < ?", *f.CreatedBefore)
+	}
+	return f.applyFileAttributes(db)
+}
+
+func (f DocumentFilter) applyFileAttributes(db *gorm.DB) *gorm.DB {
+	if len(f.ContentTypes) > 0 {
+		db = db.Where("document_files.content_type IN ?", f.ContentTypes)
+	}
+	if f.MinSize > 0 {
+		db = db.Where("document_files.size >= ?", f.MinSize)
+	}
+	if f.MaxSize > 0 {
+		db = db.Where("document_files.size <= ?", f.MaxSize)
+	}
+	return db
+}
+
+// FacetCount is the number of documents sharing one facet value.
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// DocumentFacets lists the tags, metadata values and file content types of a
+// user's documents that match filter, with how many documents carry each.
+type DocumentFacets struct {
+	Tags         []FacetCount            `json:"tags"`
+	Metadata     map[string][]FacetCount `json:"metadata"`
+	ContentTypes []FacetCount            `json:"content_types"`
+}
+
+// GetDocumentFacets counts the facet values over the documents userID can
+// read that match filter.
+func GetDocumentFacets(userID uint, filter DocumentFilter) (*DocumentFacets, error) {
+	docIDs := filter.ApplyToDocuments(AccessibleDocuments(database.DB.Model(&models.Document{}).Select("documents.id"), userID, RoleViewer))
+
+	var labels []struct {
+		Kind  string
+		Name  string
+		Value string
+		Count int64
+	}
+	err := database.DB.Model(&models.DocumentLabel{}).
+		Select("kind, name, value, COUNT(DISTINCT document_id) AS count").
+		Where("document_id IN (?)", docIDs).
+		Group("kind, name, value").
+		Order("count DESC, name, value").
+		Scan(&labels).Error
+	if err != nil {
+		return nil, err
+	}
+
+	facets := &DocumentFacets{Tags: []FacetCount{}, Metadata: map[string][]FacetCount{}, ContentTypes: []FacetCount{}}
+	for _, l := range labels {
+		if l.Kind == "tag" {
+			facets.Tags = append(facets.Tags, FacetCount{Value: l.Name, Count: l.Count})
+		} else {
+			facets.Metadata[l.Name] = append(facets.Metadata[l.Name], FacetCount{Value: l.Value, Count: l.Count})
+		}
+	}
+
+	err = database.DB.Model(&models.DocumentFile{}).
+		Select("content_type AS value, COUNT(DISTINCT document_id) AS count").
+		Where("document_id IN (?)", docIDs).
+		Group("content_type").
+		Order("count DESC, value").
+		Scan(&facets.ContentTypes).Error
+	return facets, err
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+)
+
+// Ratings of assistant messages.
+const (
+	RatingUp   = "up"
+	RatingDown = "down"
+)
+
+// Dimensions a feedback report can be grouped by.
+const (
+	FeedbackByModel    = "model"
+	FeedbackByPrompt   = "prompt"
+	FeedbackByDocument = "document"
+)
+
+// FeedbackReportRow aggregates the ratings of one model, prompt version or
+// cited document.
+type FeedbackReportRow struct {
+	Key   string `json:"key"`
+	Title string `json:"title,omitempty"`
+	Up    int    `json:"up"`
+	Down  int    `json:"down"`
+	Total int    `json:"total"`
+	// Score is the share of up ratings, from 0 to 1
+	Score   float64        `json:"score"`
+	Reasons map[string]int `json:"reasons"`
+}
+
+// FeedbackReportFilter limits a report to feedback given, or last changed,
+// within a time range. Nil bounds are open.
+type FeedbackReportFilter struct {
+	Since *time.Time
+	Until *time.Time
+}
+
+type ratedMessage struct {
+	Rating        string
+	Reasons       []string `gorm:"serializer:json"`
+	Model         string
+	PromptVersion string
+	Citations     []models.Citation `gorm:"serializer:json"`
+}
+
+// FeedbackReport aggregates the feedback userID gave on assistant messages by
+// model, prompt version or document, most rated first. A message counts
+// towards every document it cited; messages recorded before models and
+// prompts were tracked are grouped under "unknown".
+func FeedbackReport(userID uint, groupBy string, filter FeedbackReportFilter) ([]FeedbackReportRow, error) {
+	query := database.DB.Model(&models.MessageFeedback{}).
+		Select("message_feedbacks.rating, message_feedbacks.reasons, messages.model, messages.prompt_version, messages.citations").
+		Joins("JOIN messages ON messages.id = message_feedbacks.message_id").
+		Where("message_feedbacks.user_id = ?", userID)
+	if filter.Since != nil {
+		query = query.Where("message_feedbacks.updated_at >= ?", *filter.Since)
+	}
+	if filter.Until != nil {
+		query = query.Where("message_feedbacks.updated_at < ?", *filter.Until)
+	}
+	var rated []ratedMessage
+	if err := query.Find(&rated).Error; err != nil {
+		return nil, err
+	}
+
+	groups := map[string]*FeedbackReportRow{}
+	add := func(key string, msg ratedMessage) {
+		if key == "" {
+			key = "unknown"
+		}
+		row, ok := groups[key]
+		if !ok {
+			row = &FeedbackReportRow{Key: key, Reasons: map[string]int{}}
+			groups[key] = row
+		}
+		row.Total++
+		if msg.Rating == RatingUp {
+			row.Up++
+		} else {
+			row.Down++
+		}
+		for _, reason := range msg.Reasons {
+			row.Reasons[reason]++
+		}
+	}
+	for _, msg := range rated {
+		switch groupBy {
+		case FeedbackByModel:
+			add(msg.Model, msg)
+		case FeedbackByPrompt:
+			add(msg.PromptVersion, msg)
+		case FeedbackByDocument:
+			seen := map[uint]bool{}
+			for _, citation := range msg.Citations {
+				// Files dropped into a conversation belong to no document
+				if citation.DocumentID != 0 && !seen[citation.DocumentID] {
+					seen[citation.DocumentID] = true
+					add(strconv.FormatUint(uint64(citation.DocumentID), 10), msg)
+				}
+			}
+		}
+	}
+
+	rows := make([]FeedbackReportRow, 0, len(groups))
+	for _, row := range groups {
+		row.Score = float64(row.Up) / float64(row.Total)
+		rows = append(rows, *row)
+	}
+	sort.Slice(rows, func(a, b int) bool {
+		if rows[a].Total != rows[b].Total {
+			return rows[a].Total > rows[b].Total
+		}
+		return rows[a].Key < rows[b].Key
+	})
+
+	if groupBy == FeedbackByDocument {
+		if err := titleDocumentRows(rows); err != nil {
+			return nil, err
+		}
+	}
+	return rows, nil
+}
+
+// titleDocumentRows fills in document titles, including those of documents
+// deleted since they were cited.
+func titleDocumentRows(rows []FeedbackReportRow) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.Key)
+	}
+	var documents []models.Document
+	if err := database.DB.Unscoped().Select("id", "title").Where("id IN ?", ids).Find(&documents).Error; err != nil {
+		return err
+	}
+	titles := make(map[string]string, len(documents))
+	for _, doc := range documents {
+		titles[strconv.FormatUint(uint64(doc.ID), 10)] = doc.Title
+	}
+	for i := range rows {
+		rows[i].Title = titles[rows[i].Key]
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"hsduc.com/rag/models"
+)
+
+// AdvanceFileVersion archives the current content of docFile and replaces it
+// with next's content under the next version number.
+func AdvanceFileVersion(tx *gorm.DB, docFile *models.DocumentFile, next *models.DocumentFile) error {
+	archived := CurrentFileVersion(docFile)
+	archived.CreatedAt = time.Time{}
+	if err := tx.Create(&archived).Error; err != nil {
+		return err
+	}
+
+	docFile.Version++
+	docFile.FileName = next.FileName
+	docFile.ObjectKey = next.ObjectKey
+	docFile.ContentType = next.ContentType
+	docFile.Size = next.Size
+	docFile.ContentHash = next.ContentHash
+	docFile.Checksum = next.Checksum
+	return tx.Save(docFile).Error
+}
+
+// CurrentFileVersion describes the current content of a file as a version entry.
+func CurrentFileVersion(docFile *models.DocumentFile) models.DocumentFileVersion {
+	return models.DocumentFileVersion{
+		DocumentFileID: docFile.ID,
+		Version:        docFile.Version,
+		FileName:       docFile.FileName,
+		ObjectKey:      docFile.ObjectKey,
+		ContentType:    docFile.ContentType,
+		Size:           docFile.Size,
+		ContentHash:    docFile.ContentHash,
+		CreatedAt:      docFile.UpdatedAt,
+	}
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// boilerplateTags never contain the main content of a page.
+var boilerplateTags = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Svg: true, atom.Iframe: true, atom.Nav: true, atom.Header: true,
+	atom.Footer: true, atom.Aside: true, atom.Form: true, atom.Button: true,
+	atom.Select: true, atom.Head: true,
+}
+
+// boilerplateRoles mark landmark regions that are not the main content.
+var boilerplateRoles = map[string]bool{
+	"navigation": true, "banner": true, "contentinfo": true, "complementary": true, "search": true,
+}
+
+// blockTags start a new line in the extracted text.
+var blockTags = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true, atom.Main: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Li: true, atom.Ul: true, atom.Ol: true, atom.Tr: true, atom.Table: true,
+	atom.Pre: true, atom.Blockquote: true, atom.Dt: true, atom.Dd: true, atom.Br: true,
+	atom.Hr: true, atom.Figcaption: true,
+}
+
+// extractHTML returns the title, the readable text of the main content and
+// the absolute http(s) links of an HTML page. Navigation, headers, footers,
+// scripts and similar boilerplate are left out of the text, but their links
+// are still returned so crawling can follow them.
+func extractHTML(body []byte, base *url.URL) (title, text string, links []string) {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return "", "", nil
+	}
+
+	var root *html.Node
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Title:
+				if title == "" && n.FirstChild != nil {
+					title = strings.Join(strings.Fields(n.FirstChild.Data), " ")
+				}
+			case atom.Main, atom.Article:
+				// The first <main> or <article> is preferred over the whole body
+				if root == nil || root.DataAtom == atom.Body {
+					root = n
+				}
+			case atom.Body:
+				if root == nil {
+					root = n
+				}
+			case atom.A:
+				if link := resolveLink(base, attr(n, "href")); link != "" {
+					links = append(links, link)
+				}
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+	if root == nil {
+		root = doc
+	}
+
+	var sb strings.Builder
+	writeText(&sb, root)
+	return title, tidyText(sb.String()), links
+}
+
+func writeText(sb *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		sb.WriteString(n.Data)
+		return
+	case html.ElementNode:
+		if boilerplateTags[n.DataAtom] || boilerplateRoles[attr(n, "role")] || attr(n, "aria-hidden") == "true" {
+			return
+		}
+	}
+
+	block := n.Type == html.ElementNode && blockTags[n.DataAtom]
+	if block {
+		sb.WriteString("\n")
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		writeText(sb, child)
+	}
+	if block {
+		sb.WriteString("\n")
+	}
+}
+
+// tidyText collapses whitespace within lines and drops empty lines.
+func tidyText(s string) string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// resolveLink makes href absolute and drops fragments. It returns "" for
+// anything that is not an http(s) URL.
+func resolveLink(base *url.URL, href string) string {
+	if href == "" {
+		return ""
+	}
+	u, err := base.Parse(strings.TrimSpace(href))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	u.Fragment = ""
+	return u.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
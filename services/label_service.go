@@ -0,0 +1,76 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"hsduc.com/rag/models"
+)
+
+const (
+	maxLabels          = 50
+	maxLabelNameLength = 100
+	maxLabelValueChars = 500
+)
+
+var ErrInvalidLabels = errors.New("invalid tags or metadata")
+
+// NormalizeLabels trims tags and metadata, drops empty and duplicate tags and
+// enforces the length and count limits.
+func NormalizeLabels(tags []string, metadata map[string]string) ([]string, map[string]string, error) {
+	if len(tags) > maxLabels || len(metadata) > maxLabels {
+		return nil, nil, fmt.Errorf("%w: at most %d tags and %d metadata entries are allowed", ErrInvalidLabels, maxLabels, maxLabels)
+	}
+
+	seen := map[string]bool{}
+	cleanTags := []string{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxLabelNameLength {
+			return nil, nil, fmt.Errorf("%w: tag %q is longer than %d characters", ErrInvalidLabels, tag, maxLabelNameLength)
+		}
+		seen[tag] = true
+		cleanTags = append(cleanTags, tag)
+	}
+	sort.Strings(cleanTags)
+
+	cleanMeta := map[string]string{}
+	for key, value := range metadata {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return nil, nil, fmt.Errorf("%w: metadata keys must not be empty", ErrInvalidLabels)
+		}
+		if utf8.RuneCountInString(key) > maxLabelNameLength || utf8.RuneCountInString(value) > maxLabelValueChars {
+			return nil, nil, fmt.Errorf("%w: metadata %q is too long", ErrInvalidLabels, key)
+		}
+		cleanMeta[key] = strings.TrimSpace(value)
+	}
+	return cleanTags, cleanMeta, nil
+}
+
+// SyncLabels rewrites the label index rows of a document (fileID 0) or of one
+// of its files to match the given tags and metadata.
+func SyncLabels(tx *gorm.DB, documentID, fileID uint, tags []string, metadata map[string]string) error {
+	if err := tx.Where("document_id = ? AND document_file_id = ?", documentID, fileID).Delete(&models.DocumentLabel{}).Error; err != nil {
+		return err
+	}
+
+	labels := make([]models.DocumentLabel, 0, len(tags)+len(metadata))
+	for _, tag := range tags {
+		labels = append(labels, models.DocumentLabel{DocumentID: documentID, DocumentFileID: fileID, Kind: "tag", Name: tag})
+	}
+	for key, value := range metadata {
+		labels = append(labels, models.DocumentLabel{DocumentID: documentID, DocumentFileID: fileID, Kind: "meta", Name: key, Value: value})
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+	return tx.Create(&labels).Error
+}
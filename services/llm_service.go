@@ -2,8 +2,14 @@ package services
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"io"
 	"log"
+	"math"
 	"strings"
 
 	"github.com/sashabaranov/go-openai"
@@ -11,8 +17,45 @@ import (
 	"hsduc.com/rag/models"
 )
 
+// ChatModel is the model assistant replies are generated with by default;
+// "gpt-4o-mini" acts as a fast/lightweight endpoint.
+const ChatModel = openai.GPT4oMini
+
+const chatSystemPrompt = "You are a helpful and polite chatbot assistant."
+
+// ChatSettings configure how a reply is generated. Zero values use the
+// defaults.
+type ChatSettings struct {
+	Instructions string
+	Model        string
+	Temperature  *float32
+	MaxTokens    int
+}
+
+// ModelName is the model replies are generated with.
+func (s ChatSettings) ModelName() string {
+	if s.Model != "" {
+		return s.Model
+	}
+	return ChatModel
+}
+
+func (s ChatSettings) systemPrompt() string {
+	if strings.TrimSpace(s.Instructions) != "" {
+		return s.Instructions
+	}
+	return chatSystemPrompt
+}
+
+// PromptVersion identifies the system prompt replies are generated with, so
+// feedback can be compared across prompt changes.
+func (s ChatSettings) PromptVersion() string {
+	sum := sha256.Sum256([]byte(s.systemPrompt()))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
 // GetChatbotResponse calls the LLM with the context of the previous messages and document contexts
-func GetChatbotResponse(previousMessages []models.Message, documents []string) (string, error) {
+func GetChatbotResponse(previousMessages []models.Message, documents []string, settings ChatSettings) (string, error) {
 	if config.App == nil || config.App.OpenAIApiKey == "" {
 		return "", errors.New("missing OpenAI API Key")
 	}
@@ -27,7 +70,7 @@ func GetChatbotResponse(previousMessages []models.Message, documents []string) (
 	var chatMessages []openai.ChatCompletionMessage
 
 	// Add system prompt
-	systemPrompt := "You are a helpful and polite chatbot assistant."
+	systemPrompt := settings.systemPrompt()
 	if len(documents) > 0 {
 		systemPrompt += "\n\nPlease use the following context from documents to answer the user's question:\n" + strings.Join(documents, "\n---\n")
 	}
@@ -37,8 +80,11 @@ func GetChatbotResponse(previousMessages []models.Message, documents []string) (
 		Content: systemPrompt,
 	})
 
-	// Add the history up to the last 10 messages
-	for _, m := range previousMessages {
+	// Add the history up to the last 10 messages. Only the images of the
+	// newest message are sent again; earlier ones were answered already
+	ctx := context.Background()
+	vision := IsVisionModel(settings.ModelName())
+	for i, m := range previousMessages {
 		var role string
 		switch m.Role {
 		case "assistant":
@@ -49,18 +95,25 @@ func GetChatbotResponse(previousMessages []models.Message, documents []string) (
 			role = openai.ChatMessageRoleUser
 		}
 
-		chatMessages = append(chatMessages, openai.ChatCompletionMessage{
-			Role:    role,
-			Content: m.Content,
-		})
+		chatMessages = append(chatMessages, chatMessage(ctx, role, &m, vision && i == len(previousMessages)-1))
+	}
+
+	request := openai.ChatCompletionRequest{
+		Model:     settings.ModelName(),
+		Messages:  chatMessages,
+		MaxTokens: settings.MaxTokens,
+	}
+	if settings.Temperature != nil {
+		request.Temperature = *settings.Temperature
+		// The client omits a zero temperature, which the API reads as 1
+		if request.Temperature == 0 {
+			request.Temperature = math.SmallestNonzeroFloat32
+		}
 	}
 
 	resp, err := client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model:    openai.GPT4oMini, // Default fallback model, "gpt-4o-mini" acts as a fast/lightweight endpoint
-			Messages: chatMessages,
-		},
+		ctx,
+		request,
 	)
 
 	if err != nil {
@@ -70,3 +123,62 @@ func GetChatbotResponse(previousMessages []models.Message, documents []string) (
 
 	return resp.Choices[0].Message.Content, nil
 }
+
+// chatMessage converts a message for the API. The text of attached files is
+// appended to the content; image attachments are sent as image parts when
+// images is set and named in the text otherwise.
+func chatMessage(ctx context.Context, role string, m *models.Message, images bool) openai.ChatCompletionMessage {
+	if len(m.Attachments) == 0 {
+		return openai.ChatCompletionMessage{Role: role, Content: m.Content}
+	}
+
+	text := m.Content
+	var imageParts []openai.ChatMessagePart
+	for _, attachment := range m.Attachments {
+		if attachment.IsImage() && images {
+			url, err := imageDataURL(ctx, &attachment)
+			if err == nil {
+				imageParts = append(imageParts, openai.ChatMessagePart{
+					Type:     openai.ChatMessagePartTypeImageURL,
+					ImageURL: &openai.ChatMessageImageURL{URL: url, Detail: openai.ImageURLDetailAuto},
+				})
+				continue
+			}
+			log.Printf("Failed to read attachment %d: %v", attachment.ID, err)
+		}
+		text += "\n\n" + attachmentText(&attachment)
+	}
+
+	if len(imageParts) == 0 {
+		return openai.ChatCompletionMessage{Role: role, Content: text}
+	}
+	parts := []openai.ChatMessagePart{{Type: openai.ChatMessagePartTypeText, Text: text}}
+	return openai.ChatCompletionMessage{Role: role, MultiContent: append(parts, imageParts...)}
+}
+
+// attachmentText describes an attachment that is not sent as an image: the
+// text extracted from a file at upload, or only its name.
+func attachmentText(attachment *models.MessageAttachment) string {
+	if attachment.IsImage() {
+		return fmt.Sprintf("[Attached image %s]", attachment.FileName)
+	}
+	if attachment.Text == "" {
+		return fmt.Sprintf("[Attached file %s]", attachment.FileName)
+	}
+	return fmt.Sprintf("Attached file %s:\n%s", attachment.FileName, attachment.Text)
+}
+
+// imageDataURL inlines a stored image, since the storage backend may not be
+// reachable from the model provider.
+func imageDataURL(ctx context.Context, attachment *models.MessageAttachment) (string, error) {
+	reader, err := GetFile(ctx, attachment.ObjectKey)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	return "data:" + attachment.ContentType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
@@ -21,7 +21,7 @@ func TestGetChatbotResponse_MissingAPIKey(t *testing.T) {
 		{Role: "user", Content: "Hello"},
 	}
 
-	reply, err := GetChatbotResponse(messages, nil)
+	reply, err := GetChatbotResponse(messages, nil, ChatSettings{})
 	assert.Error(t, err)
 	assert.Equal(t, "missing OpenAI API Key", err.Error())
 	assert.Empty(t, reply)
@@ -61,7 +61,7 @@ func TestGetChatbotResponse_Success(t *testing.T) {
 	}
 	docs := []string{"Doc1 content", "Doc2 content"}
 
-	reply, err := GetChatbotResponse(messages, docs)
+	reply, err := GetChatbotResponse(messages, docs, ChatSettings{})
 	assert.NoError(t, err)
 	assert.Equal(t, "Hi there! I am a mock AI.", reply)
 }
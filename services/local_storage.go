@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidObjectKey = errors.New("invalid object key")
+
+// LocalStorage stores objects as plain files under a root directory. Objects
+// live in <root>/objects and their content type and ETag in <root>/meta.
+// Presigned URLs point back at the app, which verifies the HMAC signature.
+type LocalStorage struct {
+	objectsDir string
+	metaDir    string
+	baseURL    string
+	signingKey []byte
+}
+
+type localObjectMeta struct {
+	ContentType string `json:"content_type"`
+	ETag        string `json:"etag"`
+}
+
+// NewLocalStorage creates the storage directories if needed. baseURL is the
+// public URL under which the app serves signed object requests.
+func NewLocalStorage(root, baseURL string, signingKey []byte) (*LocalStorage, error) {
+	if len(signingKey) == 0 {
+		return nil, errors.New("local storage requires a signing key")
+	}
+	s := &LocalStorage{
+		objectsDir: filepath.Join(root, "objects"),
+		metaDir:    filepath.Join(root, "meta"),
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		signingKey: signingKey,
+	}
+	for _, dir := range []string{s.objectsDir, s.metaDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// resolve maps an object key to a path below dir, rejecting keys that would escape it.
+func (s *LocalStorage) resolve(dir, key string) (string, error) {
+	p := filepath.Join(dir, filepath.FromSlash(key))
+	if key == "" || !strings.HasPrefix(p, dir+string(filepath.Separator)) {
+		return "", ErrInvalidObjectKey
+	}
+	return p, nil
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key, contentType string, reader io.Reader, size int64) error {
+	path, err := s.resolve(s.objectsDir, key)
+	if err != nil {
+		return err
+	}
+	metaPath, err := s.resolve(s.metaDir, key+".json")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see a partial object
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := md5.New()
+	written, err := io.Copy(io.MultiWriter(tmp, h), reader)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if size >= 0 && written != size {
+		return fmt.Errorf("object size mismatch: expected %d bytes, got %d", size, written)
+	}
+
+	meta, err := json.Marshal(localObjectMeta{ContentType: contentType, ETag: hex.EncodeToString(h.Sum(nil))})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(metaPath), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(metaPath, meta, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.resolve(s.objectsDir, key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	path, err := s.resolve(s.objectsDir, key)
+	if err != nil {
+		return err
+	}
+	metaPath, err := s.resolve(s.metaDir, key+".json")
+	if err != nil {
+		return err
+	}
+	// Like S3, deleting a missing object is not an error
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.Remove(metaPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStorage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	path, err := s.resolve(s.objectsDir, key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return s.objectInfo(key, fi), nil
+}
+
+func (s *LocalStorage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := filepath.WalkDir(s.objectsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.objectsDir, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, s.objectInfo(key, fi))
+		return nil
+	})
+	return objects, err
+}
+
+func (s *LocalStorage) PresignGet(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return s.presign("GET", key, expiry)
+}
+
+func (s *LocalStorage) PresignPut(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return s.presign("PUT", key, expiry)
+}
+
+// VerifySignature checks a signed URL issued by PresignGet or PresignPut.
+func (s *LocalStorage) VerifySignature(method, key, expires, signature string) bool {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+	expected := s.sign(method, key, expires)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+func (s *LocalStorage) presign(method, key string, expiry time.Duration) (string, error) {
+	if _, err := s.resolve(s.objectsDir, key); err != nil {
+		return "", err
+	}
+	expires := strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+
+	segments := strings.Split(key, "/")
+	for i, seg := range segments {
+		segments[i] = url.PathEscape(seg)
+	}
+	query := url.Values{"expires": {expires}, "signature": {s.sign(method, key, expires)}}
+	return s.baseURL + "/" + strings.Join(segments, "/") + "?" + query.Encode(), nil
+}
+
+func (s *LocalStorage) sign(method, key, expires string) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write([]byte(method + "\n" + key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *LocalStorage) objectInfo(key string, fi fs.FileInfo) ObjectInfo {
+	info := ObjectInfo{Key: key, Size: fi.Size(), LastModified: fi.ModTime()}
+	if metaPath, err := s.resolve(s.metaDir, key+".json"); err == nil {
+		if data, err := os.ReadFile(metaPath); err == nil {
+			var meta localObjectMeta
+			if json.Unmarshal(data, &meta) == nil {
+				info.ContentType = meta.ContentType
+				info.ETag = meta.ETag
+			}
+		}
+	}
+	return info
+}
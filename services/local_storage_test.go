@@ -0,0 +1,85 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalStorage_PutGetStatListDelete(t *testing.T) {
+	store, err := NewLocalStorage(t.TempDir(), "http://localhost:8080/storage", []byte("secret"))
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	content := []byte("hello local storage")
+	assert.NoError(t, store.Put(ctx, "documents/1/1_hello.txt", "text/plain", bytes.NewReader(content), int64(len(content))))
+	assert.NoError(t, store.Put(ctx, "uploads/abc/000000000000", "application/octet-stream", bytes.NewReader(content), int64(len(content))))
+
+	info, err := store.Stat(ctx, "documents/1/1_hello.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(content)), info.Size)
+	assert.Equal(t, "text/plain", info.ContentType)
+	assert.NotEmpty(t, info.ETag)
+
+	r, err := store.Get(ctx, "documents/1/1_hello.txt")
+	assert.NoError(t, err)
+	got, _ := io.ReadAll(r)
+	r.Close()
+	assert.Equal(t, content, got)
+
+	objects, err := store.List(ctx, "documents/")
+	assert.NoError(t, err)
+	assert.Len(t, objects, 1)
+	assert.Equal(t, "documents/1/1_hello.txt", objects[0].Key)
+
+	assert.NoError(t, store.Delete(ctx, "documents/1/1_hello.txt"))
+	_, err = store.Stat(ctx, "documents/1/1_hello.txt")
+	assert.Error(t, err)
+
+	// Deleting a missing object is not an error, matching S3 semantics
+	assert.NoError(t, store.Delete(ctx, "documents/1/1_hello.txt"))
+}
+
+func TestLocalStorage_RejectsSizeMismatch(t *testing.T) {
+	store, _ := NewLocalStorage(t.TempDir(), "http://localhost:8080/storage", []byte("secret"))
+
+	err := store.Put(context.Background(), "documents/1/short.txt", "text/plain", strings.NewReader("abc"), 10)
+	assert.Error(t, err)
+
+	_, err = store.Stat(context.Background(), "documents/1/short.txt")
+	assert.Error(t, err)
+}
+
+func TestLocalStorage_RejectsPathTraversal(t *testing.T) {
+	store, _ := NewLocalStorage(t.TempDir(), "http://localhost:8080/storage", []byte("secret"))
+
+	err := store.Put(context.Background(), "documents/1/../../../escape.txt", "text/plain", strings.NewReader("x"), 1)
+	assert.ErrorIs(t, err, ErrInvalidObjectKey)
+}
+
+func TestLocalStorage_PresignAndVerify(t *testing.T) {
+	store, _ := NewLocalStorage(t.TempDir(), "http://localhost:8080/storage/", []byte("secret"))
+
+	signed, err := store.PresignGet(context.Background(), "documents/1/1_my file.pdf", time.Minute)
+	assert.NoError(t, err)
+
+	u, err := url.Parse(signed)
+	assert.NoError(t, err)
+	assert.Equal(t, "/storage/documents/1/1_my file.pdf", u.Path)
+
+	key := strings.TrimPrefix(u.Path, "/storage/")
+	expires, signature := u.Query().Get("expires"), u.Query().Get("signature")
+	assert.True(t, store.VerifySignature("GET", key, expires, signature))
+	assert.False(t, store.VerifySignature("PUT", key, expires, signature))
+	assert.False(t, store.VerifySignature("GET", "documents/1/other.pdf", expires, signature))
+
+	expired, _ := store.PresignGet(context.Background(), "documents/1/a.pdf", -time.Minute)
+	u, _ = url.Parse(expired)
+	assert.False(t, store.VerifySignature("GET", "documents/1/a.pdf", u.Query().Get("expires"), u.Query().Get("signature")))
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"errors"
+	"html"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+)
+
+// snippetLength is the number of characters of context shown around the
+// first match of a search result.
+const snippetLength = 200
+
+// mysqlMinTokenSize is the default innodb_ft_min_token_size, the length of the
+// shortest word in a MySQL full-text index.
+const mysqlMinTokenSize = 3
+
+// MessageSearchResult is one message matching a search, with the title of its
+// conversation and an excerpt in which the matched terms are wrapped in <mark>.
+// The excerpt is HTML-escaped apart from those tags.
+type MessageSearchResult struct {
+	MessageID         uint      `json:"message_id"`
+	ConversationID    uint      `json:"conversation_id"`
+	ConversationTitle string    `json:"conversation_title"`
+	Role              string    `json:"role"`
+	Snippet           string    `json:"snippet"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// ErrEmptySearch is returned for a search without any words.
+var ErrEmptySearch = errors.New("search has no words")
+
+// SearchMessages finds the messages in userID's conversations that contain
+// every word of query, best matches first, and returns one page of them with
+// the cursor of the next page, or "" on the last page.
+func SearchMessages(userID uint, query string, params ListParams) ([]MessageSearchResult, string, error) {
+	terms := queryWords(query, 1)
+	if len(terms) == 0 {
+		return nil, "", ErrEmptySearch
+	}
+
+	// Relevance gives no stable key to resume after, so the cursor holds the
+	// offset of the next page, tied to the words it was made for.
+	sort := "relevance:" + strings.Join(terms, " ")
+	offset := 0
+	if params.Cursor != "" {
+		_, value, err := decodeCursor(params.Cursor, sort, reflect.TypeOf(offset))
+		if err != nil {
+			return nil, "", err
+		}
+		if offset = value.(int); offset < 0 {
+			return nil, "", ErrInvalidCursor
+		}
+	}
+
+	db := database.DB.Model(&models.Message{}).
+		Joins("JOIN conversations ON conversations.id = messages.conversation_id").
+		Where("conversations.user_id = ? AND conversations.deleted_at IS NULL", userID)
+	if params.UpdatedSince != nil {
+		db = db.Where("messages.updated_at >= ?", *params.UpdatedSince)
+	}
+	db, order := matchMessages(db, terms)
+
+	var rows []struct {
+		models.Message
+		ConversationTitle string
+	}
+	err := db.Select("messages.*, conversations.title AS conversation_title").
+		Order(order).
+		Offset(offset).
+		Limit(params.Limit + 1).
+		Find(&rows).Error
+	if err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if len(rows) > params.Limit {
+		rows = rows[:params.Limit]
+		if next, err = encodeCursor(sort, offset+params.Limit, uint(0)); err != nil {
+			return nil, "", err
+		}
+	}
+
+	results := []MessageSearchResult{}
+	for _, row := range rows {
+		results = append(results, MessageSearchResult{
+			MessageID:         row.ID,
+			ConversationID:    row.ConversationID,
+			ConversationTitle: row.ConversationTitle,
+			Role:              row.Role,
+			Snippet:           highlightSnippet(row.Content, terms),
+			CreatedAt:         row.CreatedAt,
+		})
+	}
+	return results, next, nil
+}
+
+// matchMessages restricts db to messages containing all terms using the
+// full-text index of the database, and returns the relevance ordering.
+func matchMessages(db *gorm.DB, terms []string) (*gorm.DB, clause.OrderBy) {
+	switch {
+	case db.Dialector.Name() == "mysql":
+		var boolean []string
+		for _, term := range terms {
+			// Words shorter than the minimum token size are not in the index
+			if len([]rune(term)) < mysqlMinTokenSize {
+				db = db.Where("LOWER(messages.content) LIKE ?", "%"+term+"%")
+				continue
+			}
+			boolean = append(boolean, "+"+term+"*")
+		}
+		if len(boolean) == 0 {
+			return db, clause.OrderBy{Expression: clause.Expr{SQL: "messages.id DESC"}}
+		}
+		against := strings.Join(boolean, " ")
+		match := "MATCH(messages.content) AGAINST (? IN BOOLEAN MODE)"
+		return db.Where(match, against), clause.OrderBy{Expression: clause.Expr{SQL: match + " DESC, messages.id DESC", Vars: []interface{}{against}}}
+	case db.Migrator().HasTable("messages_fts"):
+		var phrases []string
+		for _, term := range terms {
+			phrases = append(phrases, `"`+term+`"*`)
+		}
+		db = db.Joins("JOIN messages_fts ON messages_fts.rowid = messages.id").
+			Where("messages_fts MATCH ?", strings.Join(phrases, " "))
+		return db, clause.OrderBy{Expression: clause.Expr{SQL: "messages_fts.rank, messages.id DESC"}}
+	default:
+		// Without a full-text index every term is a substring match
+		for _, term := range terms {
+			db = db.Where("LOWER(messages.content) LIKE ?", "%"+term+"%")
+		}
+		return db, clause.OrderBy{Expression: clause.Expr{SQL: "messages.id DESC"}}
+	}
+}
+
+// highlightSnippet cuts an excerpt of content around the first matched term
+// and marks every occurrence of the terms in it.
+func highlightSnippet(content string, terms []string) string {
+	text := []rune(content)
+	// Lower-case rune by rune so indexes line up with text
+	lower := make([]rune, len(text))
+	for i, r := range text {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	type span struct{ start, end int }
+	var matches []span
+	for i := 0; i < len(lower); {
+		matched := 0
+		for _, term := range terms {
+			t := []rune(term)
+			if len(t) > matched && hasRunePrefix(lower[i:], t) {
+				matched = len(t)
+			}
+		}
+		if matched > 0 {
+			matches = append(matches, span{i, i + matched})
+			i += matched
+		} else {
+			i++
+		}
+	}
+
+	start, end := 0, len(text)
+	if len(text) > snippetLength {
+		if len(matches) > 0 {
+			start = max(0, matches[0].start-snippetLength/4)
+		}
+		end = min(len(text), start+snippetLength)
+	}
+
+	var sb strings.Builder
+	if start > 0 {
+		sb.WriteString("…")
+	}
+	pos := start
+	for _, m := range matches {
+		if m.start < start {
+			continue
+		}
+		if m.end > end {
+			break
+		}
+		sb.WriteString(html.EscapeString(string(text[pos:m.start])))
+		sb.WriteString("<mark>" + html.EscapeString(string(text[m.start:m.end])) + "</mark>")
+		pos = m.end
+	}
+	sb.WriteString(html.EscapeString(string(text[pos:end])))
+	if end < len(text) {
+		sb.WriteString("…")
+	}
+	return sb.String()
+}
+
+func hasRunePrefix(s, prefix []rune) bool {
+	if len(s) < len(prefix) {
+		return false
+	}
+	for i, r := range prefix {
+		if s[i] != r {
+			return false
+		}
+	}
+	return true
+}
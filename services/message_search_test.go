@@ -0,0 +1,19 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHighlightSnippet(t *testing.T) {
+	assert.Equal(t, "<mark>Go</mark>lang &amp; <mark>gophers</mark>", highlightSnippet("Golang & gophers", []string{"go", "gophers"}))
+	assert.Equal(t, "No match", highlightSnippet("No match", []string{"xyz"}))
+
+	long := strings.Repeat("filler ", 60) + "the NEEDLE is here " + strings.Repeat("more ", 60)
+	snippet := highlightSnippet(long, []string{"needle"})
+	assert.True(t, strings.HasPrefix(snippet, "…"))
+	assert.True(t, strings.HasSuffix(snippet, "…"))
+	assert.Contains(t, snippet, "the <mark>NEEDLE</mark> is here")
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"io"
+	"log"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// MinioStorage stores objects in a MinIO or S3-compatible bucket.
+type MinioStorage struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewMinioStorage connects to the endpoint and creates the bucket if it does not exist yet.
+func NewMinioStorage(endpoint, accessKey, secretKey, bucket string, useSSL bool) (*MinioStorage, error) {
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: useSSL,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	exists, err := client.BucketExists(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if err = client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{}); err != nil {
+			return nil, err
+		}
+		log.Printf("Created MinIO bucket: %s", bucket)
+	}
+
+	log.Println("Connected to MinIO successfully")
+	return &MinioStorage{client: client, bucket: bucket}, nil
+}
+
+func (s *MinioStorage) Put(ctx context.Context, key, contentType string, reader io.Reader, size int64) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, reader, size, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	return err
+}
+
+func (s *MinioStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+}
+
+func (s *MinioStorage) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *MinioStorage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return minioObjectInfo(info), nil
+}
+
+func (s *MinioStorage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		objects = append(objects, minioObjectInfo(obj))
+	}
+	return objects, nil
+}
+
+func (s *MinioStorage) PresignGet(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, key, expiry, nil)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func (s *MinioStorage) PresignPut(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	u, err := s.client.PresignedPutObject(ctx, s.bucket, key, expiry)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// Compose concatenates the sources server-side. MinIO only allows this when
+// every source but the last is at least 5 MiB; otherwise it reports false so
+// the caller can stream the parts instead.
+func (s *MinioStorage) Compose(ctx context.Context, key, contentType string, sourceKeys []string, sizes []int64) (bool, error) {
+	for i, size := range sizes {
+		if size < 5*1024*1024 && i < len(sizes)-1 {
+			return false, nil
+		}
+	}
+
+	srcs := make([]minio.CopySrcOptions, len(sourceKeys))
+	for i, k := range sourceKeys {
+		srcs[i] = minio.CopySrcOptions{Bucket: s.bucket, Object: k}
+	}
+	_, err := s.client.ComposeObject(ctx, minio.CopyDestOptions{
+		Bucket:      s.bucket,
+		Object:      key,
+		ContentType: contentType,
+	}, srcs...)
+	return true, err
+}
+
+func minioObjectInfo(info minio.ObjectInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:          info.Key,
+		Size:         info.Size,
+		ContentType:  info.ContentType,
+		ETag:         info.ETag,
+		LastModified: info.LastModified,
+	}
+}
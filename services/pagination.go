@@ -0,0 +1,129 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultPageSize applies when a list request gives no limit.
+	DefaultPageSize = 50
+	// MaxPageSize caps the limit of a list request.
+	MaxPageSize = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ListParams selects one page of a list: the rows after Cursor in Sort order,
+// optionally only those updated since a time. Sort is a column name, prefixed
+// with "-" for descending order.
+type ListParams struct {
+	Cursor       string
+	Limit        int
+	Sort         string
+	UpdatedSince *time.Time
+}
+
+// pageCursor is the position after the last row of a page. It records the sort
+// it belongs to so it cannot be replayed against a different order.
+type pageCursor struct {
+	Sort  string          `json:"s"`
+	Value json.RawMessage `json:"v"`
+	ID    uint            `json:"id"`
+}
+
+// Paginate loads the page of db described by params into dest, a pointer to a
+// slice of models stored in table. Rows are ordered by the sort column with the
+// primary key as tie-breaker, so pages stay stable while rows are added. It
+// returns the cursor of the next page, or "" on the last page.
+func Paginate(db *gorm.DB, table string, params ListParams, dest interface{}) (string, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(dest); err != nil {
+		return "", err
+	}
+	column, desc := strings.TrimPrefix(params.Sort, "-"), strings.HasPrefix(params.Sort, "-")
+	field := stmt.Schema.LookUpField(column)
+	if field == nil {
+		return "", fmt.Errorf("unknown sort column %q", column)
+	}
+
+	op, dir := ">", "ASC"
+	if desc {
+		op, dir = "<", "DESC"
+	}
+	// Quoted, since table names such as groups are reserved words in MySQL
+	qualified, idColumn := db.Statement.Quote(table+"."+column), db.Statement.Quote(table+".id")
+
+	if params.UpdatedSince != nil {
+		// Rows that are never changed after creation have no updated_at
+		updated := "updated_at"
+		if stmt.Schema.LookUpField(updated) == nil {
+			updated = "created_at"
+		}
+		db = db.Where(db.Statement.Quote(table+"."+updated)+" >= ?", *params.UpdatedSince)
+	}
+	if params.Cursor != "" {
+		cursor, value, err := decodeCursor(params.Cursor, params.Sort, field.FieldType)
+		if err != nil {
+			return "", err
+		}
+		db = db.Where(fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND %[3]s %[2]s ?))", qualified, op, idColumn), value, value, cursor.ID)
+	}
+
+	err := db.Order(qualified + " " + dir).
+		Order(idColumn + " " + dir).
+		Limit(params.Limit + 1).
+		Find(dest).Error
+	if err != nil {
+		return "", err
+	}
+
+	rows := reflect.ValueOf(dest).Elem()
+	if rows.Len() <= params.Limit {
+		return "", nil
+	}
+	rows.Set(rows.Slice(0, params.Limit))
+
+	last := reflect.Indirect(rows.Index(params.Limit - 1))
+	value, _ := field.ValueOf(db.Statement.Context, last)
+	id, _ := stmt.Schema.PrioritizedPrimaryField.ValueOf(db.Statement.Context, last)
+	return encodeCursor(params.Sort, value, id)
+}
+
+func encodeCursor(sort string, value, id interface{}) (string, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	idValue, _ := id.(uint)
+	data, err := json.Marshal(pageCursor{Sort: sort, Value: raw, ID: idValue})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor parses a cursor made for sort and converts its value to the
+// type of the sort column.
+func decodeCursor(encoded, sort string, valueType reflect.Type) (*pageCursor, interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil, ErrInvalidCursor
+	}
+	var cursor pageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Sort != sort {
+		return nil, nil, ErrInvalidCursor
+	}
+	value := reflect.New(valueType)
+	if err := json.Unmarshal(cursor.Value, value.Interface()); err != nil {
+		return nil, nil, ErrInvalidCursor
+	}
+	return &cursor, value.Elem().Interface(), nil
+}
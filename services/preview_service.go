@@ -0,0 +1,250 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"mime"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+)
+
+// MaxPreviewBytes caps how much of a file is loaded to build a preview.
+const MaxPreviewBytes = 20 * 1024 * 1024
+
+// maxPreviewText caps the text returned for plain text formats.
+const maxPreviewText = 1024 * 1024
+
+var ErrPreviewUnsupported = errors.New("preview is not available for this file type")
+
+// Preview is a renderable representation of a document file. Exactly one of
+// Text, HTML or Pages is set, depending on Kind.
+type Preview struct {
+	Kind        string        `json:"kind"` // "text", "html" or "pages"
+	ContentType string        `json:"content_type"`
+	Text        string        `json:"text,omitempty"`
+	HTML        string        `json:"html,omitempty"`
+	Pages       []PreviewPage `json:"pages,omitempty"`
+	Truncated   bool          `json:"truncated"`
+}
+
+// PreviewPage is the text of one PDF page, positioned in PDF points with the
+// origin at the bottom-left corner.
+type PreviewPage struct {
+	Number int         `json:"number"`
+	Width  float64     `json:"width"`
+	Height float64     `json:"height"`
+	Lines  []TextBlock `json:"lines"`
+}
+
+type TextBlock struct {
+	Text string  `json:"text"`
+	X    float64 `json:"x"`
+	Y    float64 `json:"y"`
+}
+
+var htmlPolicy = bluemonday.UGCPolicy()
+
+// BuildPreview renders file content according to its media type.
+func BuildPreview(data []byte, contentType string) (*Preview, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	preview := &Preview{ContentType: mediaType}
+
+	switch mediaType {
+	case "application/pdf":
+		pages, err := pdfPages(data)
+		if err != nil {
+			return nil, err
+		}
+		preview.Kind = "pages"
+		preview.Pages = pages
+	case "text/markdown":
+		var buf bytes.Buffer
+		if err := goldmark.Convert(data, &buf); err != nil {
+			return nil, err
+		}
+		preview.Kind = "html"
+		preview.HTML = htmlPolicy.Sanitize(buf.String())
+	case "text/html":
+		preview.Kind = "html"
+		preview.HTML = string(htmlPolicy.SanitizeBytes(data))
+	case "application/vnd.openxmlformats-officedocument.wordprocessingml.document":
+		body, err := docxHTML(data)
+		if err != nil {
+			return nil, err
+		}
+		preview.Kind = "html"
+		preview.HTML = htmlPolicy.Sanitize(body)
+	case "text/plain", "text/csv", "application/json":
+		preview.Kind = "text"
+		preview.Text, preview.Truncated = truncateUTF8(data, maxPreviewText)
+	default:
+		return nil, ErrPreviewUnsupported
+	}
+
+	return preview, nil
+}
+
+func pdfPages(data []byte) (pages []PreviewPage, err error) {
+	// The PDF parser panics on some malformed files
+	defer func() {
+		if r := recover(); r != nil {
+			pages, err = nil, fmt.Errorf("invalid PDF: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	pages = make([]PreviewPage, 0, reader.NumPage())
+	for i := 1; i <= reader.NumPage(); i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+
+		preview := PreviewPage{Number: i, Lines: []TextBlock{}}
+		if box := pdfMediaBox(page); box.Len() == 4 {
+			preview.Width = box.Index(2).Float64() - box.Index(0).Float64()
+			preview.Height = box.Index(3).Float64() - box.Index(1).Float64()
+		}
+
+		preview.Lines = pdfLines(page.Content().Text)
+		pages = append(pages, preview)
+	}
+	return pages, nil
+}
+
+// pdfLines groups the glyphs of a page into lines, ordered top to bottom and
+// left to right. A space is inserted where the gap between glyphs suggests one.
+func pdfLines(glyphs []pdf.Text) []TextBlock {
+	rows := make(map[int][]pdf.Text)
+	for _, g := range glyphs {
+		y := int(math.Round(g.Y))
+		rows[y] = append(rows[y], g)
+	}
+	ys := make([]int, 0, len(rows))
+	for y := range rows {
+		ys = append(ys, y)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(ys)))
+
+	lines := make([]TextBlock, 0, len(ys))
+	for _, y := range ys {
+		row := rows[y]
+		sort.SliceStable(row, func(a, b int) bool { return row[a].X < row[b].X })
+
+		var text strings.Builder
+		for i, g := range row {
+			if i > 0 {
+				prev := row[i-1]
+				if g.X-(prev.X+prev.W) > g.FontSize*0.2 && !strings.HasSuffix(prev.S, " ") {
+					text.WriteByte(' ')
+				}
+			}
+			text.WriteString(g.S)
+		}
+		if s := strings.TrimSpace(text.String()); s != "" {
+			lines = append(lines, TextBlock{Text: s, X: row[0].X, Y: float64(y)})
+		}
+	}
+	return lines
+}
+
+// pdfMediaBox returns the page size rectangle, which pages may inherit from
+// their parent page tree nodes.
+func pdfMediaBox(page pdf.Page) pdf.Value {
+	for v := page.V; !v.IsNull(); v = v.Key("Parent") {
+		if box := v.Key("MediaBox"); !box.IsNull() {
+			return box
+		}
+	}
+	return pdf.Value{}
+}
+
+// docxHTML converts the paragraphs of a DOCX file to simple HTML, mapping
+// Word heading styles to heading tags and dropping all other formatting.
+func docxHTML(data []byte) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	doc, err := archive.Open("word/document.xml")
+	if err != nil {
+		return "", err
+	}
+	defer doc.Close()
+
+	var out strings.Builder
+	var text strings.Builder
+	style := ""
+	decoder := xml.NewDecoder(io.LimitReader(doc, MaxPreviewBytes))
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				text.Reset()
+				style = ""
+			case "pStyle":
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "val" {
+						style = attr.Value
+					}
+				}
+			case "t":
+				var s string
+				if err := decoder.DecodeElement(&s, &t); err != nil {
+					return "", err
+				}
+				text.WriteString(s)
+			case "tab":
+				text.WriteString("\t")
+			case "br":
+				text.WriteString("\n")
+			}
+		case xml.EndElement:
+			if t.Name.Local != "p" || strings.TrimSpace(text.String()) == "" {
+				continue
+			}
+			tag := "p"
+			if level := strings.TrimPrefix(style, "Heading"); level != style && len(level) == 1 && level >= "1" && level <= "6" {
+				tag = "h" + level
+			}
+			out.WriteString("<" + tag + ">" + html.EscapeString(text.String()) + "</" + tag + ">\n")
+		}
+	}
+	return out.String(), nil
+}
+
+// truncateUTF8 returns at most limit bytes of data without splitting a rune.
+func truncateUTF8(data []byte, limit int) (string, bool) {
+	if len(data) <= limit {
+		return string(data), false
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(data[cut]) {
+		cut--
+	}
+	return string(data[:cut]), true
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildPreview(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+		check       func(t *testing.T, p *Preview)
+	}{
+		{
+			name:        "Markdown is rendered and sanitized",
+			data:        []byte("# Title\n\nSome *text*\n\n<script>alert(1)</script>"),
+			contentType: "text/markdown; charset=utf-8",
+			check: func(t *testing.T, p *Preview) {
+				assert.Equal(t, "html", p.Kind)
+				assert.Equal(t, "text/markdown", p.ContentType)
+				assert.Contains(t, p.HTML, "<h1>Title</h1>")
+				assert.Contains(t, p.HTML, "<em>text</em>")
+				assert.NotContains(t, p.HTML, "script")
+			},
+		},
+		{
+			name:        "HTML is sanitized",
+			data:        []byte(`<p onclick="steal()">Hello</p><iframe src="x"></iframe>`),
+			contentType: "text/html",
+			check: func(t *testing.T, p *Preview) {
+				assert.Equal(t, "<p>Hello</p>", p.HTML)
+			},
+		},
+		{
+			name:        "DOCX headings and paragraphs",
+			data:        buildTestDocx(t),
+			contentType: "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+			check: func(t *testing.T, p *Preview) {
+				assert.Equal(t, "html", p.Kind)
+				assert.Equal(t, "<h2>Leave policy</h2>\n<p>Employees get 12 days &lt;paid&gt;.</p>\n", p.HTML)
+			},
+		},
+		{
+			name:        "PDF lines with coordinates",
+			data:        buildTestPDF(),
+			contentType: "application/pdf",
+			check: func(t *testing.T, p *Preview) {
+				assert.Equal(t, "pages", p.Kind)
+				if assert.Len(t, p.Pages, 1) {
+					page := p.Pages[0]
+					assert.Equal(t, 612.0, page.Width)
+					assert.Equal(t, 792.0, page.Height)
+					if assert.Len(t, page.Lines, 2) {
+						assert.Equal(t, TextBlock{Text: "First line", X: 72, Y: 720}, page.Lines[0])
+						assert.Equal(t, TextBlock{Text: "Second line", X: 72, Y: 700}, page.Lines[1])
+					}
+				}
+			},
+		},
+		{
+			name:        "Long text is truncated",
+			data:        []byte(strings.Repeat("é", maxPreviewText)),
+			contentType: "text/plain",
+			check: func(t *testing.T, p *Preview) {
+				assert.Equal(t, "text", p.Kind)
+				assert.True(t, p.Truncated)
+				assert.Len(t, p.Text, maxPreviewText)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			preview, err := BuildPreview(tt.data, tt.contentType)
+			assert.NoError(t, err)
+			if preview != nil {
+				tt.check(t, preview)
+			}
+		})
+	}
+
+	_, err := BuildPreview([]byte{0x89, 'P', 'N', 'G'}, "image/png")
+	assert.ErrorIs(t, err, ErrPreviewUnsupported)
+
+	_, err = BuildPreview([]byte("%PDF-1.4 garbage"), "application/pdf")
+	assert.Error(t, err)
+}
+
+func buildTestDocx(t *testing.T) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("word/document.xml")
+	assert.NoError(t, err)
+	w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p><w:pPr><w:pStyle w:val="Heading2"/></w:pPr><w:r><w:t>Leave policy</w:t></w:r></w:p>
+<w:p><w:r><w:t xml:space="preserve">Employees get </w:t></w:r><w:r><w:t>12 days &lt;paid&gt;.</w:t></w:r></w:p>
+<w:p/>
+</w:body></w:document>`))
+	assert.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+// buildTestPDF writes a one page PDF with two lines of text and a valid xref table.
+func buildTestPDF() []byte {
+	stream := "BT /F1 12 Tf 72 720 Td (First line) Tj ET BT /F1 12 Tf 72 700 Td (Second line) Tj ET"
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 /MediaBox [0 0 612 792] >>",
+		"<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
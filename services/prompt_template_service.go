@@ -0,0 +1,97 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+)
+
+// ErrMissingTemplateVariables is returned when a template is rendered without
+// a value for every variable it uses.
+var ErrMissingTemplateVariables = errors.New("missing template variables")
+
+var templateVariable = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// TemplateVariables lists the distinct variables of content in order of
+// first use.
+func TemplateVariables(content string) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, match := range templateVariable.FindAllStringSubmatch(content, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+// RenderTemplate substitutes values for the variables of content. Every
+// variable needs a non-blank value; values without a variable are ignored.
+func RenderTemplate(content string, values map[string]string) (string, error) {
+	var missing []string
+	for _, name := range TemplateVariables(content) {
+		if strings.TrimSpace(values[name]) == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("%w: %s", ErrMissingTemplateVariables, strings.Join(missing, ", "))
+	}
+
+	return templateVariable.ReplaceAllStringFunc(content, func(placeholder string) string {
+		return values[templateVariable.FindStringSubmatch(placeholder)[1]]
+	}), nil
+}
+
+// VisiblePromptTemplates scopes a query to the templates userID can use: their
+// own and every shared one.
+func VisiblePromptTemplates(userID uint) *gorm.DB {
+	return database.DB.Where("user_id = ? OR visibility = ?", userID, models.PromptTemplateShared)
+}
+
+// AdvancePromptTemplateVersion archives the current content of tpl and
+// replaces it with content under the next version number.
+func AdvancePromptTemplateVersion(tx *gorm.DB, tpl *models.PromptTemplate, content string) error {
+	archived := CurrentPromptTemplateVersion(tpl)
+	archived.CreatedAt = time.Time{}
+	if err := tx.Create(&archived).Error; err != nil {
+		return err
+	}
+
+	tpl.Version++
+	tpl.Content = content
+	tpl.Variables = TemplateVariables(content)
+	return tx.Save(tpl).Error
+}
+
+// CurrentPromptTemplateVersion describes the current content of a template as
+// a version entry.
+func CurrentPromptTemplateVersion(tpl *models.PromptTemplate) models.PromptTemplateVersion {
+	return models.PromptTemplateVersion{
+		PromptTemplateID: tpl.ID,
+		Version:          tpl.Version,
+		Content:          tpl.Content,
+		Variables:        tpl.Variables,
+		CreatedAt:        tpl.UpdatedAt,
+	}
+}
+
+// PromptTemplateVersionContent returns the content of one version of tpl,
+// which may be the current one.
+func PromptTemplateVersionContent(tpl *models.PromptTemplate, version int) (string, error) {
+	if version == tpl.Version {
+		return tpl.Content, nil
+	}
+	var archived models.PromptTemplateVersion
+	if err := database.DB.Where("prompt_template_id = ? AND version = ?", tpl.ID, version).First(&archived).Error; err != nil {
+		return "", err
+	}
+	return archived.Content, nil
+}
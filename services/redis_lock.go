@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"hsduc.com/rag/database"
+)
+
+// Locker takes named locks, reporting false when someone else holds the lock.
+// The returned function releases it.
+type Locker interface {
+	Acquire(ctx context.Context, key string, ttl time.Duration) (func(), bool, error)
+}
+
+// Locks takes the upload and crawl locks. Redis shares them between server
+// instances; tests swap in a LocalLocker.
+var Locks Locker = RedisLocker{}
+
+// The lock scripts only touch the key while it still holds the caller's token,
+// so a holder whose lock expired cannot extend or release a lock taken since.
+var (
+	extendLockScript  = redis.NewScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) end return 0`)
+	releaseLockScript = redis.NewScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`)
+)
+
+// RedisLocker keeps locks in Redis. While held, a lock is extended every third
+// of ttl, so ttl only bounds how long the lock outlives a holder that died.
+type RedisLocker struct{}
+
+func (RedisLocker) Acquire(ctx context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	token := uuid.New().String()
+	ok, err := database.Redis.SetNX(ctx, key, token, ttl).Result()
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				extendLockScript.Run(context.Background(), database.Redis, []string{key}, token, ttl.Milliseconds())
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		releaseLockScript.Run(context.Background(), database.Redis, []string{key}, token)
+	}, true, nil
+}
+
+// LocalLocker keeps locks in memory, which only excludes holders within one
+// process. The ttl is ignored since a holder cannot die without the process.
+type LocalLocker struct {
+	mu   sync.Mutex
+	held map[string]bool
+}
+
+func NewLocalLocker() *LocalLocker {
+	return &LocalLocker{held: map[string]bool{}}
+}
+
+func (l *LocalLocker) Acquire(ctx context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.held[key] {
+		return nil, false, nil
+	}
+	l.held[key] = true
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			delete(l.held, key)
+			l.mu.Unlock()
+		})
+	}, true, nil
+}
+
+// acquireLock takes the lock at key with Locks.
+func acquireLock(ctx context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	return Locks.Acquire(ctx, key, ttl)
+}
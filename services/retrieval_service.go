@@ -0,0 +1,244 @@
+package services
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+)
+
+const (
+	// maxRetrievalFiles caps how many of the most recently updated files are
+	// searched for one question.
+	maxRetrievalFiles = 20
+	// passageLength is the target size of a passage in bytes.
+	passageLength = 1000
+)
+
+// Passage is a piece of a document file, or of a file dropped into a
+// conversation, that is relevant to a question.
+type Passage struct {
+	DocumentID         uint    `json:"document_id"`
+	FileID             uint    `json:"file_id"`
+	ConversationFileID uint    `json:"conversation_file_id,omitempty"`
+	FileName           string  `json:"file_name"`
+	Version            int     `json:"version,omitempty"`
+	Text               string  `json:"text"`
+	Score              float64 `json:"score"`
+}
+
+// RetrievePassages returns up to limit passages from the files the user owns
+// or has been shared that match filter, ranked by how often they mention the terms of query.
+func RetrievePassages(ctx context.Context, userID uint, query string, filter DocumentFilter, limit int) ([]Passage, error) {
+	terms := queryTerms(query)
+	if len(terms) == 0 || Store == nil {
+		return nil, nil
+	}
+
+	var files []models.DocumentFile
+	readable := AccessibleDocuments(database.DB.Joins("JOIN documents ON documents.id = document_files.document_id"), userID, RoleViewer)
+	err := filter.ApplyToFiles(readable.Where("documents.deleted_at IS NULL AND document_files.size <= ?", MaxPreviewBytes)).
+		Order("document_files.updated_at DESC").
+		Limit(maxRetrievalFiles).
+		Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+
+	chunks, err := fileChunks(ctx, files)
+	if err != nil {
+		return nil, err
+	}
+
+	var passages []Passage
+	for _, file := range files {
+		for _, chunk := range chunks[file.ID] {
+			if score := scorePassage(chunk, terms); score > 0 {
+				passages = append(passages, Passage{
+					DocumentID: file.DocumentID,
+					FileID:     file.ID,
+					FileName:   file.FileName,
+					Version:    file.Version,
+					Text:       chunk,
+					Score:      score,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(passages, func(a, b int) bool { return passages[a].Score > passages[b].Score })
+	if len(passages) > limit {
+		passages = passages[:limit]
+	}
+	return passages, nil
+}
+
+// fileChunks returns the passages of each of files by file ID. Passages are
+// read from DocumentFileChunk rows; a file whose object was never chunked is
+// downloaded and chunked first, and left out when its object cannot be read.
+func fileChunks(ctx context.Context, files []models.DocumentFile) (map[uint][]string, error) {
+	chunks := map[uint][]string{}
+	var chunked []uint
+	for _, file := range files {
+		if file.ChunkedObjectKey == file.ObjectKey {
+			chunked = append(chunked, file.ID)
+			continue
+		}
+		passages, err := chunkFile(ctx, &file)
+		if err != nil {
+			log.Printf("Failed to read file %d for retrieval: %v", file.ID, err)
+			continue
+		}
+		chunks[file.ID] = passages
+	}
+	if len(chunked) == 0 {
+		return chunks, nil
+	}
+
+	var rows []models.DocumentFileChunk
+	if err := database.DB.Where("document_file_id IN ?", chunked).Order("document_file_id, position").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		chunks[row.DocumentFileID] = append(chunks[row.DocumentFileID], row.Text)
+	}
+	return chunks, nil
+}
+
+// chunkFile extracts the passages of the current object of file and stores
+// them as its DocumentFileChunk rows. Content without extractable text is
+// recorded with no chunks so it is not downloaded again.
+func chunkFile(ctx context.Context, file *models.DocumentFile) ([]string, error) {
+	reader, err := GetFile(ctx, file.ObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, MaxPreviewBytes))
+	if err != nil {
+		return nil, err
+	}
+	text, _ := extractText(data, file.ContentType)
+	passages := splitPassages(text)
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Claiming the file first keeps concurrent questions from storing the
+		// chunks twice. UpdateColumn leaves updated_at, which orders files, alone.
+		claim := tx.Model(&models.DocumentFile{}).
+			Where("id = ? AND chunked_object_key = ?", file.ID, file.ChunkedObjectKey).
+			UpdateColumn("chunked_object_key", file.ObjectKey)
+		if claim.Error != nil || claim.RowsAffected == 0 {
+			return claim.Error
+		}
+		if err := tx.Where("document_file_id = ?", file.ID).Delete(&models.DocumentFileChunk{}).Error; err != nil {
+			return err
+		}
+		rows := make([]models.DocumentFileChunk, 0, len(passages))
+		for i, passage := range passages {
+			rows = append(rows, models.DocumentFileChunk{DocumentFileID: file.ID, Position: i, Text: passage})
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&rows, 100).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return passages, nil
+}
+
+// extractText extracts the plain text of file content using the preview
+// renderers.
+func extractText(data []byte, contentType string) (string, error) {
+	preview, err := BuildPreview(data, contentType)
+	if err != nil {
+		return "", err
+	}
+
+	switch preview.Kind {
+	case "html":
+		_, text, _ := extractHTML([]byte(preview.HTML), &url.URL{})
+		return text, nil
+	case "pages":
+		var sb strings.Builder
+		for _, page := range preview.Pages {
+			for _, line := range page.Lines {
+				sb.WriteString(line.Text + "\n")
+			}
+			sb.WriteString("\n")
+		}
+		return sb.String(), nil
+	default:
+		return preview.Text, nil
+	}
+}
+
+// splitPassages groups lines into passages of about passageLength bytes,
+// breaking only between lines.
+func splitPassages(text string) []string {
+	var passages []string
+	var current strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if current.Len() > 0 && current.Len()+len(line) > passageLength {
+			passages = append(passages, current.String())
+			current.Reset()
+		}
+		if current.Len() > 0 {
+			current.WriteString("\n")
+		}
+		current.WriteString(line)
+	}
+	if current.Len() > 0 {
+		passages = append(passages, current.String())
+	}
+	return passages
+}
+
+// queryTerms returns the distinct lower-cased words of a question, ignoring
+// words too short to be meaningful.
+func queryTerms(query string) []string {
+	return queryWords(query, 3)
+}
+
+// queryWords returns the distinct lower-cased words of query that have at
+// least minLength characters.
+func queryWords(query string, minLength int) []string {
+	seen := map[string]bool{}
+	var terms []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if len([]rune(word)) < minLength || seen[word] {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+	}
+	return terms
+}
+
+// scorePassage counts the distinct query terms in a passage, with a smaller
+// bonus for repeated mentions.
+func scorePassage(passage string, terms []string) float64 {
+	lower := strings.ToLower(passage)
+	score := 0.0
+	for _, term := range terms {
+		if n := strings.Count(lower, term); n > 0 {
+			score += 1 + 0.1*float64(n-1)
+		}
+	}
+	return score
+}
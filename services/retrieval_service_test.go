@@ -0,0 +1,28 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryTerms(t *testing.T) {
+	assert.Equal(t, []string{"how", "long", "the", "refund", "window"}, queryTerms("How long is the refund window? Refund!"))
+	assert.Empty(t, queryTerms("a ? is"))
+}
+
+func TestSplitPassages(t *testing.T) {
+	line := strings.Repeat("x", 400)
+	passages := splitPassages(line + "\n\n" + line + "\n" + line + "\n  \n" + "tail")
+
+	assert.Len(t, passages, 2)
+	assert.Equal(t, line+"\n"+line, passages[0])
+	assert.Equal(t, line+"\ntail", passages[1])
+}
+
+func TestScorePassage(t *testing.T) {
+	terms := queryTerms("refund window")
+	assert.Zero(t, scorePassage("Shipping takes five days.", terms))
+	assert.Greater(t, scorePassage("The refund window is 30 days.", terms), scorePassage("Refund, refund, refund.", terms))
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// robotsRules holds the Allow/Disallow rules of a robots.txt that apply to
+// one user agent.
+type robotsRules struct {
+	allow    []string
+	disallow []string
+}
+
+// parseRobots extracts the rules for userAgent from a robots.txt body. The
+// most specific matching group wins, falling back to the "*" group.
+func parseRobots(r io.Reader, userAgent string) *robotsRules {
+	agent := strings.ToLower(userAgent)
+	if i := strings.IndexAny(agent, "/ "); i >= 0 {
+		agent = agent[:i]
+	}
+
+	groups := map[string]*robotsRules{}
+	var current []*robotsRules
+	inAgents := false
+
+	scanner := bufio.NewScanner(io.LimitReader(r, 512*1024))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		field, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		field = strings.ToLower(strings.TrimSpace(field))
+		value = strings.TrimSpace(value)
+
+		switch field {
+		case "user-agent":
+			// Consecutive user-agent lines share one group
+			if !inAgents {
+				current = nil
+			}
+			inAgents = true
+			name := strings.ToLower(value)
+			if groups[name] == nil {
+				groups[name] = &robotsRules{}
+			}
+			current = append(current, groups[name])
+		case "allow", "disallow":
+			inAgents = false
+			// An empty rule matches nothing
+			if value == "" {
+				continue
+			}
+			for _, g := range current {
+				if field == "allow" {
+					g.allow = append(g.allow, value)
+				} else {
+					g.disallow = append(g.disallow, value)
+				}
+			}
+		default:
+			inAgents = false
+		}
+	}
+
+	best := ""
+	for name := range groups {
+		if name != "*" && strings.Contains(agent, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best != "" {
+		return groups[best]
+	}
+	if rules, ok := groups["*"]; ok {
+		return rules
+	}
+	return &robotsRules{}
+}
+
+// Allowed reports whether the path (including query) may be fetched. The
+// longest matching rule wins and Allow wins ties, as in RFC 9309.
+func (r *robotsRules) Allowed(path string) bool {
+	allowLen, disallowLen := -1, -1
+	for _, p := range r.allow {
+		if robotsMatch(p, path) && len(p) > allowLen {
+			allowLen = len(p)
+		}
+	}
+	for _, p := range r.disallow {
+		if robotsMatch(p, path) && len(p) > disallowLen {
+			disallowLen = len(p)
+		}
+	}
+	return disallowLen < 0 || allowLen >= disallowLen
+}
+
+// robotsMatch matches a robots.txt path pattern, which supports "*" for any
+// sequence of characters and a trailing "$" to anchor the end.
+func robotsMatch(pattern, path string) bool {
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(strings.TrimSuffix(pattern, "$")), `\*`, ".*")
+	if strings.HasSuffix(pattern, "$") {
+		expr += "$"
+	}
+	matched, _ := regexp.MatchString(expr, path)
+	return matched
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRobots(t *testing.T) {
+	robots := `
+# Comments are ignored
+User-agent: *
+Disallow: /private
+Allow: /private/public-page
+Disallow: /*.pdf$
+
+User-agent: OtherBot
+User-agent: RAGBot
+Disallow: /
+Allow: /docs/
+`
+
+	tests := []struct {
+		name      string
+		userAgent string
+		path      string
+		allowed   bool
+	}{
+		{"Default group allows other paths", "SomeBot/2.0", "/about", true},
+		{"Default group disallows prefix", "SomeBot/2.0", "/private/notes", false},
+		{"Longer allow wins", "SomeBot/2.0", "/private/public-page", true},
+		{"Wildcard with anchor", "SomeBot/2.0", "/files/report.pdf", false},
+		{"Anchor does not match longer path", "SomeBot/2.0", "/files/report.pdf.html", true},
+		{"Specific group replaces default", "RAGBot/1.0", "/about", false},
+		{"Specific group allow", "RAGBot/1.0", "/docs/install", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := parseRobots(strings.NewReader(robots), tt.userAgent)
+			assert.Equal(t, tt.allowed, rules.Allowed(tt.path))
+		})
+	}
+
+	assert.True(t, parseRobots(strings.NewReader(""), "RAGBot").Allowed("/anything"))
+	assert.True(t, parseRobots(strings.NewReader("User-agent: *\nDisallow:\n"), "RAGBot").Allowed("/anything"))
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+)
+
+var ErrShareExpired = errors.New("this share link has expired")
+
+// NewShareToken returns an unguessable URL-safe token with 256 bits of
+// randomness.
+func NewShareToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// ShareConversation snapshots a conversation and its messages into a new
+// public share. A nil expiresAt makes the link permanent until revoked.
+func ShareConversation(conversation *models.Conversation, expiresAt *time.Time) (*models.ConversationShare, error) {
+	var messages []models.Message
+	if err := database.DB.Where("conversation_id = ?", conversation.ID).Order("created_at asc, id asc").Find(&messages).Error; err != nil {
+		return nil, err
+	}
+
+	token, err := NewShareToken()
+	if err != nil {
+		return nil, err
+	}
+
+	share := models.ConversationShare{
+		ConversationID: conversation.ID,
+		UserID:         conversation.UserID,
+		Token:          token,
+		Title:          conversation.Title,
+		Messages:       make([]models.SharedMessage, 0, len(messages)),
+		ExpiresAt:      expiresAt,
+	}
+	for _, m := range messages {
+		share.Messages = append(share.Messages, models.SharedMessage{Role: m.Role, Content: m.Content, CreatedAt: m.CreatedAt})
+	}
+	if err := database.DB.Create(&share).Error; err != nil {
+		return nil, err
+	}
+	return &share, nil
+}
+
+// FindConversationShare loads the share with the given token. Revoked shares
+// are not found; expired ones return ErrShareExpired.
+func FindConversationShare(token string) (*models.ConversationShare, error) {
+	var share models.ConversationShare
+	if err := database.DB.Where("token = ?", token).First(&share).Error; err != nil {
+		return nil, err
+	}
+	if share.ExpiresAt != nil && time.Now().After(*share.ExpiresAt) {
+		return nil, ErrShareExpired
+	}
+	return &share, nil
+}
@@ -0,0 +1,247 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+)
+
+var ErrSourceLocked = errors.New("source is already being crawled")
+
+// SyncResult summarizes one crawl of a DocumentSource.
+type SyncResult struct {
+	Pages     int `json:"pages"`
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+}
+
+// SyncDocumentSource crawls a source and stores each page as a text snapshot
+// file of the source's document. Pages seen before get a new file version
+// only when their text changed. Pages that disappeared from the site are
+// kept. The crawl outcome and next scheduled crawl are saved on the source.
+func SyncDocumentSource(ctx context.Context, source *models.DocumentSource) (*SyncResult, error) {
+	result, err := syncDocumentSource(ctx, source)
+
+	now := time.Now()
+	source.LastCrawledAt = &now
+	source.LastError = ""
+	if err != nil {
+		source.LastError = err.Error()
+	}
+	source.NextCrawlAt = nil
+	if source.RecrawlIntervalHours > 0 {
+		next := now.Add(time.Duration(source.RecrawlIntervalHours) * time.Hour)
+		source.NextCrawlAt = &next
+	}
+	if saveErr := database.DB.Save(source).Error; saveErr != nil && err == nil {
+		err = saveErr
+	}
+	return result, err
+}
+
+func syncDocumentSource(ctx context.Context, source *models.DocumentSource) (*SyncResult, error) {
+	var doc models.Document
+	if err := database.DB.First(&doc, source.DocumentID).Error; err != nil {
+		return nil, err
+	}
+
+	crawler := NewCrawler(source.MaxDepth, source.MaxPages)
+	var pages []CrawledPage
+	var err error
+	if source.Kind == "sitemap" {
+		pages, err = crawler.CrawlSitemap(ctx, source.URL)
+	} else {
+		pages, err = crawler.CrawlPages(ctx, source.URL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SyncResult{Pages: len(pages)}
+	for _, page := range pages {
+		if strings.TrimSpace(page.Text) == "" {
+			continue
+		}
+		changed, created, err := storePageSnapshot(ctx, &doc, source, page)
+		if err != nil {
+			return result, err
+		}
+		switch {
+		case created:
+			result.Created++
+		case changed:
+			result.Updated++
+		default:
+			result.Unchanged++
+		}
+	}
+	return result, nil
+}
+
+// storePageSnapshot saves the text of a page as a new file or as a new
+// version of the file previously crawled from the same URL.
+func storePageSnapshot(ctx context.Context, doc *models.Document, source *models.DocumentSource, page CrawledPage) (changed, created bool, err error) {
+	content := []byte(pageSnapshot(page))
+	contentHash, err := HashContent(bytes.NewReader(content))
+	if err != nil {
+		return false, false, err
+	}
+
+	var existing models.DocumentFile
+	err = database.DB.Where("source_id = ? AND source_url = ?", source.ID, page.URL).First(&existing).Error
+	found := err == nil
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, false, err
+	}
+	if found && existing.ContentHash == contentHash {
+		return false, false, nil
+	}
+
+	size := int64(len(content))
+	if err := ValidateStorageQuota(doc.UserID, size); err != nil {
+		return false, false, err
+	}
+
+	fileName := pageFileName(page)
+	objectKey, release, exists := FindObjectByHash(ctx, contentHash)
+	if !exists {
+		objectKey = BuildObjectKey(doc.ID, fileName)
+		if err := UploadFile(ctx, objectKey, "text/plain", bytes.NewReader(content), size); err != nil {
+			return false, false, err
+		}
+	}
+
+	snapshot := &models.DocumentFile{
+		DocumentID:  doc.ID,
+		FileName:    fileName,
+		ObjectKey:   objectKey,
+		ContentType: "text/plain",
+		Size:        size,
+		ContentHash: contentHash,
+		SourceID:    &source.ID,
+		SourceURL:   page.URL,
+	}
+	if u, err := url.Parse(page.URL); err == nil {
+		snapshot.Path = u.Host
+	}
+
+	if found {
+		err = database.DB.Transaction(func(tx *gorm.DB) error {
+			return AdvanceFileVersion(tx, &existing, snapshot)
+		})
+	} else {
+		err = database.DB.Create(snapshot).Error
+	}
+	release()
+	if err != nil {
+		_ = ReleaseObject(ctx, objectKey)
+		return false, false, err
+	}
+	return true, !found, nil
+}
+
+// pageSnapshot is the stored text of a page: its title and URL followed by
+// the extracted content, so answers can cite where a passage came from.
+func pageSnapshot(page CrawledPage) string {
+	var sb strings.Builder
+	if page.Title != "" {
+		sb.WriteString(page.Title + "\n")
+	}
+	sb.WriteString(page.URL + "\n\n")
+	sb.WriteString(page.Text)
+	return sb.String()
+}
+
+// pageFileName names a snapshot after the page title, falling back to the last
+// segment of its URL path.
+func pageFileName(page CrawledPage) string {
+	name := page.Title
+	if name == "" {
+		if u, err := url.Parse(page.URL); err == nil {
+			name = path.Base(strings.TrimSuffix(u.Path, "/"))
+			if name == "." || name == "/" || name == "" {
+				name = u.Host
+			}
+		}
+	}
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r < 0x20 {
+			return '-'
+		}
+		return r
+	}, name)
+	if len(name) > 200 {
+		name = strings.ToValidUTF8(name[:200], "")
+	}
+	return name + ".txt"
+}
+
+// LockDocumentSource keeps two crawls of the same source, manual or
+// scheduled, from running at once. The returned function releases the lock.
+func LockDocumentSource(ctx context.Context, id uint) (func(), error) {
+	unlock, ok, err := acquireLock(ctx, fmt.Sprintf("source:%d:lock", id), time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrSourceLocked
+	}
+	return unlock, nil
+}
+
+// RecrawlDueSources syncs every source whose next scheduled crawl has passed.
+// It returns the number of sources crawled.
+func RecrawlDueSources(ctx context.Context) (int, error) {
+	var sources []models.DocumentSource
+	err := database.DB.Where("recrawl_interval_hours > 0 AND next_crawl_at <= ?", time.Now()).Find(&sources).Error
+	if err != nil {
+		return 0, err
+	}
+
+	crawled := 0
+	for i := range sources {
+		unlock, err := LockDocumentSource(ctx, sources[i].ID)
+		if err != nil {
+			continue
+		}
+		if _, err := SyncDocumentSource(ctx, &sources[i]); err != nil {
+			log.Printf("Re-crawl of source %d failed: %v", sources[i].ID, err)
+		}
+		unlock()
+		crawled++
+	}
+	return crawled, nil
+}
+
+// StartSourceRecrawler periodically re-crawls due sources until ctx is cancelled.
+func StartSourceRecrawler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			crawled, err := RecrawlDueSources(ctx)
+			if err != nil {
+				log.Printf("Source re-crawl failed: %v", err)
+				continue
+			}
+			if crawled > 0 {
+				log.Printf("Re-crawled %d document sources", crawled)
+			}
+		}
+	}
+}
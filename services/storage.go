@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"hsduc.com/rag/config"
+)
+
+// ObjectInfo is the backend-independent metadata of a stored object.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+// Storage is implemented by every object storage backend the app can run on.
+type Storage interface {
+	Put(ctx context.Context, key, contentType string, reader io.Reader, size int64) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	PresignGet(ctx context.Context, key string, expiry time.Duration) (string, error)
+	PresignPut(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// composer is implemented by backends that can concatenate objects without
+// streaming them through the app.
+type composer interface {
+	Compose(ctx context.Context, key, contentType string, sourceKeys []string, sizes []int64) (bool, error)
+}
+
+// Store is the storage backend selected by InitStorage.
+var Store Storage
+
+// InitStorage connects the storage backend chosen by STORAGE_BACKEND.
+func InitStorage() error {
+	var err error
+	switch config.App.StorageBackend {
+	case "minio", "s3", "":
+		Store, err = NewMinioStorage(config.App.MinioEndpoint, config.App.MinioAccessKey, config.App.MinioSecretKey, config.App.MinioBucket, config.App.MinioUseSSL)
+	case "local":
+		Store, err = NewLocalStorage(config.App.LocalStoragePath, config.App.PublicBaseURL+"/storage", []byte(config.App.StorageSigningKey))
+	default:
+		err = fmt.Errorf("unknown storage backend %q", config.App.StorageBackend)
+	}
+	return err
+}
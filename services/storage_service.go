@@ -5,33 +5,74 @@ import (
 	"fmt"
 	"io"
 	"time"
-
-	"github.com/minio/minio-go/v7"
-	"hsduc.com/rag/config"
-	"hsduc.com/rag/database"
 )
 
 func UploadFile(ctx context.Context, objectKey, contentType string, reader io.Reader, size int64) error {
-	_, err := database.Minio.PutObject(ctx, config.App.MinioBucket, objectKey, reader, size, minio.PutObjectOptions{
-		ContentType: contentType,
-	})
-	return err
+	return Store.Put(ctx, objectKey, contentType, reader, size)
 }
 
 func DeleteFile(ctx context.Context, objectKey string) error {
-	return database.Minio.RemoveObject(ctx, config.App.MinioBucket, objectKey, minio.RemoveObjectOptions{})
+	return Store.Delete(ctx, objectKey)
 }
 
 // GetPresignedURL returns a temporary download URL valid for the given duration.
 func GetPresignedURL(ctx context.Context, objectKey string, expiry time.Duration) (string, error) {
-	u, err := database.Minio.PresignedGetObject(ctx, config.App.MinioBucket, objectKey, expiry, nil)
-	if err != nil {
-		return "", err
+	return Store.PresignGet(ctx, objectKey, expiry)
+}
+
+// GetPresignedUploadURL returns a temporary URL the client can PUT the object body to directly.
+func GetPresignedUploadURL(ctx context.Context, objectKey string, expiry time.Duration) (string, error) {
+	return Store.PresignPut(ctx, objectKey, expiry)
+}
+
+// StatFile returns the stored metadata of an object, or an error if it does not exist.
+func StatFile(ctx context.Context, objectKey string) (ObjectInfo, error) {
+	return Store.Stat(ctx, objectKey)
+}
+
+// GetFile opens an object for reading. The caller must close the returned reader.
+func GetFile(ctx context.Context, objectKey string) (io.ReadCloser, error) {
+	return Store.Get(ctx, objectKey)
+}
+
+// ListFiles returns the metadata of all objects whose key starts with prefix.
+func ListFiles(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	return Store.List(ctx, prefix)
+}
+
+// ComposeFiles concatenates the source objects, in order, into a single object.
+// Backends that cannot do this server-side get the parts streamed through the app.
+func ComposeFiles(ctx context.Context, objectKey, contentType string, sourceKeys []string, sizes []int64) error {
+	if c, ok := Store.(composer); ok {
+		done, err := c.Compose(ctx, objectKey, contentType, sourceKeys, sizes)
+		if done || err != nil {
+			return err
+		}
+	}
+
+	var total int64
+	for _, size := range sizes {
+		total += size
 	}
-	return u.String(), nil
+
+	readers := make([]io.Reader, 0, len(sourceKeys))
+	for _, key := range sourceKeys {
+		r, err := GetFile(ctx, key)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		readers = append(readers, r)
+	}
+	return UploadFile(ctx, objectKey, contentType, io.MultiReader(readers...), total)
 }
 
 // BuildObjectKey generates a unique object key for a document file.
 func BuildObjectKey(documentID uint, fileName string) string {
-	return fmt.Sprintf("documents/%d/%d_%s", documentID, time.Now().UnixNano(), fileName)
+	return fmt.Sprintf("%s%d_%s", DocumentObjectPrefix(documentID), time.Now().UnixNano(), fileName)
+}
+
+// DocumentObjectPrefix returns the key prefix under which all files of a document are stored.
+func DocumentObjectPrefix(documentID uint) string {
+	return fmt.Sprintf("documents/%d/", documentID)
 }
@@ -0,0 +1,556 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"hsduc.com/rag/config"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+)
+
+var (
+	ErrNotInTrash    = errors.New("item not found in trash")
+	ErrParentInTrash = errors.New("the item it belongs to is in the trash, restore that first")
+)
+
+// Trash item kinds, as used in trash URLs.
+const (
+	TrashConversations = "conversations"
+	TrashMessages      = "messages"
+	TrashDocuments     = "documents"
+	TrashFiles         = "files"
+)
+
+// TrashItem is a deleted conversation, message, document or file that can
+// still be restored. Items deleted together with their conversation or
+// document are not listed separately; they come back with it.
+type TrashItem struct {
+	Kind      string     `json:"kind"`
+	ID        uint       `json:"id"`
+	ParentID  uint       `json:"parent_id,omitempty"`
+	Title     string     `json:"title"`
+	DeletedAt time.Time  `json:"deleted_at"`
+	PurgeAt   *time.Time `json:"purge_at"`
+}
+
+// trashRetention is how long deleted items are kept; zero keeps them forever.
+func trashRetention() time.Duration {
+	return time.Duration(config.App.TrashRetentionDays) * 24 * time.Hour
+}
+
+// trashPosition orders trash items, which come from several tables, by when
+// they were deleted, then kind and id.
+type trashPosition struct {
+	DeletedAt time.Time `json:"t"`
+	Kind      string    `json:"k"`
+}
+
+func (item TrashItem) before(other TrashItem) bool {
+	if !item.DeletedAt.Equal(other.DeletedAt) {
+		return item.DeletedAt.Before(other.DeletedAt)
+	}
+	if item.Kind != other.Kind {
+		return item.Kind < other.Kind
+	}
+	return item.ID < other.ID
+}
+
+// ListTrash returns one page of the restorable items of userID in the order
+// of params.Sort, deleted_at with an optional "-" prefix. UpdatedSince keeps
+// items deleted since then. Each kind is paged in its own table and the pages
+// merged, so at most one page per kind is loaded. It returns the cursor of the
+// next page, or "" on the last page.
+func ListTrash(userID uint, params ListParams) ([]TrashItem, string, error) {
+	desc := strings.HasPrefix(params.Sort, "-")
+	dir := " ASC"
+	if desc {
+		dir = " DESC"
+	}
+
+	var after *TrashItem
+	if params.Cursor != "" {
+		cursor, value, err := decodeCursor(params.Cursor, params.Sort, reflect.TypeOf(trashPosition{}))
+		if err != nil {
+			return nil, "", err
+		}
+		position := value.(trashPosition)
+		after = &TrashItem{Kind: position.Kind, ID: cursor.ID, DeletedAt: position.DeletedAt}
+	}
+
+	items := []TrashItem{}
+	for _, source := range trashSources {
+		deletedAt, id := source.table+".deleted_at", source.table+".id"
+		db := database.DB.Unscoped()
+		if params.UpdatedSince != nil {
+			db = db.Where(deletedAt+" >= ?", *params.UpdatedSince)
+		}
+		if after != nil {
+			db = afterTrashItem(db, deletedAt, id, source.kind, after, desc)
+		}
+		page, err := source.load(db.Order(deletedAt+dir).Order(id+dir).Limit(params.Limit+1), userID)
+		if err != nil {
+			return nil, "", err
+		}
+		items = append(items, page...)
+	}
+
+	sort.SliceStable(items, func(a, b int) bool { return items[a].before(items[b]) != desc })
+	if len(items) <= params.Limit {
+		return items, "", nil
+	}
+	items = items[:params.Limit]
+	last := items[len(items)-1]
+	next, err := encodeCursor(params.Sort, trashPosition{DeletedAt: last.DeletedAt, Kind: last.Kind}, last.ID)
+	return items, next, err
+}
+
+// afterTrashItem restricts db, a query on the table of kind, to the items that
+// come after the item a cursor points at.
+func afterTrashItem(db *gorm.DB, deletedAt, id, kind string, after *TrashItem, desc bool) *gorm.DB {
+	op := ">"
+	if desc {
+		op = "<"
+	}
+	switch {
+	case kind == after.Kind:
+		return db.Where(fmt.Sprintf("(%[1]s %[3]s ? OR (%[1]s = ? AND %[2]s %[3]s ?))", deletedAt, id, op), after.DeletedAt, after.DeletedAt, after.ID)
+	case (kind > after.Kind) != desc:
+		// Items of this kind deleted at the same time follow the cursor's kind
+		return db.Where(deletedAt+" "+op+"= ?", after.DeletedAt)
+	default:
+		return db.Where(deletedAt+" "+op+" ?", after.DeletedAt)
+	}
+}
+
+// trashSources load the restorable items of userID of one kind from db, which
+// is scoped, ordered and limited on the deleted_at and id of table.
+var trashSources = []struct {
+	kind  string
+	table string
+	load  func(db *gorm.DB, userID uint) ([]TrashItem, error)
+}{
+	{TrashConversations, "conversations", func(db *gorm.DB, userID uint) ([]TrashItem, error) {
+		var conversations []models.Conversation
+		if err := db.Where("user_id = ? AND deleted_at IS NOT NULL", userID).Find(&conversations).Error; err != nil {
+			return nil, err
+		}
+		var items []TrashItem
+		for _, conv := range conversations {
+			items = append(items, newTrashItem(TrashConversations, conv.ID, 0, conv.Title, conv.DeletedAt))
+		}
+		return items, nil
+	}},
+	{TrashMessages, "messages", func(db *gorm.DB, userID uint) ([]TrashItem, error) {
+		var messages []models.Message
+		err := db.Joins("JOIN conversations ON conversations.id = messages.conversation_id").
+			Where("conversations.user_id = ? AND conversations.deleted_at IS NULL AND messages.deleted_at IS NOT NULL", userID).
+			Find(&messages).Error
+		if err != nil {
+			return nil, err
+		}
+		var items []TrashItem
+		for _, msg := range messages {
+			excerpt, _ := truncateUTF8([]byte(msg.Content), 100)
+			items = append(items, newTrashItem(TrashMessages, msg.ID, msg.ConversationID, excerpt, msg.DeletedAt))
+		}
+		return items, nil
+	}},
+	{TrashDocuments, "documents", func(db *gorm.DB, userID uint) ([]TrashItem, error) {
+		var documents []models.Document
+		if err := db.Where("user_id = ? AND deleted_at IS NOT NULL", userID).Find(&documents).Error; err != nil {
+			return nil, err
+		}
+		var items []TrashItem
+		for _, doc := range documents {
+			items = append(items, newTrashItem(TrashDocuments, doc.ID, 0, doc.Title, doc.DeletedAt))
+		}
+		return items, nil
+	}},
+	{TrashFiles, "document_files", func(db *gorm.DB, userID uint) ([]TrashItem, error) {
+		var files []models.DocumentFile
+		err := db.Joins("JOIN documents ON documents.id = document_files.document_id").
+			Where("documents.user_id = ? AND documents.deleted_at IS NULL AND document_files.deleted_at IS NOT NULL", userID).
+			Find(&files).Error
+		if err != nil {
+			return nil, err
+		}
+		var items []TrashItem
+		for _, file := range files {
+			items = append(items, newTrashItem(TrashFiles, file.ID, file.DocumentID, file.FileName, file.DeletedAt))
+		}
+		return items, nil
+	}},
+}
+
+func newTrashItem(kind string, id, parentID uint, title string, deletedAt gorm.DeletedAt) TrashItem {
+	item := TrashItem{Kind: kind, ID: id, ParentID: parentID, Title: title, DeletedAt: deletedAt.Time}
+	if retention := trashRetention(); retention > 0 {
+		purgeAt := deletedAt.Time.Add(retention)
+		item.PurgeAt = &purgeAt
+	}
+	return item
+}
+
+// RestoreConversation takes a conversation of userID out of the trash. It
+// leaves its folder when the folder has been deleted since.
+func RestoreConversation(userID, id uint) (*models.Conversation, error) {
+	var conv models.Conversation
+	if err := database.DB.Unscoped().Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", id, userID).First(&conv).Error; err != nil {
+		return nil, notInTrash(err)
+	}
+
+	if conv.FolderID != nil {
+		var count int64
+		if err := database.DB.Model(&models.ConversationFolder{}).Where("id = ?", *conv.FolderID).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			conv.FolderID = nil
+		}
+	}
+
+	conv.DeletedAt = gorm.DeletedAt{}
+	if err := database.DB.Unscoped().Model(&conv).Updates(map[string]interface{}{"deleted_at": nil, "folder_id": conv.FolderID}).Error; err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
+
+// RestoreMessage takes a message of one of userID's conversations out of the
+// trash. The conversation itself must not be in the trash.
+func RestoreMessage(userID, id uint) (*models.Message, error) {
+	var msg models.Message
+	err := database.DB.Unscoped().
+		Joins("JOIN conversations ON conversations.id = messages.conversation_id").
+		Where("messages.id = ? AND conversations.user_id = ? AND messages.deleted_at IS NOT NULL", id, userID).
+		First(&msg).Error
+	if err != nil {
+		return nil, notInTrash(err)
+	}
+
+	var conv models.Conversation
+	if err := database.DB.First(&conv, msg.ConversationID).Error; err != nil {
+		return nil, ErrParentInTrash
+	}
+
+	msg.DeletedAt = gorm.DeletedAt{}
+	if err := database.DB.Unscoped().Model(&msg).Update("deleted_at", nil).Error; err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// RestoreDocument takes a document of userID out of the trash together with
+// the files and sources deleted along with it. Files deleted on their own
+// before stay in the trash. The restored files must fit in the storage quota.
+func RestoreDocument(userID, id uint) (*models.Document, error) {
+	var doc models.Document
+	if err := database.DB.Unscoped().Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", id, userID).First(&doc).Error; err != nil {
+		return nil, notInTrash(err)
+	}
+	deletedAt := doc.DeletedAt.Time
+
+	var files []models.DocumentFile
+	if err := database.DB.Unscoped().Where("document_id = ? AND deleted_at >= ?", doc.ID, deletedAt).Find(&files).Error; err != nil {
+		return nil, err
+	}
+	if err := validateRestoreQuota(userID, files); err != nil {
+		return nil, err
+	}
+
+	if doc.CollectionID != nil {
+		var count int64
+		if err := database.DB.Model(&models.Collection{}).Where("id = ?", *doc.CollectionID).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			doc.CollectionID = nil
+		}
+	}
+
+	doc.DeletedAt = gorm.DeletedAt{}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&doc).Updates(map[string]interface{}{"deleted_at": nil, "collection_id": doc.CollectionID}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.DocumentFile{}).Where("document_id = ? AND deleted_at >= ?", doc.ID, deletedAt).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.DocumentSource{}).Where("document_id = ? AND deleted_at >= ?", doc.ID, deletedAt).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		if err := SyncLabels(tx, doc.ID, 0, doc.Tags, doc.Metadata); err != nil {
+			return err
+		}
+		for _, file := range files {
+			if err := SyncLabels(tx, doc.ID, file.ID, file.Tags, file.Metadata); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	doc.Files = files
+	return &doc, nil
+}
+
+// RestoreFile takes a file of one of userID's documents out of the trash. The
+// document itself must not be in the trash and the file must fit in the
+// storage quota.
+func RestoreFile(userID, id uint) (*models.DocumentFile, error) {
+	var file models.DocumentFile
+	err := database.DB.Unscoped().
+		Joins("JOIN documents ON documents.id = document_files.document_id").
+		Where("document_files.id = ? AND documents.user_id = ? AND document_files.deleted_at IS NOT NULL", id, userID).
+		First(&file).Error
+	if err != nil {
+		return nil, notInTrash(err)
+	}
+
+	var doc models.Document
+	if err := database.DB.First(&doc, file.DocumentID).Error; err != nil {
+		return nil, ErrParentInTrash
+	}
+	if err := validateRestoreQuota(userID, []models.DocumentFile{file}); err != nil {
+		return nil, err
+	}
+
+	file.DeletedAt = gorm.DeletedAt{}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&file).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		return SyncLabels(tx, file.DocumentID, file.ID, file.Tags, file.Metadata)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// validateRestoreQuota checks that files and their archived versions fit in
+// the storage quota of userID again.
+func validateRestoreQuota(userID uint, files []models.DocumentFile) error {
+	if len(files) == 0 {
+		return nil
+	}
+
+	var size int64
+	ids := make([]uint, 0, len(files))
+	for _, file := range files {
+		size += file.Size
+		ids = append(ids, file.ID)
+	}
+	var versionsSize int64
+	err := database.DB.Model(&models.DocumentFileVersion{}).
+		Where("document_file_id IN ?", ids).
+		Select("COALESCE(SUM(size), 0)").
+		Scan(&versionsSize).Error
+	if err != nil {
+		return err
+	}
+	return ValidateStorageQuota(userID, size+versionsSize)
+}
+
+func notInTrash(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotInTrash
+	}
+	return err
+}
+
+// EmptyTrash permanently deletes everything in userID's trash right away and
+// returns the number of items removed.
+func EmptyTrash(ctx context.Context, userID uint) (int, error) {
+	conversations := database.DB.Unscoped().Model(&models.Conversation{}).Select("id").Where("user_id = ?", userID)
+	documents := database.DB.Unscoped().Model(&models.Document{}).Select("id").Where("user_id = ?", userID)
+	return purgeTrash(ctx, trashScope{
+		conversations: func(db *gorm.DB) *gorm.DB { return db.Where("user_id = ?", userID) },
+		messages:      func(db *gorm.DB) *gorm.DB { return db.Where("conversation_id IN (?)", conversations) },
+		documents:     func(db *gorm.DB) *gorm.DB { return db.Where("user_id = ?", userID) },
+		files:         func(db *gorm.DB) *gorm.DB { return db.Where("document_id IN (?)", documents) },
+	})
+}
+
+// PurgeTrash permanently deletes every item that has been in the trash longer
+// than the configured retention. It returns the number of items removed.
+func PurgeTrash(ctx context.Context) (int, error) {
+	retention := trashRetention()
+	if retention <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-retention)
+	before := func(db *gorm.DB) *gorm.DB { return db.Where("deleted_at < ?", cutoff) }
+	return purgeTrash(ctx, trashScope{conversations: before, messages: before, documents: before, files: before})
+}
+
+// trashScope narrows the deleted rows of each kind that a purge removes.
+type trashScope struct {
+	conversations, messages, documents, files func(*gorm.DB) *gorm.DB
+}
+
+func purgeTrash(ctx context.Context, scope trashScope) (int, error) {
+	deletedIDs := func(model interface{}, narrow func(*gorm.DB) *gorm.DB) ([]uint, error) {
+		var ids []uint
+		err := narrow(database.DB.Unscoped().Model(model).Where("deleted_at IS NOT NULL")).Pluck("id", &ids).Error
+		return ids, err
+	}
+
+	conversationIDs, err := deletedIDs(&models.Conversation{}, scope.conversations)
+	if err != nil {
+		return 0, err
+	}
+	messageIDs, err := deletedIDs(&models.Message{}, scope.messages)
+	if err != nil {
+		return 0, err
+	}
+	documentIDs, err := deletedIDs(&models.Document{}, scope.documents)
+	if err != nil {
+		return 0, err
+	}
+	fileIDs, err := deletedIDs(&models.DocumentFile{}, scope.files)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := purgeConversations(ctx, conversationIDs, messageIDs); err != nil {
+		return 0, err
+	}
+	if err := purgeDocuments(ctx, documentIDs, fileIDs); err != nil {
+		return 0, err
+	}
+	return len(conversationIDs) + len(messageIDs) + len(documentIDs) + len(fileIDs), nil
+}
+
+// purgeConversations hard-deletes conversations with all their messages and
+// dropped-in files, and single trashed messages, then deletes their
+// attachments.
+func purgeConversations(ctx context.Context, conversationIDs, messageIDs []uint) error {
+	if len(conversationIDs) > 0 {
+		var conversationMessageIDs []uint
+		if err := database.DB.Unscoped().Model(&models.Message{}).Where("conversation_id IN ?", conversationIDs).Pluck("id", &conversationMessageIDs).Error; err != nil {
+			return err
+		}
+		messageIDs = append(messageIDs, conversationMessageIDs...)
+	}
+	if len(conversationIDs) == 0 && len(messageIDs) == 0 {
+		return nil
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if len(messageIDs) > 0 {
+			if err := tx.Unscoped().Where("message_id IN ?", messageIDs).Delete(&models.MessageFeedback{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Where("id IN ?", messageIDs).Delete(&models.Message{}).Error; err != nil {
+				return err
+			}
+		}
+		if len(conversationIDs) == 0 {
+			return nil
+		}
+		for _, model := range []interface{}{&models.ConversationTag{}, &models.ConversationShare{}, &models.ConversationFileChunk{}, &models.ConversationFile{}} {
+			if err := tx.Unscoped().Where("conversation_id IN ?", conversationIDs).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Where("id IN ?", conversationIDs).Delete(&models.Conversation{}).Error
+	})
+	if err != nil || len(messageIDs) == 0 {
+		return err
+	}
+
+	_, err = deleteAttachments(ctx, database.DB.Where("message_id IN ?", messageIDs))
+	return err
+}
+
+// purgeDocuments hard-deletes documents with everything in them, and single
+// trashed files, then releases their storage objects.
+func purgeDocuments(ctx context.Context, documentIDs, fileIDs []uint) error {
+	if len(documentIDs) > 0 {
+		var documentFileIDs []uint
+		if err := database.DB.Unscoped().Model(&models.DocumentFile{}).Where("document_id IN ?", documentIDs).Pluck("id", &documentFileIDs).Error; err != nil {
+			return err
+		}
+		fileIDs = append(fileIDs, documentFileIDs...)
+	}
+	if len(documentIDs) == 0 && len(fileIDs) == 0 {
+		return nil
+	}
+
+	var objectKeys, versionKeys []string
+	if err := database.DB.Unscoped().Model(&models.DocumentFile{}).Where("id IN ?", fileIDs).Pluck("object_key", &objectKeys).Error; err != nil {
+		return err
+	}
+	if err := database.DB.Model(&models.DocumentFileVersion{}).Where("document_file_id IN ?", fileIDs).Pluck("object_key", &versionKeys).Error; err != nil {
+		return err
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if len(fileIDs) > 0 {
+			if err := tx.Unscoped().Where("document_file_id IN ?", fileIDs).Delete(&models.DocumentFileVersion{}).Error; err != nil {
+				return err
+			}
+			for _, model := range []interface{}{&models.DocumentLabel{}, &models.DocumentFileChunk{}} {
+				if err := tx.Unscoped().Where("document_file_id IN ?", fileIDs).Delete(model).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Unscoped().Where("id IN ?", fileIDs).Delete(&models.DocumentFile{}).Error; err != nil {
+				return err
+			}
+		}
+		if len(documentIDs) == 0 {
+			return nil
+		}
+		for _, model := range []interface{}{&models.DocumentLabel{}, &models.DocumentSource{}, &models.DocumentShare{}} {
+			if err := tx.Unscoped().Where("document_id IN ?", documentIDs).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Where("id IN ?", documentIDs).Delete(&models.Document{}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range append(objectKeys, versionKeys...) {
+		if err := ReleaseObject(ctx, key); err != nil {
+			log.Printf("Failed to release purged object %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// StartTrashPurger periodically purges expired trash until ctx is cancelled.
+func StartTrashPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := PurgeTrash(ctx)
+			if err != nil {
+				log.Printf("Trash purge failed: %v", err)
+				continue
+			}
+			if removed > 0 {
+				log.Printf("Trash purge removed %d items", removed)
+			}
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"hsduc.com/rag/config"
+	"hsduc.com/rag/database"
+)
+
+const uploadPartsPrefix = "uploads/"
+
+var (
+	ErrUploadNotFound = errors.New("upload not found")
+	ErrUploadLocked   = errors.New("upload is being written by another request")
+)
+
+// UploadSession is the resumable upload state persisted in Redis between chunks.
+type UploadSession struct {
+	ID          string    `json:"id"`
+	UserID      uint      `json:"user_id"`
+	DocumentID  uint      `json:"document_id"`
+	FileName    string    `json:"file_name"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	Offset      int64     `json:"offset"`
+	Parts       []string  `json:"parts"`
+	PartSizes   []int64   `json:"part_sizes"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+func uploadExpiry() time.Duration {
+	return time.Duration(config.App.UploadExpiryHours) * time.Hour
+}
+
+func uploadSessionKey(id string) string {
+	return "upload:" + id
+}
+
+// SaveUploadSession persists the session and refreshes its expiry.
+func SaveUploadSession(ctx context.Context, s *UploadSession) error {
+	s.ExpiresAt = time.Now().Add(uploadExpiry())
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return database.Redis.Set(ctx, uploadSessionKey(s.ID), data, uploadExpiry()).Err()
+}
+
+// GetUploadSession loads a session, returning ErrUploadNotFound if it expired or never existed.
+func GetUploadSession(ctx context.Context, id string) (*UploadSession, error) {
+	data, err := database.Redis.Get(ctx, uploadSessionKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var s UploadSession
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// LockUploadSession guards a session against concurrent chunk writes. The
+// lock is held for as long as the chunk takes; the returned function releases
+// it.
+func LockUploadSession(ctx context.Context, id string) (func(), error) {
+	unlock, ok, err := acquireLock(ctx, uploadSessionKey(id)+":lock", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrUploadLocked
+	}
+	return unlock, nil
+}
+
+// AppendUploadChunk stores the next chunk of the upload as a part object and advances the offset.
+func AppendUploadChunk(ctx context.Context, s *UploadSession, reader io.Reader, length int64) error {
+	partKey := fmt.Sprintf("%s%s/%012d", uploadPartsPrefix, s.ID, s.Offset)
+	if err := UploadFile(ctx, partKey, "application/octet-stream", reader, length); err != nil {
+		return err
+	}
+
+	s.Parts = append(s.Parts, partKey)
+	s.PartSizes = append(s.PartSizes, length)
+	s.Offset += length
+	return SaveUploadSession(ctx, s)
+}
+
+// FinishUploadSession assembles all parts into the final document object and
+// removes the session. It returns the key of the assembled object.
+func FinishUploadSession(ctx context.Context, s *UploadSession) (string, error) {
+	objectKey := BuildObjectKey(s.DocumentID, s.FileName)
+	if err := ComposeFiles(ctx, objectKey, s.ContentType, s.Parts, s.PartSizes); err != nil {
+		return "", err
+	}
+
+	if err := AbortUploadSession(ctx, s); err != nil {
+		log.Printf("Failed to clean up upload %s: %v", s.ID, err)
+	}
+	return objectKey, nil
+}
+
+// AbortUploadSession removes the stored parts and the session state.
+func AbortUploadSession(ctx context.Context, s *UploadSession) error {
+	for _, key := range s.Parts {
+		if err := DeleteFile(ctx, key); err != nil {
+			return err
+		}
+	}
+	return database.Redis.Del(ctx, uploadSessionKey(s.ID)).Err()
+}
+
+// CleanupStaleUploads deletes part objects whose session has expired from Redis.
+// It returns the number of objects removed.
+func CleanupStaleUploads(ctx context.Context) (int, error) {
+	objects, err := ListFiles(ctx, uploadPartsPrefix)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	alive := map[string]bool{}
+	for _, obj := range objects {
+		id, _, _ := strings.Cut(strings.TrimPrefix(obj.Key, uploadPartsPrefix), "/")
+		exists, checked := alive[id]
+		if !checked {
+			n, err := database.Redis.Exists(ctx, uploadSessionKey(id)).Result()
+			if err != nil {
+				return removed, err
+			}
+			exists = n > 0
+			alive[id] = exists
+		}
+		// Parts younger than the expiry may belong to a session that is being created right now
+		if exists || time.Since(obj.LastModified) < uploadExpiry() {
+			continue
+		}
+		if err := DeleteFile(ctx, obj.Key); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// StartUploadGC periodically garbage-collects stale upload parts until ctx is cancelled.
+func StartUploadGC(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := CleanupStaleUploads(ctx)
+			if err != nil {
+				log.Printf("Upload GC failed: %v", err)
+				continue
+			}
+			if removed > 0 {
+				log.Printf("Upload GC removed %d stale parts", removed)
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"hsduc.com/rag/config"
+	"hsduc.com/rag/database"
+	"hsduc.com/rag/models"
+	"hsduc.com/rag/utils"
+)
+
+var (
+	ErrFileTooLarge        = errors.New("file too large")
+	ErrStorageQuotaReached = errors.New("storage quota exceeded")
+	ErrUnsupportedFileType = errors.New("unsupported file type")
+)
+
+// UploadValidationError carries a user-facing message alongside one of the
+// sentinel errors above, so controllers can pick the status code with errors.Is.
+type UploadValidationError struct {
+	Kind    error
+	Message string
+}
+
+func (e *UploadValidationError) Error() string { return e.Message }
+
+func (e *UploadValidationError) Unwrap() error { return e.Kind }
+
+// ValidateUploadSize checks a new file of the given size against the per-file
+// limit and the user's remaining storage quota.
+func ValidateUploadSize(userID uint, size int64) error {
+	if err := ValidateFileSize(size); err != nil {
+		return err
+	}
+	return ValidateStorageQuota(userID, size)
+}
+
+// ValidateFileSize checks a single file against the per-file limit.
+func ValidateFileSize(size int64) error {
+	maxFile := config.App.MaxUploadSizeMB * 1024 * 1024
+	if maxFile > 0 && size > maxFile {
+		return &UploadValidationError{
+			Kind:    ErrFileTooLarge,
+			Message: fmt.Sprintf("File exceeds the maximum size of %d MB", config.App.MaxUploadSizeMB),
+		}
+	}
+	return nil
+}
+
+// ValidateStorageQuota checks that size more bytes fit in the user's storage quota.
+func ValidateStorageQuota(userID uint, size int64) error {
+	maxUser := config.App.MaxUserStorageMB * 1024 * 1024
+	if maxUser <= 0 {
+		return nil
+	}
+	used, err := UserStorageUsed(userID)
+	if err != nil {
+		return err
+	}
+	if used+size > maxUser {
+		return &UploadValidationError{
+			Kind:    ErrStorageQuotaReached,
+			Message: fmt.Sprintf("Storage quota of %d MB exceeded", config.App.MaxUserStorageMB),
+		}
+	}
+	return nil
+}
+
+// UserStorageUsed returns the total size of all files, including archived
+// versions, in the user's documents, of their chat attachments and of the
+// files dropped into their conversations. Conversation files count until the
+// conversation is purged, since restoring it brings them back unchecked.
+func UserStorageUsed(userID uint) (int64, error) {
+	var used, versionsUsed int64
+	err := database.DB.Model(&models.DocumentFile{}).
+		Joins("JOIN documents ON documents.id = document_files.document_id").
+		Where("documents.user_id = ? AND documents.deleted_at IS NULL", userID).
+		Select("COALESCE(SUM(document_files.size), 0)").
+		Scan(&used).Error
+	if err != nil {
+		return 0, err
+	}
+	err = database.DB.Model(&models.DocumentFileVersion{}).
+		Joins("JOIN document_files ON document_files.id = document_file_versions.document_file_id").
+		Joins("JOIN documents ON documents.id = document_files.document_id").
+		Where("documents.user_id = ? AND documents.deleted_at IS NULL AND document_files.deleted_at IS NULL", userID).
+		Select("COALESCE(SUM(document_file_versions.size), 0)").
+		Scan(&versionsUsed).Error
+	if err != nil {
+		return 0, err
+	}
+	var attachmentsUsed int64
+	err = database.DB.Model(&models.MessageAttachment{}).
+		Where("user_id = ?", userID).
+		Select("COALESCE(SUM(size), 0)").
+		Scan(&attachmentsUsed).Error
+	if err != nil {
+		return 0, err
+	}
+	var conversationFilesUsed int64
+	err = database.DB.Model(&models.ConversationFile{}).
+		Joins("JOIN conversations ON conversations.id = conversation_files.conversation_id").
+		Where("conversations.user_id = ?", userID).
+		Select("COALESCE(SUM(conversation_files.size), 0)").
+		Scan(&conversationFilesUsed).Error
+	return used + versionsUsed + attachmentsUsed + conversationFilesUsed, err
+}
+
+// ValidateContentType sniffs the leading bytes of a file and returns its media
+// type if it is in the configured allow-list.
+func ValidateContentType(head []byte, fileName string) (string, error) {
+	contentType := utils.SniffContentType(head, fileName)
+	if !utils.IsAllowedContentType(contentType, config.App.AllowedFileTypes) {
+		return "", &UploadValidationError{
+			Kind:    ErrUnsupportedFileType,
+			Message: fmt.Sprintf("File type %s is not allowed", contentType),
+		}
+	}
+	return contentType, nil
+}
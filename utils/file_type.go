@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// SniffLength is the number of leading bytes SniffContentType looks at.
+const SniffLength = 512
+
+// Formats that http.DetectContentType can only report generically
+// (OOXML files are ZIP archives, Markdown and CSV are plain text).
+var extensionRefinements = map[string]map[string]string{
+	"application/zip": {
+		".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	},
+	"text/plain": {
+		".md":       "text/markdown",
+		".markdown": "text/markdown",
+		".csv":      "text/csv",
+		".json":     "application/json",
+	},
+}
+
+// SniffContentType detects the media type from the first bytes of a file,
+// ignoring whatever the client claimed. The file name is only used to tell
+// apart formats that share a signature.
+func SniffContentType(head []byte, fileName string) string {
+	detected, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if refined, ok := extensionRefinements[detected][strings.ToLower(filepath.Ext(fileName))]; ok {
+		return refined
+	}
+	return detected
+}
+
+// IsAllowedContentType reports whether the media type, without parameters, is in the allow-list.
+func IsAllowedContentType(contentType string, allowed []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(mediaType, strings.TrimSpace(a)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestSniffContentType(t *testing.T) {
+	tests := []struct {
+		name     string
+		head     []byte
+		fileName string
+		expected string
+	}{
+		{"PDF", []byte("%PDF-1.7\n"), "manual.pdf", "application/pdf"},
+		{"PDF with lying extension", []byte("%PDF-1.7\n"), "notes.txt", "application/pdf"},
+		{"Plain text", []byte("hello world"), "notes.txt", "text/plain"},
+		{"Markdown", []byte("# Title\n\nBody"), "README.md", "text/markdown"},
+		{"DOCX", []byte("PK\x03\x04rest-of-archive"), "Policy.DOCX", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"ZIP", []byte("PK\x03\x04rest-of-archive"), "export.zip", "application/zip"},
+		{"ELF executable", []byte("\x7fELF\x02\x01\x01\x00\x00\x00"), "manual.pdf", "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SniffContentType(tt.head, tt.fileName); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIsAllowedContentType(t *testing.T) {
+	allowed := []string{"application/pdf", " text/plain"}
+
+	if !IsAllowedContentType("application/pdf", allowed) {
+		t.Errorf("Expected application/pdf to be allowed")
+	}
+	if !IsAllowedContentType("text/plain; charset=utf-8", allowed) {
+		t.Errorf("Expected parameters to be ignored")
+	}
+	if IsAllowedContentType("application/octet-stream", allowed) {
+		t.Errorf("Expected application/octet-stream to be rejected")
+	}
+	if IsAllowedContentType("", allowed) {
+		t.Errorf("Expected empty content type to be rejected")
+	}
+}